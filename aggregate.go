@@ -1,27 +1,114 @@
 package mongoose
 
 import (
-	"fmt"
-
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func (m *Model[M]) Aggregate(pipeline mongo.Pipeline) ([]bson.M, error) {
-	cursor, err := m.Collection.Aggregate(m.Ctx, pipeline)
+// Aggregate runs the pipeline against the collection and returns the raw
+// result documents. The optional ReadOptions are merged with the model
+// defaults and applied to the aggregate command.
+// Use AggregateInto to decode the results into a typed struct.
+func (m *Model[M]) Aggregate(pipeline mongo.Pipeline, opts ...ReadOptions) ([]bson.M, error) {
+	var results []bson.M
+	err := aggregateEach(m, pipeline, func(doc *bson.M) error {
+		results = append(results, *doc)
+		return nil
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []bson.M
+	err = ExecutePostHook(Aggregate, m, results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
 
-	if err = cursor.All(m.Ctx, &results); err != nil {
+// AggregateInto runs the pipeline against the collection of the model and
+// decodes every result document into T. The Aggregate pre and post hooks
+// are executed and the $match stages are sanitized when StrictFilters is
+// enabled on the model.
+func AggregateInto[T any, M any](m *Model[M], pipeline mongo.Pipeline, opts ...ReadOptions) ([]*T, error) {
+	var results []*T
+	err := aggregateEach(m, pipeline, func(doc *T) error {
+		results = append(results, doc)
+		return nil
+	}, opts...)
+	if err != nil {
 		return nil, err
 	}
 
+	err = ExecutePostHook(Aggregate, m, results)
+	if err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
+// AggregateEach runs the pipeline and streams every result document, decoded
+// into T, to fnc while iterating the cursor. Iteration stops at the first
+// error returned by fnc. Hooks and sanitization behave as in AggregateInto,
+// except that the post hook receives no results since they are not retained.
+func AggregateEach[T any, M any](m *Model[M], pipeline mongo.Pipeline, fnc func(doc *T) error, opts ...ReadOptions) error {
+	err := aggregateEach(m, pipeline, fnc, opts...)
+	if err != nil {
+		return err
+	}
+	return ExecutePostHook(Aggregate, m)
+}
+
+// aggregateEach executes the pre hook, sanitizes and runs the pipeline,
+// then decodes each result into T and passes it to fnc.
+func aggregateEach[T any, M any](m *Model[M], pipeline mongo.Pipeline, fnc func(doc *T) error, opts ...ReadOptions) error {
+	err := ExecutePreHook(Aggregate, m, pipeline)
+	if err != nil {
+		return err
+	}
+
+	if err := m.sanitizePipeline(pipeline); err != nil {
+		return err
+	}
+
+	var opt ReadOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	read := m.readOptions(opt)
+
+	collection, err := m.readCollection(read)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := collection.Aggregate(m.Ctx, pipeline, aggregateOptions(read))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(m.Ctx)
+
+	for cursor.Next(m.Ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fnc(&doc); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// FindOne returns the first document that matches the filter.
+// Without Ref the query runs as a native find command; with Ref it is
+// executed as an aggregation pipeline that populates the requested fields.
+// Paths with the PopulateBatch strategy are populated afterwards, with one
+// query per path through the model of the referenced collection.
+// With QueryOptions.Cache the result is read through the cache of the model.
+// If no document matches the filter, the function returns nil, nil.
 func (m *Model[M]) FindOne(filter interface{}, opts ...QueryOptions) (*M, error) {
 	err := ExecutePreHook(FindOne, m, filter)
 	if err != nil {
@@ -32,81 +119,82 @@ func (m *Model[M]) FindOne(filter interface{}, opts ...QueryOptions) (*M, error)
 		return nil, err
 	}
 
-	pipeline := []bson.M{}
-	// Filter by search
-
 	query, err := ToDoc(filter)
 	if err != nil {
 		return nil, err
 	}
-	aggSearch := bson.M{"$match": query}
-	pipeline = append(pipeline, aggSearch)
 
 	var opt QueryOptions
 	if len(opts) > 0 {
 		opt = opts[0]
 	}
 
-	if opt.Ref != nil {
-		for _, ref := range opt.Ref {
-			refPath := m.getRefPath(ref)
-			if refPath == nil {
-				continue // Skip invalid ref names
+	paths := populates(opt.Ref, opt.Populate)
+	var cache *CacheOptions
+	var cacheKey string
+	if opt.Cache && len(paths) == 0 {
+		cache = m.cache()
+	}
+	if cache != nil {
+		if cacheKey, err = m.cacheKey(cache, query, opt); err != nil {
+			cache = nil
+		} else if data, found := m.cachedFindOne(cache, cacheKey); found {
+			if data == nil {
+				return nil, nil
+			}
+			err = ExecutePostHook(FindOne, m, data)
+			if err != nil {
+				return nil, err
 			}
-			aggLookup := bson.M{"$lookup": bson.M{
-				"from":         refPath.From,
-				"localField":   refPath.ForeignKey,
-				"foreignField": "_id",
-				"as":           refPath.As,
-			}}
-			aggUnwind := bson.M{"$unwind": bson.M{
-				"path": fmt.Sprintf("$%s", refPath.As),
-			}}
-			pipeline = append(pipeline, aggLookup, aggUnwind)
+			return data, nil
 		}
 	}
 
-	if opt.Projection != nil {
-		pipeline = append(pipeline, bson.M{"$project": opt.Projection})
+	var data *M
+	lookups, batches, err := m.splitPopulates(paths)
+	if err != nil {
+		return nil, err
 	}
-
-	if opt.Sort != nil {
-		pipeline = append(pipeline, bson.M{"$sort": opt.Sort})
+	if len(lookups) == 0 {
+		data, err = m.findOne(query, opt)
+	} else {
+		data, err = m.findOneWithRef(query, lookups, opt)
 	}
-
-	pipeline = append(pipeline, bson.M{"$limit": 1})
-
-	cursor, err := m.Collection.Aggregate(m.Ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
 
-	var data []*M
-	for cursor.Next(m.Ctx) {
-		var t M
-		err := cursor.Decode(&t)
-		if err != nil {
-			return nil, err
-		}
-		data = append(data, &t)
+	if cache != nil {
+		m.setCachedFindOne(cache, cacheKey, data)
 	}
 
-	if err := cursor.Err(); err != nil {
-		return nil, err
+	if data == nil {
+		return nil, nil
 	}
-	cursor.Close(m.Ctx)
 
-	if len(data) == 0 {
-		return nil, nil
+	if len(batches) > 0 {
+		err = m.populateBatch([]*M{data}, batches)
+		if err != nil {
+			return nil, err
+		}
+		err = m.checkDanglingRefs([]*M{data}, batches, opt.StrictRefs, opt.OnDanglingRef)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = ExecutePostHook(FindOne, m, data[0])
+	err = ExecutePostHook(FindOne, m, data)
 	if err != nil {
 		return nil, err
 	}
-	return data[0], nil
+	return data, nil
 }
 
+// Find returns all documents that match the filter.
+// Without Ref the query runs as a native find command; with Ref it is
+// executed as an aggregation pipeline that populates the requested fields.
+// Paths with the PopulateBatch strategy are populated afterwards, with one
+// query per path through the model of the referenced collection.
 func (m *Model[M]) Find(filter interface{}, opts ...QueriesOptions) ([]*M, error) {
 	err := ExecutePreHook(Find, m, filter)
 	if err != nil {
@@ -117,40 +205,169 @@ func (m *Model[M]) Find(filter interface{}, opts ...QueriesOptions) ([]*M, error
 		return nil, err
 	}
 
-	pipeline := []bson.M{}
-	// Filter by search
-
 	query, err := ToDoc(filter)
 	if err != nil {
 		return nil, err
 	}
-	aggSearch := bson.M{"$match": query}
-	pipeline = append(pipeline, aggSearch)
 
 	var opt QueriesOptions
 	if len(opts) > 0 {
 		opt = opts[0]
 	}
 
-	if opt.Ref != nil {
-		for _, ref := range opt.Ref {
-			refPath := m.getRefPath(ref)
-			if refPath == nil {
-				continue // Skip invalid ref names
-			}
-			aggLookup := bson.M{"$lookup": bson.M{
-				"from":         refPath.From,
-				"localField":   refPath.ForeignKey,
-				"foreignField": "_id",
-				"as":           refPath.As,
-			}}
-			aggUnwind := bson.M{"$unwind": bson.M{
-				"path": fmt.Sprintf("$%s", refPath.As),
-			}}
-			pipeline = append(pipeline, aggLookup, aggUnwind)
+	var data []*M
+	lookups, batches, err := m.splitPopulates(populates(opt.Ref, opt.Populate))
+	if err != nil {
+		return nil, err
+	}
+	if len(lookups) == 0 {
+		data, err = m.find(query, opt)
+	} else {
+		data, err = m.findWithRef(query, lookups, opt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(batches) > 0 {
+		err = m.populateBatch(data, batches)
+		if err != nil {
+			return nil, err
+		}
+		err = m.checkDanglingRefs(data, batches, opt.StrictRefs, opt.OnDanglingRef)
+		if err != nil {
+			return nil, err
 		}
 	}
 
+	err = ExecutePostHook(Find, m, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// findOne runs a native find command of a single batch of one document,
+// like the findOne of the driver, which has no allowDiskUse.
+func (m *Model[M]) findOne(query *bson.D, opt QueryOptions) (*M, error) {
+	data, err := m.find(query, QueriesOptions{
+		ReadOptions: opt.ReadOptions,
+		Sort:        opt.Sort,
+		Projection:  opt.Projection,
+		Limit:       -1,
+		Min:         opt.Min,
+		Max:         opt.Max,
+		ReturnKey:   opt.ReturnKey,
+	})
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+// find runs a native find command with the given options.
+func (m *Model[M]) find(query *bson.D, opt QueriesOptions) ([]*M, error) {
+	read := m.readOptions(opt.ReadOptions)
+	collection, err := m.readCollection(read)
+	if err != nil {
+		return nil, err
+	}
+
+	findOpts := options.Find()
+	if opt.Sort != nil {
+		findOpts.SetSort(opt.Sort)
+	}
+	if opt.Projection != nil {
+		findOpts.SetProjection(opt.Projection)
+	}
+	if opt.Skip != 0 {
+		findOpts.SetSkip(opt.Skip)
+	}
+	if opt.Limit != 0 {
+		findOpts.SetLimit(opt.Limit)
+	}
+	if opt.Min != nil {
+		findOpts.SetMin(opt.Min)
+	}
+	if opt.Max != nil {
+		findOpts.SetMax(opt.Max)
+	}
+	if opt.ReturnKey {
+		findOpts.SetReturnKey(true)
+	}
+	if opt.CursorType != nil {
+		findOpts.SetCursorType(*opt.CursorType)
+	}
+	if read.Hint != nil {
+		findOpts.SetHint(read.Hint)
+	}
+	if read.Collation != nil {
+		findOpts.SetCollation(read.Collation)
+	}
+	if read.MaxTime != 0 {
+		findOpts.SetMaxTime(read.MaxTime)
+	}
+	if read.AllowDiskUse != nil {
+		findOpts.SetAllowDiskUse(*read.AllowDiskUse)
+	}
+	if read.Comment != "" {
+		findOpts.SetComment(read.Comment)
+	}
+	if read.BatchSize != 0 {
+		findOpts.SetBatchSize(read.BatchSize)
+	}
+
+	cursor, err := collection.Find(m.Ctx, query, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	return m.decodeCursor(cursor)
+}
+
+// findOneWithRef runs FindOne as an aggregation pipeline populating paths.
+func (m *Model[M]) findOneWithRef(query *bson.D, paths []Populate, opt QueryOptions) (*M, error) {
+	lookups, err := m.lookupStages(paths)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := []bson.M{{"$match": query}}
+	pipeline = append(pipeline, lookups...)
+
+	if opt.Projection != nil {
+		pipeline = append(pipeline, bson.M{"$project": opt.Projection})
+	}
+
+	if opt.Sort != nil {
+		pipeline = append(pipeline, bson.M{"$sort": opt.Sort})
+	}
+
+	pipeline = append(pipeline, bson.M{"$limit": 1})
+
+	data, err := m.aggregateModels(pipeline, opt.ReadOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	err = m.checkDanglingRefs(data, paths, opt.StrictRefs, opt.OnDanglingRef)
+	if err != nil {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+// findWithRef runs Find as an aggregation pipeline populating paths.
+func (m *Model[M]) findWithRef(query *bson.D, paths []Populate, opt QueriesOptions) ([]*M, error) {
+	lookups, err := m.lookupStages(paths)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := []bson.M{{"$match": query}}
+	pipeline = append(pipeline, lookups...)
+
 	if opt.Projection != nil {
 		pipeline = append(pipeline, bson.M{"$project": opt.Projection})
 	}
@@ -167,11 +384,37 @@ func (m *Model[M]) Find(filter interface{}, opts ...QueriesOptions) ([]*M, error
 		pipeline = append(pipeline, bson.M{"$limit": opt.Limit})
 	}
 
-	cursor, err := m.Collection.Aggregate(m.Ctx, pipeline)
+	data, err := m.aggregateModels(pipeline, opt.ReadOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.checkDanglingRefs(data, paths, opt.StrictRefs, opt.OnDanglingRef)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// aggregateModels runs the pipeline and decodes every result into M.
+func (m *Model[M]) aggregateModels(pipeline interface{}, opt ReadOptions) ([]*M, error) {
+	read := m.readOptions(opt)
+	collection, err := m.readCollection(read)
 	if err != nil {
 		return nil, err
 	}
 
+	cursor, err := collection.Aggregate(m.Ctx, pipeline, aggregateOptions(read))
+	if err != nil {
+		return nil, err
+	}
+	return m.decodeCursor(cursor)
+}
+
+// decodeCursor decodes every document of the cursor into M and closes it.
+func (m *Model[M]) decodeCursor(cursor *mongo.Cursor) ([]*M, error) {
+	defer cursor.Close(m.Ctx)
+
 	var data []*M
 	for cursor.Next(m.Ctx) {
 		var t M
@@ -185,23 +428,5 @@ func (m *Model[M]) Find(filter interface{}, opts ...QueriesOptions) ([]*M, error
 	if err := cursor.Err(); err != nil {
 		return nil, err
 	}
-	cursor.Close(m.Ctx)
-
-	err = ExecutePostHook(Find, m, data)
-	if err != nil {
-		return nil, err
-	}
 	return data, nil
 }
-
-type RefPath struct {
-	From       string
-	ForeignKey string
-	As         string
-}
-
-func (m *Model[M]) getRefPath(ref string) *RefPath {
-	// Use cached ref paths from type info
-	typeInfo := GetTypeInfo[M]()
-	return typeInfo.RefPaths[ref]
-}
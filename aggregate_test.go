@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -82,3 +83,539 @@ func TestFindOne(t *testing.T) {
 	require.Nil(t, err)
 	require.NotNil(t, employees)
 }
+
+type Skill struct {
+	BaseSchema `bson:"inline"`
+	Name       string `bson:"name"`
+}
+
+func (s Skill) CollectionName() string {
+	return "skills"
+}
+
+type Candidate struct {
+	BaseSchema `bson:"inline"`
+	Name       string               `bson:"name"`
+	SkillIDs   []primitive.ObjectID `bson:"skillIds"`
+	Skills     []*Skill             `bson:"skills,omitempty" ref:"skillIds->skills"`
+}
+
+func (c Candidate) CollectionName() string {
+	return "candidates"
+}
+
+func TestPopulateMany(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	skillModel := mongoose.NewModel[Skill]()
+	skillModel.SetConnect(connect)
+	candidateModel := mongoose.NewModel[Candidate]()
+	candidateModel.SetConnect(connect)
+
+	require.Nil(t, skillModel.DeleteMany(nil))
+	require.Nil(t, candidateModel.DeleteMany(nil))
+
+	skills := []*Skill{{Name: "go"}, {Name: "mongo"}, {Name: "sql"}}
+	_, err := skillModel.CreateMany(skills)
+	require.Nil(t, err)
+
+	missing := primitive.NewObjectID()
+	_, err = candidateModel.Create(&Candidate{
+		Name:     "Kafka",
+		SkillIDs: []primitive.ObjectID{skills[2].ID, missing, skills[0].ID, skills[1].ID},
+	})
+	require.Nil(t, err)
+	_, err = candidateModel.Create(&Candidate{Name: "Jing"})
+	require.Nil(t, err)
+
+	candidates, err := candidateModel.Find(nil, mongoose.QueriesOptions{
+		Ref:  []string{"skillIds"},
+		Sort: bson.D{{Key: "name", Value: -1}},
+	})
+	require.Nil(t, err)
+	require.Len(t, candidates, 2)
+
+	require.Len(t, candidates[0].Skills, 3)
+	assert.Equal(t, "sql", candidates[0].Skills[0].Name)
+	assert.Equal(t, "go", candidates[0].Skills[1].Name)
+	assert.Equal(t, "mongo", candidates[0].Skills[2].Name)
+	assert.Len(t, candidates[1].Skills, 0)
+
+	candidate, err := candidateModel.FindOne(bson.M{"name": "Kafka"}, mongoose.QueryOptions{
+		Ref: []string{"skillIds"},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, candidate)
+	assert.Len(t, candidate.Skills, 3)
+}
+
+func TestPopulatePreserveMissing(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	employeeModel := mongoose.NewModel[Employee]()
+	employeeModel.SetConnect(connect)
+	departmentModel := mongoose.NewModel[Department]()
+	departmentModel.SetConnect(connect)
+	candidateModel := mongoose.NewModel[Candidate]()
+	candidateModel.SetConnect(connect)
+
+	require.Nil(t, employeeModel.DeleteMany(nil))
+	require.Nil(t, departmentModel.DeleteMany(nil))
+	require.Nil(t, candidateModel.DeleteMany(nil))
+
+	_, err := departmentModel.Create(&Department{Name: "Finance"})
+	require.Nil(t, err)
+	department, err := departmentModel.FindOne(nil)
+	require.Nil(t, err)
+
+	dangling := primitive.NewObjectID()
+	_, err = employeeModel.CreateMany([]*Employee{
+		{Name: "a", DepartmentID: department.ID},
+		{Name: "b"},
+		{Name: "c", DepartmentID: dangling},
+	})
+	require.Nil(t, err)
+
+	var reported []mongoose.DanglingRef
+	employees, err := employeeModel.Find(nil, mongoose.QueriesOptions{
+		Ref:  []string{"departmentID"},
+		Sort: bson.D{{Key: "name", Value: 1}},
+		OnDanglingRef: func(ref mongoose.DanglingRef) {
+			reported = append(reported, ref)
+		},
+	})
+	require.Nil(t, err)
+	require.Len(t, employees, 3)
+	assert.NotNil(t, employees[0].Department)
+	assert.Nil(t, employees[1].Department)
+	assert.Nil(t, employees[2].Department)
+
+	require.Len(t, reported, 1)
+	assert.Equal(t, "departmentID", reported[0].Ref)
+	assert.Equal(t, dangling, reported[0].ID)
+	assert.Equal(t, employees[2], reported[0].Document)
+
+	_, err = employeeModel.Find(nil, mongoose.QueriesOptions{
+		Ref:        []string{"departmentID"},
+		StrictRefs: true,
+	})
+	var danglingErr *mongoose.ErrDanglingRef
+	assert.ErrorAs(t, err, &danglingErr)
+
+	employee, err := employeeModel.FindOne(bson.M{"name": "b"}, mongoose.QueryOptions{
+		Ref:        []string{"departmentID"},
+		StrictRefs: true,
+	})
+	require.Nil(t, err)
+	require.NotNil(t, employee)
+	assert.Nil(t, employee.Department)
+
+	// Array refs report each missing key
+	_, err = candidateModel.Create(&Candidate{
+		Name:     "Kafka",
+		SkillIDs: []primitive.ObjectID{dangling},
+	})
+	require.Nil(t, err)
+	reported = nil
+	candidate, err := candidateModel.FindOne(nil, mongoose.QueryOptions{
+		Ref: []string{"skillIds"},
+		OnDanglingRef: func(ref mongoose.DanglingRef) {
+			reported = append(reported, ref)
+		},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, candidate)
+	assert.Len(t, candidate.Skills, 0)
+	require.Len(t, reported, 1)
+	assert.Equal(t, dangling, reported[0].ID)
+}
+
+type Company struct {
+	BaseSchema `bson:"inline"`
+	Name       string `bson:"name"`
+	TaxCode    string `bson:"taxCode" mongoose:"hidden"`
+}
+
+func (c Company) CollectionName() string {
+	return "companies"
+}
+
+type Writer struct {
+	BaseSchema `bson:"inline"`
+	Name       string             `bson:"name"`
+	CompanyID  primitive.ObjectID `bson:"companyId"`
+	Company    *Company           `bson:"company,omitempty" ref:"companyId->companies"`
+	MentorID   primitive.ObjectID `bson:"mentorId,omitempty"`
+	Mentor     *Writer            `bson:"mentor,omitempty" ref:"mentorId->writers"`
+	Articles   []*Article         `bson:"articles,omitempty" virtual:"_id->articles.authorId"`
+	Latest     *Article           `bson:"latest,omitempty" virtual:"_id->articles.authorId"`
+	Published  int                `bson:"published,omitempty" virtual:"_id->articles.authorId,count"`
+}
+
+func (w Writer) CollectionName() string {
+	return "writers"
+}
+
+type ArticleMeta struct {
+	ReviewerID primitive.ObjectID `bson:"reviewerId"`
+	Reviewer   *Writer            `bson:"reviewer,omitempty" ref:"reviewerId->writers"`
+}
+
+type Citation struct {
+	WriterID primitive.ObjectID `bson:"writerId"`
+	Writer   *Writer            `bson:"writer,omitempty" ref:"writerId->writers"`
+}
+
+type Article struct {
+	BaseSchema `bson:"inline"`
+	Title      string             `bson:"title"`
+	AuthorID   primitive.ObjectID `bson:"authorId"`
+	Author     *Writer            `bson:"author,omitempty" ref:"authorId->writers"`
+	Meta       ArticleMeta        `bson:"meta"`
+	Citations  []Citation         `bson:"citations"`
+}
+
+func (a Article) CollectionName() string {
+	return "articles"
+}
+
+func TestPopulateNested(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	companyModel := mongoose.NewModel[Company]()
+	companyModel.SetConnect(connect)
+	writerModel := mongoose.NewModel[Writer]()
+	writerModel.SetConnect(connect)
+	articleModel := mongoose.NewModel[Article]()
+	articleModel.SetConnect(connect)
+
+	require.Nil(t, companyModel.DeleteMany(nil))
+	require.Nil(t, writerModel.DeleteMany(nil))
+	require.Nil(t, articleModel.DeleteMany(nil))
+
+	company := &Company{Name: "Tinh Tinh", TaxCode: "secret"}
+	_, err := companyModel.Create(company)
+	require.Nil(t, err)
+
+	mentor := &Writer{Name: "Mentor", CompanyID: company.ID}
+	_, err = writerModel.Create(mentor)
+	require.Nil(t, err)
+	author := &Writer{Name: "Author", CompanyID: company.ID, MentorID: mentor.ID}
+	_, err = writerModel.Create(author)
+	require.Nil(t, err)
+
+	_, err = articleModel.Create(&Article{
+		Title:     "Nested",
+		AuthorID:  author.ID,
+		Meta:      ArticleMeta{ReviewerID: mentor.ID},
+		Citations: []Citation{{WriterID: mentor.ID}, {WriterID: author.ID}},
+	})
+	require.Nil(t, err)
+	_, err = articleModel.Create(&Article{Title: "Orphan"})
+	require.Nil(t, err)
+
+	articles, err := articleModel.Find(nil, mongoose.QueriesOptions{
+		Ref:  []string{"author.company", "author.mentor", "meta.reviewer", "citations.writer"},
+		Sort: bson.D{{Key: "title", Value: 1}},
+	})
+	require.Nil(t, err)
+	require.Len(t, articles, 2)
+
+	article := articles[0]
+	require.NotNil(t, article.Author)
+	assert.Equal(t, "Author", article.Author.Name)
+	require.NotNil(t, article.Author.Company)
+	assert.Equal(t, "Tinh Tinh", article.Author.Company.Name)
+	assert.Equal(t, "", article.Author.Company.TaxCode)
+	require.NotNil(t, article.Author.Mentor)
+	assert.Equal(t, "Mentor", article.Author.Mentor.Name)
+	require.NotNil(t, article.Meta.Reviewer)
+	assert.Equal(t, "Mentor", article.Meta.Reviewer.Name)
+	require.Len(t, article.Citations, 2)
+	require.NotNil(t, article.Citations[1].Writer)
+	assert.Equal(t, "Author", article.Citations[1].Writer.Name)
+
+	// Missing refs stay nil instead of becoming empty documents
+	assert.Nil(t, articles[1].Author)
+}
+
+func TestPopulateCycleAndDepth(t *testing.T) {
+	writerModel := mongoose.NewModel[Writer]()
+
+	_, err := writerModel.Find(nil, mongoose.QueriesOptions{
+		Ref: []string{"mentor.mentor"},
+	})
+	var cycleErr *mongoose.ErrPopulateCycle
+	assert.ErrorAs(t, err, &cycleErr)
+
+	articleModel := mongoose.NewModel[Article](mongoose.ModelOptions{
+		ID:               true,
+		Timestamp:        true,
+		MaxPopulateDepth: 1,
+	})
+	_, err = articleModel.FindOne(nil, mongoose.QueryOptions{
+		Ref: []string{"author.company"},
+	})
+	var depthErr *mongoose.ErrPopulateDepth
+	assert.ErrorAs(t, err, &depthErr)
+}
+
+func TestPopulateOptions(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	skillModel := mongoose.NewModel[Skill]()
+	skillModel.SetConnect(connect)
+	candidateModel := mongoose.NewModel[Candidate]()
+	candidateModel.SetConnect(connect)
+
+	require.Nil(t, skillModel.DeleteMany(nil))
+	require.Nil(t, candidateModel.DeleteMany(nil))
+
+	skills := []*Skill{{Name: "go"}, {Name: "mongo"}, {Name: "sql"}, {Name: "rust"}}
+	_, err := skillModel.CreateMany(skills)
+	require.Nil(t, err)
+
+	_, err = candidateModel.Create(&Candidate{
+		Name:     "Kafka",
+		SkillIDs: []primitive.ObjectID{skills[0].ID, skills[1].ID, skills[2].ID, skills[3].ID},
+	})
+	require.Nil(t, err)
+
+	candidate, err := candidateModel.FindOne(nil, mongoose.QueryOptions{
+		Populate: []mongoose.Populate{{
+			Path:   "skills",
+			Select: bson.D{{Key: "name", Value: 1}},
+			Match:  bson.M{"name": bson.M{"$ne": "sql"}},
+			Sort:   bson.D{{Key: "name", Value: -1}},
+			Limit:  2,
+		}},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, candidate)
+	require.Len(t, candidate.Skills, 2)
+	assert.Equal(t, "rust", candidate.Skills[0].Name)
+	assert.Equal(t, "mongo", candidate.Skills[1].Name)
+	assert.True(t, candidate.Skills[0].CreatedAt.IsZero())
+
+	// Ref and Populate can be combined, filtered refs are not dangling
+	candidates, err := candidateModel.Find(nil, mongoose.QueriesOptions{
+		Populate: []mongoose.Populate{{
+			Path:  "skillIds",
+			Match: bson.M{"name": "go"},
+		}},
+		StrictRefs: true,
+	})
+	require.Nil(t, err)
+	require.Len(t, candidates, 1)
+	require.Len(t, candidates[0].Skills, 1)
+	assert.Equal(t, "go", candidates[0].Skills[0].Name)
+}
+
+func TestPopulateVirtual(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	writerModel := mongoose.NewModel[Writer]()
+	writerModel.SetConnect(connect)
+	articleModel := mongoose.NewModel[Article]()
+	articleModel.SetConnect(connect)
+
+	require.Nil(t, writerModel.DeleteMany(nil))
+	require.Nil(t, articleModel.DeleteMany(nil))
+
+	author := &Writer{Name: "Author"}
+	_, err := writerModel.Create(author)
+	require.Nil(t, err)
+	_, err = writerModel.Create(&Writer{Name: "Idle"})
+	require.Nil(t, err)
+
+	_, err = articleModel.CreateMany([]*Article{
+		{Title: "b", AuthorID: author.ID},
+		{Title: "a", AuthorID: author.ID},
+		{Title: "c", AuthorID: author.ID},
+	})
+	require.Nil(t, err)
+
+	writers, err := writerModel.Find(nil, mongoose.QueriesOptions{
+		Ref: []string{"published"},
+		Populate: []mongoose.Populate{
+			{Path: "articles", Sort: bson.D{{Key: "title", Value: 1}}, Limit: 2, Select: bson.D{{Key: "title", Value: 1}}},
+			{Path: "latest", Sort: bson.D{{Key: "title", Value: -1}}, Limit: 1},
+		},
+		Sort: bson.D{{Key: "name", Value: 1}},
+	})
+	require.Nil(t, err)
+	require.Len(t, writers, 2)
+
+	assert.Equal(t, 3, writers[0].Published)
+	require.Len(t, writers[0].Articles, 2)
+	assert.Equal(t, "a", writers[0].Articles[0].Title)
+	assert.Equal(t, "b", writers[0].Articles[1].Title)
+	require.NotNil(t, writers[0].Latest)
+	assert.Equal(t, "c", writers[0].Latest.Title)
+
+	assert.Equal(t, 0, writers[1].Published)
+	assert.Len(t, writers[1].Articles, 0)
+	assert.Nil(t, writers[1].Latest)
+
+	// Virtuals can be followed by refs of the children
+	writer, err := writerModel.FindOne(bson.M{"name": "Author"}, mongoose.QueryOptions{
+		Ref: []string{"articles.author"},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, writer)
+	require.Len(t, writer.Articles, 3)
+	require.NotNil(t, writer.Articles[0].Author)
+	assert.Equal(t, "Author", writer.Articles[0].Author.Name)
+}
+
+func TestPopulateBatch(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	other := mongoose.New(os.Getenv("MONGO_URI"))
+	other.SetDB("test_skills")
+
+	skillModel := mongoose.NewModel[Skill]()
+	skillModel.SetConnect(other)
+	candidateModel := mongoose.NewModel[Candidate](mongoose.ModelOptions{
+		ID:               true,
+		Timestamp:        true,
+		PopulateStrategy: mongoose.PopulateBatch,
+	})
+	candidateModel.SetConnect(connect)
+
+	require.Nil(t, skillModel.DeleteMany(nil))
+	require.Nil(t, candidateModel.DeleteMany(nil))
+
+	skills := []*Skill{{Name: "go"}, {Name: "mongo"}, {Name: "sql"}}
+	_, err := skillModel.CreateMany(skills)
+	require.Nil(t, err)
+
+	missing := primitive.NewObjectID()
+	_, err = candidateModel.Create(&Candidate{
+		Name:     "Kafka",
+		SkillIDs: []primitive.ObjectID{skills[2].ID, missing, skills[0].ID, skills[1].ID},
+	})
+	require.Nil(t, err)
+	_, err = candidateModel.Create(&Candidate{Name: "Jing", SkillIDs: []primitive.ObjectID{skills[0].ID}})
+	require.Nil(t, err)
+
+	// The skills live in another database, reached through their model
+	candidates, err := candidateModel.Find(nil, mongoose.QueriesOptions{
+		Populate: []mongoose.Populate{{Path: "skillIds", Model: skillModel}},
+		Sort:     bson.D{{Key: "name", Value: -1}},
+	})
+	require.Nil(t, err)
+	require.Len(t, candidates, 2)
+	require.Len(t, candidates[0].Skills, 3)
+	assert.Equal(t, "sql", candidates[0].Skills[0].Name)
+	assert.Equal(t, "go", candidates[0].Skills[1].Name)
+	assert.Equal(t, "mongo", candidates[0].Skills[2].Name)
+	require.Len(t, candidates[1].Skills, 1)
+	assert.Equal(t, "go", candidates[1].Skills[0].Name)
+
+	candidates, err = candidateModel.Find(nil, mongoose.QueriesOptions{
+		Populate:   []mongoose.Populate{{Path: "skillIds", Model: skillModel}},
+		StrictRefs: true,
+	})
+	require.NotNil(t, err)
+	assert.Nil(t, candidates)
+
+	// Without a model the registered one of the connection is used
+	_, err = candidateModel.Find(nil, mongoose.QueriesOptions{Ref: []string{"skillIds"}})
+	assert.IsType(t, &mongoose.ErrModelNotRegistered{}, err)
+
+	writerModel := mongoose.NewModel[Writer]()
+	writerModel.SetConnect(connect)
+	articleModel := mongoose.NewModel[Article]()
+	articleModel.SetConnect(connect)
+
+	require.Nil(t, writerModel.DeleteMany(nil))
+	require.Nil(t, articleModel.DeleteMany(nil))
+
+	author := &Writer{Name: "Author"}
+	_, err = writerModel.Create(author)
+	require.Nil(t, err)
+	_, err = articleModel.CreateMany([]*Article{
+		{Title: "b", AuthorID: author.ID},
+		{Title: "a", AuthorID: author.ID},
+		{Title: "c", AuthorID: author.ID},
+	})
+	require.Nil(t, err)
+
+	writer, err := writerModel.FindOne(bson.M{"name": "Author"}, mongoose.QueryOptions{
+		Populate: []mongoose.Populate{
+			{Path: "articles.author", Strategy: mongoose.PopulateBatch},
+			{Path: "latest", Strategy: mongoose.PopulateBatch, Sort: bson.D{{Key: "title", Value: -1}}, Limit: 1},
+		},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, writer)
+	require.Len(t, writer.Articles, 3)
+	require.NotNil(t, writer.Articles[0].Author)
+	assert.Equal(t, "Author", writer.Articles[0].Author.Name)
+	require.NotNil(t, writer.Latest)
+	assert.Equal(t, "c", writer.Latest.Title)
+}
+
+func TestPopulateBatch_Filters(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	companyModel := mongoose.NewModel[Company](mongoose.ModelOptions{ID: true, Timestamp: true, StrictFilters: true})
+	companyModel.SetConnect(connect)
+	writerModel := mongoose.NewModel[Writer](mongoose.ModelOptions{ID: true, Timestamp: true, PopulateStrategy: mongoose.PopulateBatch})
+	writerModel.SetConnect(connect)
+	require.Nil(t, companyModel.DeleteMany(nil))
+	require.Nil(t, writerModel.DeleteMany(nil))
+
+	company := &Company{Name: "Tinh Tinh", TaxCode: "secret"}
+	_, err := companyModel.Create(company)
+	require.Nil(t, err)
+	_, err = writerModel.Create(&Writer{Name: "Writer", CompanyID: company.ID})
+	require.Nil(t, err)
+
+	// Selected hidden fields are left out
+	writer, err := writerModel.FindOne(bson.M{"name": "Writer"}, mongoose.QueryOptions{
+		Populate: []mongoose.Populate{{Path: "companyId", Select: bson.D{{Key: "name", Value: 1}, {Key: "taxCode", Value: 1}}}},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, writer.Company)
+	assert.Equal(t, "Tinh Tinh", writer.Company.Name)
+	assert.Empty(t, writer.Company.TaxCode)
+
+	// Match is checked like the filters of the model
+	_, err = writerModel.FindOne(bson.M{"name": "Writer"}, mongoose.QueryOptions{
+		Populate: []mongoose.Populate{{Path: "companyId", Match: bson.M{"$where": "true"}}},
+	})
+	require.NotNil(t, err)
+
+	// Find hooks of the referenced model filter the loaded documents
+	companyModel.Pre(mongoose.Find, func(params ...any) error {
+		params[0].(bson.M)["name"] = bson.M{"$ne": "Tinh Tinh"}
+		return nil
+	})
+	writer, err = writerModel.FindOne(bson.M{"name": "Writer"}, mongoose.QueryOptions{Ref: []string{"companyId"}})
+	require.Nil(t, err)
+	assert.Nil(t, writer.Company)
+}
+
+func TestPopulate_StrictMatch(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	writerModel := mongoose.NewModel[Writer](mongoose.ModelOptions{ID: true, Timestamp: true, StrictFilters: true})
+	writerModel.SetConnect(connect)
+
+	// Match is checked like the filters of the model, before the query
+	for _, strategy := range []mongoose.PopulateStrategy{mongoose.PopulateLookup, mongoose.PopulateBatch} {
+		_, err := writerModel.Find(nil, mongoose.QueriesOptions{
+			Populate: []mongoose.Populate{{Path: "companyId", Strategy: strategy, Match: bson.M{"$where": "true"}}},
+		})
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,226 @@
+package mongoose
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultAuditCollection is the collection of the model database holding
+// the audit entries of every audited model.
+const DefaultAuditCollection = "mongoose_audit"
+
+// ErrNotAudited is returned by History for a model without Audit.
+var ErrNotAudited = errors.New("model is not audited")
+
+// AuditEntry is a change of a document recorded by Audit.
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Collection string             `bson:"collection"`
+	Operation  HookName           `bson:"operation"`
+	DocumentID interface{}        `bson:"documentId"`
+	Before     bson.Raw           `bson:"before,omitempty"`
+	After      bson.Raw           `bson:"after,omitempty"`
+	Diff       []FieldChange      `bson:"diff,omitempty"`
+	Actor      string             `bson:"actor,omitempty"`
+	RequestID  string             `bson:"requestId,omitempty"`
+	At         time.Time          `bson:"at"`
+}
+
+// FieldChange is a top-level field changed by an update. Before or After
+// is missing when the field was added or removed.
+type FieldChange struct {
+	Field  string      `bson:"field"`
+	Before interface{} `bson:"before,omitempty"`
+	After  interface{} `bson:"after,omitempty"`
+}
+
+type AuditOptions struct {
+	Collection string // DefaultAuditCollection when empty
+	// Diff records the changed fields of updates instead of the documents
+	// before and after. Creates keep After and deletes keep Before.
+	Diff      bool
+	Actor     func(ctx context.Context) string // ActorFrom when nil
+	RequestID func(ctx context.Context) string // RequestIDFrom when nil
+}
+
+type auditor struct {
+	opt AuditOptions
+}
+
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+// WithActor returns a copy of ctx recording actor as the author of the
+// changes audited with it, e.g. model.WithContext(WithActor(ctx, user)).
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of ctx set by WithActor, or "".
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// WithRequestID returns a copy of ctx recording id as the request of the
+// changes audited with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request id of ctx set by WithRequestID, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Audit records every write of the model in the audit collection, one
+// entry per written document: creates, updates, deletes and FindOneAnd*,
+// Save, Bulk, SyncBy, Import, fixtures and the SetNull actions of refs.
+// Writes made on Collection directly are not recorded. Entries are
+// recorded right after the write, with the context of the model running
+// it, so a failed record fails the write after it was made.
+func (m *Model[M]) Audit(opts ...AuditOptions) {
+	var opt AuditOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Collection == "" {
+		opt.Collection = DefaultAuditCollection
+	}
+	if opt.Actor == nil {
+		opt.Actor = ActorFrom
+	}
+	if opt.RequestID == nil {
+		opt.RequestID = RequestIDFrom
+	}
+
+	m.audit = &auditor{opt: opt}
+	m.trackers = append(m.trackers, m.record)
+	if m.connect != nil {
+		m.createAuditIndex()
+	}
+}
+
+// createAuditIndex creates the index of the audit collection of the
+// connection, when Audit is called and on SetConnect. It runs with the
+// context of the connection, as indexes cannot be created in the
+// transaction of a write.
+func (m *Model[M]) createAuditIndex() {
+	collection := m.connect.Client.Database(m.connect.DB).Collection(m.audit.opt.Collection)
+	_, err := collection.Indexes().CreateOne(m.connect.Ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "collection", Value: 1}, {Key: "documentId", Value: 1}, {Key: "at", Value: 1}},
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// auditCollection returns the audit collection.
+func (m *Model[M]) auditCollection() (*mongo.Collection, error) {
+	if m.audit == nil {
+		return nil, ErrNotAudited
+	}
+	return m.connect.Client.Database(m.connect.DB).Collection(m.audit.opt.Collection), nil
+}
+
+// record inserts the audit entries of changes.
+func (m *Model[M]) record(ctx context.Context, name HookName, changes []Change) error {
+	collection, err := m.auditCollection()
+	if err != nil {
+		return err
+	}
+
+	opt := m.audit.opt
+	now := time.Now()
+	entries := make([]interface{}, 0, len(changes))
+	for _, change := range changes {
+		entry := AuditEntry{
+			Collection: m.GetName(),
+			Operation:  name,
+			DocumentID: change.ID,
+			Before:     change.Before,
+			After:      change.After,
+			Actor:      opt.Actor(ctx),
+			RequestID:  opt.RequestID(ctx),
+			At:         now,
+		}
+		if opt.Diff && change.Before != nil && change.After != nil {
+			entry.Diff, err = diff(change.Before, change.After)
+			if err != nil {
+				return err
+			}
+			entry.Before, entry.After = nil, nil
+		}
+		entries = append(entries, entry)
+	}
+	_, err = collection.InsertMany(ctx, entries)
+	return err
+}
+
+// diff returns the top-level fields changed between before and after.
+func diff(before, after bson.Raw) ([]FieldChange, error) {
+	var changes []FieldChange
+	beforeFields, err := before.Elements()
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := after.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(beforeFields))
+	for _, field := range beforeFields {
+		key := field.Key()
+		seen[key] = true
+		change := FieldChange{Field: key, Before: field.Value()}
+		value, err := after.LookupErr(key)
+		if err == nil {
+			if value.Equal(field.Value()) {
+				continue
+			}
+			change.After = value
+		}
+		changes = append(changes, change)
+	}
+	for _, field := range afterFields {
+		if !seen[field.Key()] {
+			changes = append(changes, FieldChange{Field: field.Key(), After: field.Value()})
+		}
+	}
+	return changes, nil
+}
+
+// History returns the audit entries of the document of id, oldest first.
+func (m *Model[M]) History(id interface{}) ([]AuditEntry, error) {
+	collection, err := m.auditCollection()
+	if err != nil {
+		return nil, err
+	}
+	query, err := m.getQueryId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(m.Ctx, bson.M{
+		"collection": m.GetName(),
+		"documentId": query["_id"],
+	}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	entries := []AuditEntry{}
+	if err := cursor.All(m.Ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,257 @@
+package mongoose_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Invoice struct {
+	BaseSchema `bson:"inline"`
+	Number     string `bson:"number"`
+	Status     string `bson:"status"`
+	Amount     int    `bson:"amount"`
+}
+
+func (i Invoice) CollectionName() string {
+	return "invoices"
+}
+
+func TestAudit(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	_, err := connect.Client.Database("test").Collection(mongoose.DefaultAuditCollection).DeleteMany(connect.Ctx, bson.M{})
+	require.Nil(t, err)
+
+	shared := mongoose.NewModel[Invoice]()
+	shared.Audit()
+	shared.SetConnect(connect)
+	require.Nil(t, shared.DeleteMany(nil))
+	model := shared.WithContext(mongoose.WithRequestID(mongoose.WithActor(context.Background(), "alice"), "req-1"))
+
+	first := &Invoice{Number: "F-1", Status: "draft", Amount: 100}
+	second := &Invoice{Number: "F-2", Status: "draft", Amount: 200}
+	_, err = model.CreateMany([]*Invoice{first, second})
+	require.Nil(t, err)
+
+	err = model.Update(bson.M{"number": "F-1"}, &Invoice{Status: "sent"})
+	require.Nil(t, err)
+	// One entry per affected document
+	err = model.UpdateMany(bson.M{"status": bson.M{"$in": bson.A{"draft", "sent"}}}, &Invoice{Amount: 300})
+	require.Nil(t, err)
+	_, err = model.FindOneAndUpdate(bson.M{"number": "F-2"}, &Invoice{Status: "paid"})
+	require.Nil(t, err)
+	_, err = model.FindOneAndDelete(bson.M{"number": "F-2"})
+	require.Nil(t, err)
+
+	history, err := model.History(first.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 3)
+	require.Equal(t, mongoose.CreateMany, history[0].Operation)
+	require.Nil(t, history[0].Before)
+	require.Equal(t, mongoose.Update, history[1].Operation)
+	require.Equal(t, "alice", history[1].Actor)
+	require.Equal(t, "req-1", history[1].RequestID)
+	require.Equal(t, "draft", history[1].Before.Lookup("status").StringValue())
+	require.Equal(t, "sent", history[1].After.Lookup("status").StringValue())
+	require.Equal(t, mongoose.UpdateMany, history[2].Operation)
+
+	history, err = model.History(second.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 4)
+	require.Equal(t, mongoose.FindOneAndUpdate, history[2].Operation)
+	require.Equal(t, "paid", history[2].After.Lookup("status").StringValue())
+	require.Equal(t, mongoose.FindOneAndDelete, history[3].Operation)
+	require.Nil(t, history[3].After)
+
+	unaudited := mongoose.NewModel[Task]()
+	unaudited.SetConnect(connect)
+	_, err = unaudited.History(first.ID)
+	require.ErrorIs(t, err, mongoose.ErrNotAudited)
+}
+
+func TestAudit_Diff(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Invoice]()
+	model.Audit(mongoose.AuditOptions{Collection: "invoice_audit", Diff: true})
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	invoice := &Invoice{Number: "F-3", Status: "draft", Amount: 100}
+	_, err := model.Create(invoice)
+	require.Nil(t, err)
+	err = model.UpdateByID(invoice.ID, &Invoice{Status: "sent"})
+	require.Nil(t, err)
+
+	history, err := model.History(invoice.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 2)
+	require.Nil(t, history[1].Before)
+	fields := map[string]mongoose.FieldChange{}
+	for _, change := range history[1].Diff {
+		fields[change.Field] = change
+	}
+	require.Contains(t, fields, "updatedAt")
+	require.Equal(t, "draft", fields["status"].Before)
+	require.Equal(t, "sent", fields["status"].After)
+	require.NotContains(t, fields, "amount")
+}
+
+func TestAudit_Coverage(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	shared := mongoose.NewModel[Invoice]()
+	shared.Audit(mongoose.AuditOptions{Collection: "invoice_audit_coverage"})
+	shared.SetConnect(connect)
+	require.Nil(t, shared.DeleteMany(nil))
+	_, err := connect.Client.Database("test").Collection("invoice_audit_coverage").DeleteMany(connect.Ctx, bson.M{})
+	require.Nil(t, err)
+
+	// Concurrent requests keep their own actor
+	var wg sync.WaitGroup
+	for _, actor := range []string{"alice", "bob", "carol"} {
+		wg.Add(1)
+		go func(actor string) {
+			defer wg.Done()
+			model := shared.WithContext(mongoose.WithActor(context.Background(), actor))
+			invoice := &Invoice{Number: actor, Status: "draft"}
+			_, err := model.Create(invoice)
+			require.Nil(t, err)
+			history, err := model.History(invoice.ID)
+			require.Nil(t, err)
+			require.Len(t, history, 1)
+			require.Equal(t, actor, history[0].Actor)
+		}(actor)
+	}
+	wg.Wait()
+
+	// Bulk
+	bulkInvoice := &Invoice{Number: "B-1", Status: "draft"}
+	_, err = shared.Bulk().
+		Insert(bulkInvoice).
+		UpdateOne(bson.M{"number": "alice"}, &Invoice{Status: "sent"}).
+		Exec(true)
+	require.Nil(t, err)
+	alice, err := shared.FindOne(bson.M{"number": "alice"})
+	require.Nil(t, err)
+	history, err := shared.History(alice.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, mongoose.BulkWrite, history[1].Operation)
+	history, err = shared.History(bulkInvoice.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 1)
+
+	// SyncBy
+	_, err = shared.SyncBy([]string{"number"}, []*Invoice{{Number: "bob", Status: "paid"}, {Number: "S-1", Status: "draft"}})
+	require.Nil(t, err)
+	bob, err := shared.FindOne(bson.M{"number": "bob"})
+	require.Nil(t, err)
+	history, err = shared.History(bob.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "paid", history[1].After.Lookup("status").StringValue())
+	synced, err := shared.FindOne(bson.M{"number": "S-1"})
+	require.Nil(t, err)
+	history, err = shared.History(synced.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 1)
+	require.Nil(t, history[0].Before)
+
+	// Import
+	id := primitive.NewObjectID()
+	_, err = shared.Import(strings.NewReader(`{"_id": {"$oid": "`+id.Hex()+`"}, "number": "I-1", "status": "draft"}`), mongoose.FormatNDJSON)
+	require.Nil(t, err)
+	history, err = shared.History(id)
+	require.Nil(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, mongoose.CreateMany, history[0].Operation)
+
+	// Save
+	saved := mongoose.NewModel[Invoice]()
+	saved.Audit(mongoose.AuditOptions{Collection: "invoice_audit_coverage"})
+	saved.SetConnect(connect)
+	saved.Set(&struct {
+		ID     primitive.ObjectID
+		Status string
+	}{ID: id, Status: "sent"})
+	require.Nil(t, saved.Save())
+	history, err = shared.History(id)
+	require.Nil(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, mongoose.Save, history[1].Operation)
+}
+
+func TestAudit_IndexOnSetConnect(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	audit := connect.Client.Database("test").Collection("invoices_audit")
+	require.Nil(t, audit.Drop(connect.Ctx))
+
+	model := mongoose.NewModel[Invoice](mongoose.ModelOptions{TransactionalDeletes: true})
+	model.Audit(mongoose.AuditOptions{Collection: "invoices_audit"})
+	model.SetConnect(connect)
+
+	cursor, err := audit.Indexes().List(connect.Ctx)
+	require.Nil(t, err)
+	var indexes []bson.M
+	require.Nil(t, cursor.All(connect.Ctx, &indexes))
+	require.Len(t, indexes, 2)
+
+	// Deletes record their entries in the transaction of the delete
+	invoice := &Invoice{Number: "I-1"}
+	_, err = model.Create(invoice)
+	require.Nil(t, err)
+	require.Nil(t, model.DeleteByID(invoice.ID))
+	history, err := model.History(invoice.ID)
+	require.Nil(t, err)
+	require.Len(t, history, 2)
+}
+
+func TestAudit_Batches(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	audit := connect.Client.Database("test").Collection("invoices_batch_audit")
+	_, err := audit.DeleteMany(connect.Ctx, bson.M{})
+	require.Nil(t, err)
+
+	model := mongoose.NewModel[Invoice](mongoose.ModelOptions{TrackBatchSize: 2})
+	model.Audit(mongoose.AuditOptions{Collection: "invoices_batch_audit"})
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+	_, err = audit.DeleteMany(connect.Ctx, bson.M{})
+	require.Nil(t, err)
+
+	invoices := []*Invoice{}
+	for i := 0; i < 5; i++ {
+		invoices = append(invoices, &Invoice{Number: "B-" + strings.Repeat("1", i+1), Status: "draft"})
+	}
+	_, err = model.CreateMany(invoices)
+	require.Nil(t, err)
+
+	// Updated and deleted by batches of two documents
+	require.Nil(t, model.UpdateMany(bson.M{"status": "draft"}, &Invoice{Status: "sent"}))
+	count, err := model.Count(bson.M{"status": "sent"})
+	require.Nil(t, err)
+	require.Equal(t, int64(5), count)
+	require.Nil(t, model.DeleteMany(bson.M{"status": "sent"}))
+	count, err = model.Count(nil)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), count)
+
+	for _, operation := range []mongoose.HookName{mongoose.UpdateMany, mongoose.DeleteMany} {
+		entries, err := audit.CountDocuments(connect.Ctx, bson.M{"operation": operation})
+		require.Nil(t, err)
+		require.Equal(t, int64(5), entries)
+	}
+}
@@ -0,0 +1,384 @@
+package mongoose
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PopulateStrategy selects how a ref is populated.
+type PopulateStrategy int
+
+const (
+	// PopulateDefault uses the PopulateStrategy of the model, PopulateLookup when unset.
+	PopulateDefault PopulateStrategy = iota
+	// PopulateLookup populates with $lookup stages in the same aggregation.
+	PopulateLookup
+	// PopulateBatch runs the query first, then loads the referenced documents
+	// with one $in query through their own Model and stitches them in.
+	// It reaches collections on other connections or databases, and applies
+	// the hooks of the referenced model.
+	PopulateBatch
+)
+
+// ErrModelNotRegistered is returned when a batched ref has no Model to load
+// the referenced documents with.
+type ErrModelNotRegistered struct {
+	Collection string
+}
+
+func (e *ErrModelNotRegistered) Error() string {
+	return fmt.Sprintf("no model registered for collection %s, set Populate.Model", e.Collection)
+}
+
+// batchLoader is implemented by Model[M] to load referenced documents for
+// batched population.
+type batchLoader interface {
+	loadBatch(field string, values []interface{}, opt Populate) (reflect.Value, error)
+}
+
+// splitPopulates separates the paths populated by $lookup from the paths
+// populated by batched queries. Batched paths must start with a ref of M
+// that can be stitched; count virtuals and in place refs use $lookup.
+// Match of batched paths is checked like the filters of the model, before
+// the query, then by the referenced model.
+func (m *Model[M]) splitPopulates(paths []Populate) (lookups []Populate, batches []Populate, err error) {
+	for _, path := range paths {
+		strategy := path.Strategy
+		if strategy == PopulateDefault {
+			strategy = m.option.PopulateStrategy
+		}
+		if strategy != PopulateBatch {
+			lookups = append(lookups, path)
+			continue
+		}
+
+		root, _, _ := strings.Cut(path.Path, ".")
+		refPath := m.getRefPath(root)
+		if refPath == nil || refPath.Count || refPath.As == refPath.ForeignKey || refPath.Type == nil {
+			lookups = append(lookups, path)
+			continue
+		}
+		if err := m.sanitizeFilter(path.Match); err != nil {
+			return nil, nil, err
+		}
+		batches = append(batches, path)
+	}
+	return lookups, batches, nil
+}
+
+// populateBatch populates the batched paths of data. The referenced
+// documents of each path are loaded with one query through the Model
+// of the referenced collection, the rest of the path is populated by that
+// model.
+func (m *Model[M]) populateBatch(data []*M, paths []Populate) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	typeInfo := GetTypeInfo[M]()
+	for _, path := range paths {
+		root, rest, _ := strings.Cut(path.Path, ".")
+		refPath := m.getRefPath(root)
+		keyField := typeInfo.FieldsByBson[refPath.ForeignKey]
+		asField := typeInfo.FieldsByBson[refPath.As]
+		if keyField == nil || asField == nil {
+			continue
+		}
+
+		loader, err := m.refLoader(refPath, path.Model)
+		if err != nil {
+			return err
+		}
+
+		// Collect the distinct keys of every document
+		var values []interface{}
+		seen := map[interface{}]bool{}
+		for _, doc := range data {
+			keys, err := reflect.ValueOf(doc).Elem().FieldByIndexErr(keyField.IndexPath)
+			if err != nil {
+				continue
+			}
+			for _, key := range keyValues(keys, refPath.Many && !refPath.Virtual) {
+				if !seen[key] {
+					seen[key] = true
+					values = append(values, key)
+				}
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		// Options apply to the last ref of the path
+		opt := Populate{Path: rest, Strategy: path.Strategy}
+		if rest == "" {
+			opt = path
+			opt.Path = ""
+			opt.Limit = 0 // Applied per document below
+		} else {
+			opt.Select, opt.Match, opt.Sort, opt.Limit = path.Select, path.Match, path.Sort, path.Limit
+		}
+
+		loaded, err := loader.loadBatch(refPath.foreignField(), values, opt)
+		if err != nil {
+			return err
+		}
+
+		limit := int64(0)
+		if rest == "" {
+			limit = path.Limit
+		}
+		if err := stitch(data, refPath, keyField, asField, loaded, path.Sort != nil, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refLoader returns the model loading the documents of refPath.
+func (m *Model[M]) refLoader(refPath *RefPath, model ModelCommon) (batchLoader, error) {
+	if model == nil && m.connect != nil {
+		model = m.connect.Model(refPath.From)
+	}
+	loader, ok := model.(batchLoader)
+	if !ok {
+		return nil, &ErrModelNotRegistered{Collection: refPath.From}
+	}
+	return loader, nil
+}
+
+// loadBatch finds the documents whose field is in values, running the Find
+// hooks of the model, which may add filters to the bson.M they receive.
+// Match is checked like the filters of the model. The rest of the populate
+// path in opt.Path is populated by the model. It returns a slice of *M.
+func (m *Model[M]) loadBatch(field string, values []interface{}, opt Populate) (reflect.Value, error) {
+	var filter interface{} = bson.M{field: bson.M{"$in": values}}
+	if opt.Match != nil && opt.Path == "" {
+		if err := m.sanitizeFilter(opt.Match); err != nil {
+			return reflect.Value{}, err
+		}
+		filter = bson.M{"$and": bson.A{filter, opt.Match}}
+	}
+
+	err := ExecutePreHook(Find, m, filter)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	query, err := ToDoc(filter)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	findOpt := QueriesOptions{}
+	if opt.Path != "" {
+		findOpt.Populate = []Populate{opt}
+	} else {
+		findOpt.Sort = opt.Sort
+		findOpt.Projection = opt.Select
+		if findOpt.Projection != nil && !isExclusion(findOpt.Projection) {
+			// The matched field is needed to stitch the documents
+			findOpt.Projection = append(findOpt.Projection, bson.E{Key: field, Value: 1})
+		} else if hidden := GetTypeInfo[M]().HiddenFields; len(hidden) > 0 {
+			for _, name := range hidden {
+				findOpt.Projection = append(findOpt.Projection, bson.E{Key: name, Value: 0})
+			}
+		}
+	}
+
+	var data []*M
+	paths := populates(nil, findOpt.Populate)
+	lookups, batches, err := m.splitPopulates(paths)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if len(lookups) == 0 {
+		data, err = m.find(query, findOpt)
+	} else {
+		data, err = m.findWithRef(query, lookups, findOpt)
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if err := m.populateBatch(data, batches); err != nil {
+		return reflect.Value{}, err
+	}
+	if findOpt.Projection != nil && !isExclusion(findOpt.Projection) {
+		// Selected hidden fields are left out too
+		clearHidden(data)
+	}
+
+	err = ExecutePostHook(Find, m, data)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(data), nil
+}
+
+// stitch sets the populated field of every document from the loaded
+// documents. Refs keep the order of their keys unless sorted, virtuals
+// keep the order of the loaded documents. limit caps array fields.
+func stitch[M any](data []*M, refPath *RefPath, keyField *FieldInfo, asField *FieldInfo, loaded reflect.Value, sorted bool, limit int64) error {
+	matchInfo := getTypeInfoOf(loaded.Type().Elem())
+	matchField := matchInfo.FieldsByBson[refPath.foreignField()]
+	if matchField == nil {
+		return fmt.Errorf("populate %s: field %s not found in %s", refPath.As, refPath.foreignField(), refPath.From)
+	}
+
+	// Index the loaded documents by the matched field
+	byKey := map[interface{}][]reflect.Value{}
+	order := map[interface{}]int{}
+	for i := 0; i < loaded.Len(); i++ {
+		doc := loaded.Index(i)
+		value, err := doc.Elem().FieldByIndexErr(matchField.IndexPath)
+		if err != nil {
+			continue
+		}
+		for _, key := range keyValues(value, value.Kind() == reflect.Slice) {
+			byKey[key] = append(byKey[key], doc)
+			if _, ok := order[key]; !ok {
+				order[key] = i
+			}
+		}
+	}
+
+	for _, doc := range data {
+		v := reflect.ValueOf(doc).Elem()
+		keys, err := v.FieldByIndexErr(keyField.IndexPath)
+		if err != nil {
+			continue
+		}
+		target, err := v.FieldByIndexErr(asField.IndexPath)
+		if err != nil {
+			continue
+		}
+
+		var found []reflect.Value
+		if refPath.Virtual {
+			for _, key := range keyValues(keys, false) {
+				found = append(found, byKey[key]...)
+			}
+		} else {
+			for _, key := range keyValues(keys, refPath.Many) {
+				if docs := byKey[key]; len(docs) > 0 {
+					found = append(found, docs[0])
+				}
+			}
+			if sorted {
+				sortByOrder(found, byKey, order, matchField)
+			}
+		}
+		if limit > 0 && int64(len(found)) > limit {
+			found = found[:limit]
+		}
+
+		if err := setPopulated(target, found, refPath.Many); err != nil {
+			return fmt.Errorf("populate %s: %w", refPath.As, err)
+		}
+	}
+	return nil
+}
+
+// sortByOrder sorts documents by their position in the loaded documents.
+func sortByOrder(docs []reflect.Value, byKey map[interface{}][]reflect.Value, order map[interface{}]int, matchField *FieldInfo) {
+	position := func(doc reflect.Value) int {
+		value, _ := doc.Elem().FieldByIndexErr(matchField.IndexPath)
+		if value.IsValid() && value.Comparable() {
+			return order[value.Interface()]
+		}
+		return 0
+	}
+	for i := 1; i < len(docs); i++ {
+		for j := i; j > 0 && position(docs[j]) < position(docs[j-1]); j-- {
+			docs[j], docs[j-1] = docs[j-1], docs[j]
+		}
+	}
+}
+
+// setPopulated sets target, a struct, pointer or slice field, from the
+// found documents, which are pointers.
+func setPopulated(target reflect.Value, found []reflect.Value, many bool) error {
+	if !many {
+		if len(found) == 0 {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		return assignDoc(target, found[0])
+	}
+
+	if target.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot populate %s with many documents", target.Type())
+	}
+	slice := reflect.MakeSlice(target.Type(), len(found), len(found))
+	for i, doc := range found {
+		if err := assignDoc(slice.Index(i), doc); err != nil {
+			return err
+		}
+	}
+	target.Set(slice)
+	return nil
+}
+
+// assignDoc sets target from doc, a pointer to a struct, dereferencing it
+// when target is not a pointer.
+func assignDoc(target reflect.Value, doc reflect.Value) error {
+	switch {
+	case doc.Type().AssignableTo(target.Type()):
+		target.Set(doc)
+	case doc.Elem().Type().AssignableTo(target.Type()):
+		target.Set(doc.Elem())
+	default:
+		return fmt.Errorf("cannot assign %s to %s", doc.Type(), target.Type())
+	}
+	return nil
+}
+
+// keyValues returns the comparable, non zero keys of a field value.
+// Slices are expanded when many is true.
+func keyValues(value reflect.Value, many bool) []interface{} {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if many && (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) {
+		var keys []interface{}
+		for i := 0; i < value.Len(); i++ {
+			keys = append(keys, keyValues(value.Index(i), false)...)
+		}
+		return keys
+	}
+
+	if !value.IsValid() || value.IsZero() || !value.Comparable() {
+		return nil
+	}
+	return []interface{}{value.Interface()}
+}
+
+// clearHidden zeroes the fields of data tagged mongoose:"hidden".
+func clearHidden[M any](data []*M) {
+	typeInfo := GetTypeInfo[M]()
+	for _, name := range typeInfo.HiddenFields {
+		field := typeInfo.FieldsByBson[name]
+		for _, doc := range data {
+			if value, err := reflect.ValueOf(doc).Elem().FieldByIndexErr(field.IndexPath); err == nil {
+				value.SetZero()
+			}
+		}
+	}
+}
+
+// isExclusion reports whether every field of the projection is excluded.
+func isExclusion(projection bson.D) bool {
+	for _, e := range projection {
+		if !isExcluded(e.Value) {
+			return false
+		}
+	}
+	return len(projection) > 0
+}
@@ -0,0 +1,308 @@
+package mongoose
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkOpError is the error of one operation of a bulk write.
+type BulkOpError struct {
+	Index int         // Position of the operation in the bulk
+	Op    string      // Name of the operation, e.g. "updateOne"
+	Input interface{} // Document of inserts, filter of updates and deletes
+	Err   error
+}
+
+func (e BulkOpError) Error() string {
+	return fmt.Sprintf("%s #%d: %v", e.Op, e.Index, e.Err)
+}
+
+func (e BulkOpError) Unwrap() error {
+	return e.Err
+}
+
+// MaxBulkChanges is the number of documents the filters of a Bulk may
+// match on a model tracking changes, as they are read before the write.
+const MaxBulkChanges = 10000
+
+// ErrTooManyChanges is returned by Bulk.Exec on a model tracking changes
+// when its filters match more than MaxBulkChanges documents. Split the
+// bulk, or use UpdateMany and DeleteMany, which track them by batches.
+var ErrTooManyChanges = errors.New("bulk matches too many documents to track their changes")
+
+// ErrBulkWrite is returned by Bulk.Exec when operations fail, either while
+// preparing them, in which case nothing is written, or on the server.
+type ErrBulkWrite struct {
+	Errors            []BulkOpError
+	WriteConcernError *mongo.WriteConcernError
+}
+
+func (e *ErrBulkWrite) Error() string {
+	messages := make([]string, 0, len(e.Errors)+1)
+	for _, opErr := range e.Errors {
+		messages = append(messages, opErr.Error())
+	}
+	if e.WriteConcernError != nil {
+		messages = append(messages, e.WriteConcernError.Error())
+	}
+	return "bulk write failed: " + strings.Join(messages, "; ")
+}
+
+type bulkOp struct {
+	name  string
+	input interface{}
+	query *bson.D // Filter of updates, replaces and deletes
+	many  bool
+	write mongo.WriteModel
+	err   error
+}
+
+// Bulk is a batch of insert, update, replace and delete operations run with
+// one BulkWrite command. Inserts, updates and replaces are prepared like
+// Create, Update and FindOneAndReplace: validation, _id and timestamps,
+// readonly fields. Deletes do not apply the onDelete actions of refs.
+// When the model tracks changes, the changes are the documents inserted or
+// matching a filter before the bulk, with their state after the whole bulk,
+// and the filters may match up to MaxBulkChanges documents.
+type Bulk[M any] struct {
+	model *Model[M]
+	ops   []bulkOp
+}
+
+// Bulk returns a new empty Bulk for the model.
+func (m *Model[M]) Bulk() *Bulk[M] {
+	return &Bulk[M]{model: m}
+}
+
+// Len returns the number of operations of the bulk.
+func (b *Bulk[M]) Len() int {
+	return len(b.ops)
+}
+
+// Insert adds an insert of doc.
+func (b *Bulk[M]) Insert(doc *M) *Bulk[M] {
+	op := bulkOp{name: "insertOne", input: doc}
+	if op.err = b.model.beforeInsert(doc); op.err == nil {
+		op.write = mongo.NewInsertOneModel().SetDocument(doc)
+	}
+	return b.add(op)
+}
+
+// UpdateOne adds a $set update of the first document matching filter.
+func (b *Bulk[M]) UpdateOne(filter interface{}, data *M) *Bulk[M] {
+	op := bulkOp{name: "updateOne", input: filter}
+	query, update, err := b.update(filter, data)
+	op.query = query
+	if op.err = err; err == nil {
+		op.write = mongo.NewUpdateOneModel().SetFilter(query).SetUpdate(update)
+	}
+	return b.add(op)
+}
+
+// UpdateMany adds a $set update of every document matching filter.
+func (b *Bulk[M]) UpdateMany(filter interface{}, data *M) *Bulk[M] {
+	op := bulkOp{name: "updateMany", input: filter, many: true}
+	query, update, err := b.update(filter, data)
+	op.query = query
+	if op.err = err; err == nil {
+		op.write = mongo.NewUpdateManyModel().SetFilter(query).SetUpdate(update)
+	}
+	return b.add(op)
+}
+
+// ReplaceOne adds a replace of the first document matching filter.
+func (b *Bulk[M]) ReplaceOne(filter interface{}, data *M) *Bulk[M] {
+	op := bulkOp{name: "replaceOne", input: filter}
+	query, err := b.filter(filter)
+	op.query = query
+	if err == nil {
+		var replacement []bson.E
+		replacement, err = b.model.beforeUpdate(data, true)
+		if err == nil {
+			op.write = mongo.NewReplaceOneModel().SetFilter(query).SetReplacement(bson.D(replacement))
+		}
+	}
+	op.err = err
+	return b.add(op)
+}
+
+// DeleteOne adds a delete of the first document matching filter.
+func (b *Bulk[M]) DeleteOne(filter interface{}) *Bulk[M] {
+	op := bulkOp{name: "deleteOne", input: filter}
+	query, err := b.filter(filter)
+	op.query = query
+	if op.err = err; err == nil {
+		op.write = mongo.NewDeleteOneModel().SetFilter(query)
+	}
+	return b.add(op)
+}
+
+// DeleteMany adds a delete of every document matching filter.
+func (b *Bulk[M]) DeleteMany(filter interface{}) *Bulk[M] {
+	op := bulkOp{name: "deleteMany", input: filter, many: true}
+	query, err := b.filter(filter)
+	op.query = query
+	if op.err = err; err == nil {
+		op.write = mongo.NewDeleteManyModel().SetFilter(query)
+	}
+	return b.add(op)
+}
+
+// Exec runs the operations with one BulkWrite command. Ordered bulks stop
+// at the first failed operation, unordered ones run every operation.
+// When an operation cannot be prepared, nothing is written. Failed
+// operations are reported by an *ErrBulkWrite, mapped back to their input.
+// The bulkWrite pre hooks receive the write models, the post hooks the
+// result and the changes.
+func (b *Bulk[M]) Exec(ordered bool) (*mongo.BulkWriteResult, error) {
+	m := b.model
+
+	var prepErrs []BulkOpError
+	writes := make([]mongo.WriteModel, 0, len(b.ops))
+	for i, op := range b.ops {
+		if op.err != nil {
+			prepErrs = append(prepErrs, BulkOpError{Index: i, Op: op.name, Input: op.input, Err: op.err})
+			continue
+		}
+		writes = append(writes, op.write)
+	}
+	if len(prepErrs) > 0 {
+		return nil, &ErrBulkWrite{Errors: prepErrs}
+	}
+	if len(writes) == 0 {
+		return &mongo.BulkWriteResult{}, nil
+	}
+
+	err := ExecutePreHook(BulkWrite, m, writes)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := b.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := m.Collection.BulkWrite(m.Ctx, writes, options.BulkWrite().SetOrdered(ordered))
+	if cacheErr := m.invalidateCache(); cacheErr != nil && err == nil {
+		err = cacheErr
+	}
+	var bulkErr mongo.BulkWriteException
+	if err == nil || errors.As(err, &bulkErr) {
+		// Failed operations may follow written ones
+		trackErr := m.reload(m.Ctx, changes)
+		if trackErr == nil {
+			trackErr = m.track(m.Ctx, BulkWrite, changes)
+		}
+		if trackErr != nil && err == nil {
+			err = trackErr
+		}
+	}
+	if err != nil {
+		if !errors.As(err, &bulkErr) {
+			return result, err
+		}
+		opErrs := make([]BulkOpError, 0, len(bulkErr.WriteErrors))
+		for _, writeErr := range bulkErr.WriteErrors {
+			op := b.ops[writeErr.Index]
+			opErrs = append(opErrs, BulkOpError{Index: writeErr.Index, Op: op.name, Input: op.input, Err: writeErr})
+		}
+		return result, &ErrBulkWrite{Errors: opErrs, WriteConcernError: bulkErr.WriteConcernError}
+	}
+
+	err = ExecutePostHook(BulkWrite, m, result, changes)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// snapshot returns the changes of the documents of the bulk, when the model
+// tracks changes: the inserted ones and the ones matching a filter.
+func (b *Bulk[M]) snapshot() ([]Change, error) {
+	m := b.model
+	if !m.tracksChanges() {
+		return nil, nil
+	}
+
+	var inserted []interface{}
+	for _, op := range b.ops {
+		if op.query != nil {
+			continue
+		}
+		raw, err := bson.Marshal(op.input)
+		if err != nil {
+			return nil, err
+		}
+		// Documents without _id get one from the driver and are not tracked
+		if change, err := newChange(nil, raw); err == nil && change.ID != nil {
+			inserted = append(inserted, change.ID)
+		}
+	}
+	changes, err := m.snapshotIDs(m.Ctx, inserted)
+	if err != nil {
+		return nil, err
+	}
+	if changes == nil {
+		changes = []Change{}
+	}
+
+	seen := make(map[string]bool, len(changes))
+	for _, change := range changes {
+		seen[idKey(change.ID)] = true
+	}
+	matches := 0
+	for _, op := range b.ops {
+		if op.query == nil {
+			continue
+		}
+		limit := int64(1)
+		if op.many {
+			limit = MaxBulkChanges + 1
+		}
+		matched, err := m.snapshot(m.Ctx, op.query, limit, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range matched {
+			if key := idKey(change.ID); !seen[key] {
+				seen[key] = true
+				changes = append(changes, change)
+				matches++
+			}
+		}
+		if matches > MaxBulkChanges {
+			return nil, ErrTooManyChanges
+		}
+	}
+	return changes, nil
+}
+
+func (b *Bulk[M]) add(op bulkOp) *Bulk[M] {
+	b.ops = append(b.ops, op)
+	return b
+}
+
+func (b *Bulk[M]) filter(filter interface{}) (*bson.D, error) {
+	if err := b.model.sanitizeFilter(filter); err != nil {
+		return nil, err
+	}
+	return ToDoc(filter)
+}
+
+func (b *Bulk[M]) update(filter interface{}, data *M) (*bson.D, bson.D, error) {
+	query, err := b.filter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	update, err := b.model.beforeUpdate(data, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return query, bson.D{{Key: "$set", Value: update}}, nil
+}
@@ -0,0 +1,88 @@
+package mongoose_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Stock struct {
+	BaseSchema `bson:"inline"`
+	Sku        string `bson:"sku"`
+	Quantity   int    `bson:"quantity"`
+}
+
+func (s Stock) CollectionName() string {
+	return "stocks"
+}
+
+func TestBulk(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Stock]()
+	model.Index(bson.D{{Key: "sku", Value: 1}}, options.Index().SetUnique(true))
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	var hooked []mongo.WriteModel
+	model.Pre(mongoose.BulkWrite, func(params ...any) error {
+		hooked = params[0].([]mongo.WriteModel)
+		return nil
+	})
+
+	result, err := model.Bulk().
+		Insert(&Stock{Sku: "a", Quantity: 1}).
+		Insert(&Stock{Sku: "b", Quantity: 2}).
+		Insert(&Stock{Sku: "c", Quantity: 3}).
+		UpdateOne(bson.M{"sku": "a"}, &Stock{Sku: "a", Quantity: 10}).
+		ReplaceOne(bson.M{"sku": "b"}, &Stock{Sku: "b", Quantity: 20}).
+		DeleteMany(bson.M{"sku": "c"}).
+		Exec(true)
+	require.Nil(t, err)
+	assert.Len(t, hooked, 6)
+	assert.Equal(t, int64(3), result.InsertedCount)
+	assert.Equal(t, int64(2), result.ModifiedCount)
+	assert.Equal(t, int64(1), result.DeletedCount)
+
+	stock, err := model.FindOne(bson.M{"sku": "a"})
+	require.Nil(t, err)
+	assert.Equal(t, 10, stock.Quantity)
+	assert.False(t, stock.ID.IsZero())
+	assert.False(t, stock.CreatedAt.IsZero())
+
+	// The duplicate insert fails, the other operations run when unordered
+	result, err = model.Bulk().
+		Insert(&Stock{Sku: "d"}).
+		Insert(&Stock{Sku: "a"}).
+		UpdateMany(bson.M{"sku": "b"}, &Stock{Sku: "b", Quantity: 30}).
+		Exec(false)
+	var bulkErr *mongoose.ErrBulkWrite
+	require.ErrorAs(t, err, &bulkErr)
+	require.Len(t, bulkErr.Errors, 1)
+	assert.Equal(t, 1, bulkErr.Errors[0].Index)
+	assert.Equal(t, "insertOne", bulkErr.Errors[0].Op)
+	assert.Equal(t, "a", bulkErr.Errors[0].Input.(*Stock).Sku)
+	assert.Equal(t, int64(1), result.InsertedCount)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	// Filters are sanitized when preparing, nothing is written
+	strict := mongoose.NewModel[Stock](mongoose.ModelOptions{ID: true, Timestamp: true, StrictFilters: true})
+	strict.SetConnect(connect)
+	_, err = strict.Bulk().
+		Insert(&Stock{Sku: "e"}).
+		DeleteOne(bson.M{"sku": bson.M{"$ne": "a"}}).
+		Exec(true)
+	require.ErrorAs(t, err, &bulkErr)
+	require.Len(t, bulkErr.Errors, 1)
+	assert.Equal(t, 1, bulkErr.Errors[0].Index)
+	count, err := model.Count(bson.M{"sku": "e"})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
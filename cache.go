@@ -0,0 +1,222 @@
+package mongoose
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultCacheSize is the number of entries of the in-memory cache used when
+// CacheOptions.Store is nil.
+const DefaultCacheSize = 1000
+
+// CacheStore stores the cached documents of models as BSON. Implement it to
+// plug another cache, e.g. a wrapper of the tinhtinh cache manager.
+// A zero ttl means no expiration.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheOptions enables a read-through cache of FindByID, and of FindOne
+// calls with QueryOptions.Cache, on a model. Every write through the model
+// invalidates its cached entries.
+type CacheOptions struct {
+	Store       CacheStore    // In-memory LRU of DefaultCacheSize entries when nil
+	TTL         time.Duration // Expiration of cached documents, none when zero
+	NegativeTTL time.Duration // Expiration of cached misses, misses are not cached when zero
+}
+
+// cache returns the cache options of the model with a store, or nil.
+func (m *Model[M]) cache() *CacheOptions {
+	return m.cacheOpt
+}
+
+// newCache returns a copy of opt with a store, an in-memory one of the
+// model when opt has none, or nil.
+func newCache(opt *CacheOptions) *CacheOptions {
+	if opt == nil {
+		return nil
+	}
+	cache := *opt
+	if cache.Store == nil {
+		cache.Store = NewMemoryCache(DefaultCacheSize)
+	}
+	return &cache
+}
+
+// cacheNamespace prefixes the keys of the model in the cache: the servers,
+// database and collection of its connection, so the models of tenants
+// sharing a store never read each other's entries.
+func (m *Model[M]) cacheNamespace() string {
+	return strings.Join(m.connect.hosts, ",") + "/" + m.connect.DB + "." + m.GetName()
+}
+
+// generationKey holds the generation of the cached entries of the model.
+// Entry keys include it, so writes invalidate every entry by changing it.
+func (m *Model[M]) generationKey() string {
+	return m.cacheNamespace() + ":generation"
+}
+
+// cacheKey returns the key of the FindOne query in the cache.
+func (m *Model[M]) cacheKey(cache *CacheOptions, query *bson.D, opt QueryOptions) (string, error) {
+	generation, ok, err := cache.Store.Get(m.Ctx, m.generationKey())
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		// Never reuse a previous generation when the key was evicted
+		generation = []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+		if err := cache.Store.Set(m.Ctx, m.generationKey(), generation, 0); err != nil {
+			return "", err
+		}
+	}
+
+	raw, err := bson.Marshal(bson.D{
+		{Key: "query", Value: query},
+		{Key: "projection", Value: opt.Projection},
+		{Key: "sort", Value: opt.Sort},
+		{Key: "collation", Value: opt.Collation},
+		// Change the result too: sparse or partial hinted indexes, bounds
+		// and index keys instead of documents
+		{Key: "hint", Value: opt.Hint},
+		{Key: "min", Value: opt.Min},
+		{Key: "max", Value: opt.Max},
+		{Key: "returnKey", Value: opt.ReturnKey},
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(raw)
+	return m.cacheNamespace() + ":" + string(generation) + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// cachedFindOne returns the cached result of key. A cached miss is found
+// with a nil document.
+func (m *Model[M]) cachedFindOne(cache *CacheOptions, key string) (data *M, found bool) {
+	raw, ok, err := cache.Store.Get(m.Ctx, key)
+	if err != nil || !ok {
+		return nil, false
+	}
+	if len(raw) == 0 {
+		return nil, true
+	}
+	data = new(M)
+	if err := bson.Unmarshal(raw, data); err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// setCachedFindOne caches the result of key. Failures are ignored, the next
+// read queries the database again.
+func (m *Model[M]) setCachedFindOne(cache *CacheOptions, key string, data *M) {
+	if data == nil {
+		if cache.NegativeTTL > 0 {
+			_ = cache.Store.Set(m.Ctx, key, []byte{}, cache.NegativeTTL)
+		}
+		return
+	}
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return
+	}
+	_ = cache.Store.Set(m.Ctx, key, raw, cache.TTL)
+}
+
+// invalidateCache drops every cached entry of the model.
+func (m *Model[M]) invalidateCache() error {
+	cache := m.cache()
+	if cache == nil {
+		return nil
+	}
+	return cache.Store.Delete(m.Ctx, m.generationKey())
+}
+
+// memoryCache is an in-memory CacheStore evicting the least recently used
+// entries.
+type memoryCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns an in-memory CacheStore holding up to size entries,
+// evicting the least recently used ones.
+func NewMemoryCache(size int) CacheStore {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &memoryCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+func (c *memoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+	return nil
+}
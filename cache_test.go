@@ -0,0 +1,146 @@
+package mongoose_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Profile struct {
+	BaseSchema `bson:"inline"`
+	Name       string `bson:"name"`
+	Theme      string `bson:"theme"`
+}
+
+func (p Profile) CollectionName() string {
+	return "profiles"
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	store := mongoose.NewMemoryCache(2)
+
+	require.Nil(t, store.Set(ctx, "a", []byte("1"), 0))
+	require.Nil(t, store.Set(ctx, "b", []byte("2"), 0))
+	_, ok, _ := store.Get(ctx, "a")
+	require.True(t, ok)
+
+	// b is the least recently used
+	require.Nil(t, store.Set(ctx, "c", []byte("3"), 0))
+	_, ok, _ = store.Get(ctx, "b")
+	assert.False(t, ok)
+	value, ok, _ := store.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	require.Nil(t, store.Set(ctx, "d", []byte("4"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ = store.Get(ctx, "d")
+	assert.False(t, ok)
+
+	require.Nil(t, store.Delete(ctx, "a"))
+	_, ok, _ = store.Get(ctx, "a")
+	assert.False(t, ok)
+}
+
+func TestCache(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Profile](mongoose.ModelOptions{
+		ID:        true,
+		Timestamp: true,
+		Cache:     &mongoose.CacheOptions{TTL: time.Minute, NegativeTTL: time.Minute},
+	})
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	profile := &Profile{Name: "kai", Theme: "dark"}
+	_, err := model.Create(profile)
+	require.Nil(t, err)
+
+	found, err := model.FindByID(profile.ID)
+	require.Nil(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "dark", found.Theme)
+
+	// Served from the cache while the collection changes behind the model
+	_, err = model.Collection.UpdateByID(context.Background(), profile.ID, bson.M{"$set": bson.M{"theme": "light"}})
+	require.Nil(t, err)
+	found, err = model.FindByID(profile.ID)
+	require.Nil(t, err)
+	assert.Equal(t, "dark", found.Theme)
+
+	// Writes through the model invalidate
+	require.Nil(t, model.UpdateByID(profile.ID, &Profile{Name: "kai", Theme: "blue"}))
+	found, err = model.FindByID(profile.ID)
+	require.Nil(t, err)
+	assert.Equal(t, "blue", found.Theme)
+
+	// Misses are cached until the next write
+	missing := primitive.NewObjectID()
+	found, err = model.FindOne(bson.M{"name": "jin"}, mongoose.QueryOptions{Cache: true})
+	require.Nil(t, err)
+	assert.Nil(t, found)
+	_, err = model.Collection.InsertOne(context.Background(), bson.M{"_id": missing, "name": "jin"})
+	require.Nil(t, err)
+	found, err = model.FindOne(bson.M{"name": "jin"}, mongoose.QueryOptions{Cache: true})
+	require.Nil(t, err)
+	assert.Nil(t, found)
+	found, err = model.FindOne(bson.M{"name": "jin"})
+	require.Nil(t, err)
+	assert.NotNil(t, found)
+
+	require.Nil(t, model.DeleteByID(missing))
+	found, err = model.FindOne(bson.M{"name": "jin"}, mongoose.QueryOptions{Cache: true})
+	require.Nil(t, err)
+	assert.Nil(t, found)
+	_, err = model.Create(&Profile{Name: "jin"})
+	require.Nil(t, err)
+	found, err = model.FindOne(bson.M{"name": "jin"}, mongoose.QueryOptions{Cache: true})
+	require.Nil(t, err)
+	assert.NotNil(t, found)
+
+	// Options changing the result have their own entry
+	found, err = model.FindOne(bson.M{"name": "kai"}, mongoose.QueryOptions{Cache: true})
+	require.Nil(t, err)
+	assert.Equal(t, "blue", found.Theme)
+	found, err = model.FindOne(bson.M{"name": "kai"}, mongoose.QueryOptions{Cache: true, ReturnKey: true})
+	require.Nil(t, err)
+	require.NotNil(t, found)
+	assert.Empty(t, found.Theme)
+}
+
+func TestCache_SharedStore(t *testing.T) {
+	options := &mongoose.CacheOptions{Store: mongoose.NewMemoryCache(100), TTL: time.Minute}
+	profiles := map[string]*mongoose.Model[Profile]{}
+	for _, db := range []string{"tenant_a", "tenant_b"} {
+		connect := mongoose.New(os.Getenv("MONGO_URI"))
+		connect.SetDB(db)
+		model := mongoose.NewModel[Profile](mongoose.ModelOptions{ID: true, Timestamp: true, Cache: options})
+		model.SetConnect(connect)
+		require.Nil(t, model.DeleteMany(nil))
+		_, err := model.Create(&Profile{Name: "kai", Theme: db})
+		require.Nil(t, err)
+		profiles[db] = model
+	}
+
+	// Tenants sharing a store read their own documents
+	for db, model := range profiles {
+		found, err := model.FindOne(bson.M{"name": "kai"}, mongoose.QueryOptions{Cache: true})
+		require.Nil(t, err)
+		assert.Equal(t, db, found.Theme)
+	}
+
+	// Without a store, each model gets its own, leaving the options as is
+	shared := &mongoose.CacheOptions{}
+	mongoose.NewModel[Profile](mongoose.ModelOptions{Cache: shared})
+	assert.Nil(t, shared.Store)
+}
@@ -0,0 +1,164 @@
+package mongoose
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// DefaultLeaseCollection is the collection of the model database
+	// holding the leases of consumer groups.
+	DefaultLeaseCollection = "mongoose_leases"
+	DefaultLeaseTTL        = 10 * time.Second
+	DefaultRetryDelay      = time.Second
+)
+
+type ChangeHookFnc[M any] func(event *ChangeEvent[M]) error
+
+type changeHook[M any] struct {
+	operations []string
+	fnc        ChangeHookFnc[M]
+}
+
+// OnChange registers a reactive hook, called by Listen for the changes of
+// the collection made by any process. Names are separated by "|" like Pre
+// and Post: create, createMany and save match inserts; update, updateMany,
+// findOneAndUpdate, findOneAndReplace and save match updates and replaces;
+// delete, deleteMany and findOneAndDelete match deletes.
+func (m *Model[M]) OnChange(nameStr HookName, fnc ChangeHookFnc[M]) {
+	var operations []string
+	for _, name := range strings.Split(string(nameStr), "|") {
+		operations = append(operations, changeOperations(HookName(name))...)
+	}
+	m.changeHooks = append(m.changeHooks, changeHook[M]{operations: operations, fnc: fnc})
+}
+
+// changeOperations returns the change event operation types of a hook name.
+func changeOperations(name HookName) []string {
+	switch name {
+	case Create, CreateMany:
+		return []string{"insert"}
+	case Update, UpdateMany, FindOneAndUpdate, FindOneAndReplace:
+		return []string{"update", "replace"}
+	case Save:
+		return []string{"insert", "update", "replace"}
+	case Delete, DeleteMany, FindOneAndDelete:
+		return []string{"delete"}
+	}
+	return nil
+}
+
+type ListenOptions struct {
+	// Group of consumers sharing the events: one consumer of the group
+	// handles them at a time, resuming after the last handled event.
+	Group      string           // "default" when empty
+	Consumer   string           // Unique name of the consumer, random when empty
+	LeaseTTL   time.Duration    // DefaultLeaseTTL when zero
+	RetryDelay time.Duration    // Wait after a failed hook, DefaultRetryDelay when zero
+	Store      ResumeTokenStore // Store of Watch when nil
+}
+
+// Listen runs the OnChange hooks until ctx is done. Consumers of the same
+// group compete for a lease; the holder watches the collection and the
+// others take over when it stops renewing it. An event is committed once
+// every matching hook succeeded, so delivery is at least once: a failed
+// hook is retried after RetryDelay, and an event being handled when the
+// holder stops is handled again by the next one. Listen returns at once
+// when the model has no OnChange hooks.
+func (m *Model[M]) Listen(ctx context.Context, opts ...ListenOptions) error {
+	var opt ListenOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Group == "" {
+		opt.Group = "default"
+	}
+	if opt.Consumer == "" {
+		opt.Consumer = consumerName()
+	}
+	if opt.LeaseTTL == 0 {
+		opt.LeaseTTL = DefaultLeaseTTL
+	}
+	if opt.RetryDelay == 0 {
+		opt.RetryDelay = DefaultRetryDelay
+	}
+
+	if len(m.changeHooks) == 0 {
+		return nil
+	}
+
+	leases := &LockManager{Collection: m.Collection.Database().Collection(DefaultLeaseCollection)}
+	for {
+		err := leases.withLock(ctx, m.GetName()+":"+opt.Group, opt.Consumer, opt.LeaseTTL, func(ctx context.Context, _ *Lock) error {
+			return m.listenWithLease(ctx, opt)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		wait := opt.LeaseTTL / 3
+		if err != nil && err != ErrLockHeld {
+			wait = opt.RetryDelay
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// listenWithLease dispatches the events until ctx, canceled when the lease
+// is lost, is done.
+func (m *Model[M]) listenWithLease(ctx context.Context, opt ListenOptions) error {
+	var operations bson.A
+	for _, hook := range m.changeHooks {
+		for _, operation := range hook.operations {
+			operations = append(operations, operation)
+		}
+	}
+	stream, err := m.Watch(ctx, bson.M{"operationType": bson.M{"$in": operations}}, WatchOptions{
+		Name:  "group:" + opt.Group,
+		Store: opt.Store,
+	})
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		if err := m.dispatchChange(stream.Event()); err != nil {
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+func (m *Model[M]) dispatchChange(event *ChangeEvent[M]) error {
+	for _, hook := range m.changeHooks {
+		for _, operation := range hook.operations {
+			if operation != event.OperationType {
+				continue
+			}
+			if err := hook.fnc(event); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func consumerName() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,92 @@
+package mongoose_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+)
+
+func TestOnChange(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	writer := mongoose.NewModel[Ticket]()
+	writer.SetConnect(connect)
+	require.Nil(t, writer.DeleteMany(nil))
+
+	var mu sync.Mutex
+	handled := map[string][]string{}
+	failed := false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two replicas of the same service
+	group := "test-" + time.Now().Format("150405.000000")
+	var wg sync.WaitGroup
+	for _, consumer := range []string{"a", "b"} {
+		replica := mongoose.NewModel[Ticket]()
+		replica.SetConnect(connect)
+		replica.OnChange("create|update", func(event *mongoose.ChangeEvent[Ticket]) error {
+			mu.Lock()
+			defer mu.Unlock()
+			// The first delivery of the update fails and is retried
+			if event.OperationType == "update" && !failed {
+				failed = true
+				return errors.New("retry")
+			}
+			handled[event.FullDocument.Title] = append(handled[event.FullDocument.Title], consumer)
+			return nil
+		})
+
+		wg.Add(1)
+		go func(consumer string) {
+			defer wg.Done()
+			err := replica.Listen(ctx, mongoose.ListenOptions{
+				Group:      group,
+				Consumer:   consumer,
+				LeaseTTL:   time.Second,
+				RetryDelay: 100 * time.Millisecond,
+			})
+			assert.Nil(t, err)
+		}(consumer)
+	}
+
+	// Let a consumer take the lease and open its stream
+	time.Sleep(2 * time.Second)
+	ticket := &Ticket{Title: "first", Status: "open"}
+	_, err := writer.Create(ticket)
+	require.Nil(t, err)
+	require.Nil(t, writer.UpdateByID(ticket.ID, &Ticket{Status: "closed"}))
+	_, err = writer.Create(&Ticket{Title: "second"})
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled["first"]) == 2 && len(handled["second"]) == 1
+	}, 20*time.Second, 100*time.Millisecond)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestListen_NoHooks(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Ticket]()
+	model.SetConnect(connect)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Nil(t, model.Listen(ctx))
+	require.Nil(t, ctx.Err())
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tinh-tinh/mongoose/v2"
+	"github.com/tinh-tinh/mongoose/v2/migrate"
+)
+
+// ErrUsage is returned by Run when the arguments are invalid, after the
+// usage is printed.
+var ErrUsage = errors.New("invalid usage")
+
+type Options struct {
+	Name       string // Name of the program in the usage, "mongoose-migrate" when empty
+	Stdout     io.Writer
+	Stderr     io.Writer
+	Migrations []*migrate.Migration // Registered migrations when nil
+	// Models are set on the connection, so seed, export and import go
+	// through them
+	Models []mongoose.ModelCommon
+	// Connect is used instead of -uri, e.g. the CONNECT_MONGO of an
+	// application whose models are set by ForFeature
+	Connect *mongoose.Connect
+}
+
+// Env is passed to the commands, with the global flags parsed.
+type Env struct {
+	URI        string
+	DB         string
+	Collection string // Collection of the migrations
+	Dir        string // Directory of the migrations
+	Stdout     io.Writer
+	Stderr     io.Writer
+	migrations []*migrate.Migration
+	models     []mongoose.ModelCommon
+	connect    *mongoose.Connect
+}
+
+// Connect returns the connection to URI, opened on the first call, with
+// the models set on it.
+func (e *Env) Connect() *mongoose.Connect {
+	if e.connect == nil {
+		e.connect = mongoose.New(e.URI)
+		if e.DB != "" {
+			e.connect.SetDB(e.DB)
+		}
+	}
+	for _, m := range e.models {
+		m.SetConnect(e.connect)
+	}
+	e.models = nil
+	return e.connect
+}
+
+// Migrator returns the migrator of the connection.
+func (e *Env) Migrator() *migrate.Migrator {
+	return migrate.New(e.Connect(), migrate.Options{
+		Collection: e.Collection,
+		Migrations: e.migrations,
+		Logger: func(v ...any) {
+			fmt.Fprintln(e.Stdout, v...)
+		},
+	})
+}
+
+type Command struct {
+	Name    string
+	Args    string // Arguments in the usage
+	Summary string
+	Run     func(ctx context.Context, env *Env, args []string) error
+}
+
+var commands = map[string]*Command{}
+
+// Register adds a command to Run.
+func Register(command *Command) {
+	commands[command.Name] = command
+}
+
+// Main runs the command of the process arguments and exits with status 1
+// when it fails. Programs with their own migrations call it after
+// importing them:
+//
+//	import _ "example.com/app/migrations"
+//
+//	func main() {
+//		cli.Main()
+//	}
+func Main(opts ...Options) {
+	if err := Run(context.Background(), os.Args[1:], opts...); err != nil {
+		if !errors.Is(err, ErrUsage) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// Run runs the command of args, preceded by the global flags.
+func Run(ctx context.Context, args []string, opts ...Options) error {
+	var opt Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Name == "" {
+		opt.Name = "mongoose-migrate"
+	}
+	if opt.Stdout == nil {
+		opt.Stdout = os.Stdout
+	}
+	if opt.Stderr == nil {
+		opt.Stderr = os.Stderr
+	}
+
+	env := &Env{Stdout: opt.Stdout, Stderr: opt.Stderr, migrations: opt.Migrations, models: opt.Models, connect: opt.Connect}
+	flags := flag.NewFlagSet(opt.Name, flag.ContinueOnError)
+	flags.SetOutput(opt.Stderr)
+	flags.StringVar(&env.URI, "uri", os.Getenv("MONGO_URI"), "MongoDB connection string")
+	flags.StringVar(&env.DB, "db", os.Getenv("MONGO_DB"), "database, the one of the uri when empty")
+	flags.StringVar(&env.Collection, "collection", migrate.DefaultCollection, "collection of the applied migrations")
+	flags.StringVar(&env.Dir, "dir", "migrations", "directory of the migrations")
+	flags.Usage = func() {
+		usage(opt.Name, flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	command := commands[flags.Arg(0)]
+	if command == nil {
+		flags.Usage()
+		return ErrUsage
+	}
+	if env.URI == "" && env.connect == nil && command.Name != "create" {
+		return errors.New("missing -uri or MONGO_URI")
+	}
+	return command.Run(ctx, env, flags.Args()[1:])
+}
+
+func usage(name string, flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [arguments]\n\nCommands:\n", name)
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		command := commands[name]
+		fmt.Fprintf(out, "  %-28s %s\n", strings.TrimSpace(command.Name+" "+command.Args), command.Summary)
+	}
+
+	fmt.Fprintln(out, "\nFlags:")
+	flags.PrintDefaults()
+}
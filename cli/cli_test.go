@@ -0,0 +1,67 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2/cli"
+	"github.com/tinh-tinh/mongoose/v2/migrate"
+)
+
+func TestRun_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	err := cli.Run(context.Background(), []string{"unknown"}, cli.Options{Stdout: &stdout, Stderr: &stderr})
+	require.ErrorIs(t, err, cli.ErrUsage)
+	require.Contains(t, stderr.String(), "Usage: mongoose-migrate")
+	require.Contains(t, stderr.String(), "create <name>")
+}
+
+func TestRun_Create(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+
+	var stdout bytes.Buffer
+	err := cli.Run(context.Background(), []string{"-dir", dir, "create", "add_index"}, cli.Options{Stdout: &stdout})
+	require.Nil(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	require.True(t, strings.HasSuffix(entries[0].Name(), "_add_index.go"))
+	require.Contains(t, stdout.String(), "created")
+}
+
+func TestRun_Migrate(t *testing.T) {
+	migrations := []*migrate.Migration{{Version: "1", Description: "cli"}}
+	opt := cli.Options{Stdout: &bytes.Buffer{}, Migrations: migrations}
+
+	args := []string{"-uri", os.Getenv("MONGO_URI"), "-db", "test", "-collection", "cli_migrations"}
+	require.Nil(t, cli.Run(context.Background(), append(args, "up"), opt))
+
+	var stdout bytes.Buffer
+	opt.Stdout = &stdout
+	require.Nil(t, cli.Run(context.Background(), append(args, "status"), opt))
+	require.Contains(t, stdout.String(), "applied")
+
+	// The migration has no down
+	err := cli.Run(context.Background(), append(args, "down"), opt)
+	require.ErrorIs(t, err, migrate.ErrIrreversible)
+}
+
+func TestRun_Seed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.yaml")
+	require.Nil(t, os.WriteFile(path, []byte("cli_users:\n  alice:\n    name: Alice\n"), 0o644))
+
+	args := []string{"-uri", os.Getenv("MONGO_URI"), "-db", "test", "seed"}
+	err := cli.Run(context.Background(), append(args, "-reset"), cli.Options{Stdout: &bytes.Buffer{}})
+	require.NotNil(t, err)
+
+	var stdout bytes.Buffer
+	require.Nil(t, cli.Run(context.Background(), append(args, "-reset", path), cli.Options{Stdout: &stdout}))
+	require.Contains(t, stdout.String(), "fixtures loaded")
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tinh-tinh/mongoose/v2/migrate"
+)
+
+func init() {
+	Register(&Command{
+		Name:    "up",
+		Args:    "[version]",
+		Summary: "apply the pending migrations, up to version",
+		Run:     runUp,
+	})
+	Register(&Command{
+		Name:    "down",
+		Args:    "[steps]",
+		Summary: "revert the last applied migrations, 1 by default",
+		Run:     runDown,
+	})
+	Register(&Command{
+		Name:    "status",
+		Summary: "list the migrations and whether they are applied",
+		Run:     runStatus,
+	})
+	Register(&Command{
+		Name:    "create",
+		Args:    "<name>",
+		Summary: "write an empty migration in -dir",
+		Run:     runCreate,
+	})
+}
+
+func runUp(ctx context.Context, env *Env, args []string) error {
+	target := ""
+	if len(args) > 0 {
+		target = args[0]
+	}
+	applied, err := env.Migrator().Up(ctx, target)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Stdout, "%d migrations applied\n", len(applied))
+	return nil
+}
+
+func runDown(ctx context.Context, env *Env, args []string) error {
+	steps := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid steps %q", args[0])
+		}
+		steps = n
+	}
+	reverted, err := env.Migrator().Down(ctx, steps)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Stdout, "%d migrations reverted\n", len(reverted))
+	return nil
+}
+
+func runStatus(ctx context.Context, env *Env, args []string) error {
+	statuses, err := env.Migrator().Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tDESCRIPTION")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status.Version, statusText(status), appliedAt(status), status.Description)
+	}
+	return w.Flush()
+}
+
+func runCreate(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migration name")
+	}
+	path, err := migrate.Create(env.Dir, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, "created", path)
+	return nil
+}
+
+func statusText(status migrate.Status) string {
+	switch {
+	case status.Missing:
+		return "missing"
+	case status.Modified:
+		return "modified"
+	case status.AppliedAt.IsZero():
+		return "pending"
+	}
+	return "applied"
+}
+
+func appliedAt(status migrate.Status) string {
+	if status.AppliedAt.IsZero() {
+		return "-"
+	}
+	return status.AppliedAt.Local().Format(time.DateTime)
+}
@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/tinh-tinh/mongoose/v2"
+)
+
+func init() {
+	Register(&Command{
+		Name:    "seed",
+		Args:    "[-reset] <path>...",
+		Summary: "load the fixtures of YAML and JSON files or directories",
+		Run:     runSeed,
+	})
+}
+
+func runSeed(ctx context.Context, env *Env, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	reset := flags.Bool("reset", false, "delete the documents of the fixture collections first")
+	if err := flags.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("missing fixtures path")
+	}
+
+	fixtures, err := mongoose.ReadFixtures(flags.Args()...)
+	if err != nil {
+		return err
+	}
+	if err := fixtures.Load(env.Connect(), mongoose.FixtureOptions{Reset: *reset}); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, "fixtures loaded")
+	return nil
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxRowErrors is the number of row errors printed per file by import.
+const maxRowErrors = 20
+
+func init() {
+	Register(&Command{
+		Name:    "export",
+		Args:    "[-format f] [-out dir] [-pii-key k] [collection]...",
+		Summary: "write the documents of collections, of every model by default",
+		Run:     runExport,
+	})
+	Register(&Command{
+		Name:    "import",
+		Args:    "[-format f] [-upsert] <path>...",
+		Summary: "insert the documents of files or directories, named by collection",
+		Run:     runImport,
+	})
+}
+
+func runExport(ctx context.Context, env *Env, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	format := flags.String("format", string(mongoose.FormatExtJSON), "ndjson, extjson or csv")
+	out := flags.String("out", ".", "directory of the files")
+	piiKey := flags.String("pii-key", os.Getenv("MONGOOSE_PII_KEY"), "key anonymizing the pii fields of the models, kept when empty")
+	if err := flags.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	connect := env.Connect()
+	collections := flags.Args()
+	if len(collections) == 0 {
+		var err error
+		collections, err = exportedCollections(ctx, connect)
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+
+	opt := mongoose.ExportOptions{}
+	if *piiKey != "" {
+		opt.Anonymizer = mongoose.NewAnonymizer([]byte(*piiKey))
+	}
+	for _, collection := range collections {
+		path := filepath.Join(*out, collection+mongoose.Format(*format).Ext())
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		count, err := connect.Export(file, collection, nil, mongoose.Format(*format), opt)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+		fmt.Fprintf(env.Stdout, "%s: %d documents exported to %s\n", collection, count, path)
+	}
+	return nil
+}
+
+// exportedCollections returns the collections of the models set on the
+// connection, or every collection of the database when there is none.
+func exportedCollections(ctx context.Context, connect *mongoose.Connect) ([]string, error) {
+	var collections []string
+	for _, m := range connect.Models() {
+		collections = append(collections, m.GetName())
+	}
+	if len(collections) == 0 {
+		names, err := connect.Client.Database(connect.DB).ListCollectionNames(ctx, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if !strings.HasPrefix(name, "system.") {
+				collections = append(collections, name)
+			}
+		}
+	}
+	sort.Strings(collections)
+	return collections, nil
+}
+
+func runImport(ctx context.Context, env *Env, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	format := flags.String("format", "", "ndjson, extjson or csv, by file extension when empty")
+	upsert := flags.Bool("upsert", false, "replace the documents with the same _id")
+	batch := flags.Int("batch", mongoose.DefaultImportBatchSize, "documents inserted at once")
+	if err := flags.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("missing import path")
+	}
+
+	files, err := importFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	connect := env.Connect()
+	failed := int64(0)
+	for _, path := range files {
+		fileFormat := mongoose.Format(*format)
+		if fileFormat == "" {
+			fileFormat = mongoose.FormatOf(path)
+		}
+		collection := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		result, err := connect.Import(file, collection, fileFormat, mongoose.ImportOptions{
+			BatchSize: *batch,
+			Upsert:    *upsert,
+		})
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		fmt.Fprintf(env.Stdout, "%s: %d inserted, %d replaced, %d failed\n",
+			collection, result.Inserted, result.Replaced, result.Failed)
+		for i, rowErr := range result.Errors {
+			if i == maxRowErrors {
+				fmt.Fprintf(env.Stderr, "%s: %d more errors\n", path, len(result.Errors)-i)
+				break
+			}
+			fmt.Fprintf(env.Stderr, "%s: %v\n", path, rowErr)
+		}
+		failed += result.Failed
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d rows failed", failed)
+	}
+	return nil
+}
+
+// importFiles returns the files of paths, with the files of known formats
+// of directories.
+func importFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && mongoose.FormatOf(entry.Name()) != "" {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,26 @@
+// Command mongoose-migrate manages the migrations of a MongoDB database,
+// loads fixtures and exports and imports collections.
+//
+// Go migrations are compiled in, and this command imports none: as
+// installed, up, down and pending see no migrations, only create, status,
+// fixtures, export and import are useful. To run your migrations, build
+// your own binary with a blank import of your migrations package:
+//
+//	package main
+//
+//	import (
+//		"github.com/tinh-tinh/mongoose/v2/cli"
+//
+//		_ "example.com/app/migrations"
+//	)
+//
+//	func main() {
+//		cli.Main()
+//	}
+package main
+
+import "github.com/tinh-tinh/mongoose/v2/cli"
+
+func main() {
+	cli.Main()
+}
@@ -0,0 +1,435 @@
+package mongoose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownFixture is returned by Load when a ref names no fixture.
+type ErrUnknownFixture struct {
+	Name string
+}
+
+func (e *ErrUnknownFixture) Error() string {
+	return fmt.Sprintf("unknown fixture @%s", e.Name)
+}
+
+// ErrFixtureCycle is returned by Load when fixtures reference each other.
+type ErrFixtureCycle struct {
+	Names []string
+}
+
+func (e *ErrFixtureCycle) Error() string {
+	return "fixtures reference each other: @" + strings.Join(e.Names, " -> @")
+}
+
+type fixture struct {
+	collection string
+	name       string
+	doc        map[string]interface{}
+}
+
+// Fixtures are named documents to insert, grouped by collection:
+//
+//	users:
+//	  user_alice:
+//	    name: Alice
+//	posts:
+//	  post_hello:
+//	    title: Hello
+//	    author: "@user_alice"
+//
+// A string "@name" is replaced by the _id of the fixture name, and "@@"
+// escapes a leading "@".
+type Fixtures struct {
+	entries []*fixture
+	byName  map[string]*fixture
+	ids     map[string]interface{}
+}
+
+type FixtureOptions struct {
+	Reset bool // Deletes the documents of the fixture collections first
+}
+
+// ReadFixtures reads the fixtures of YAML (.yaml, .yml), JSON or Extended
+// JSON (.json) files, and of the such files of directories by name.
+func ReadFixtures(paths ...string) (*Fixtures, error) {
+	fixtures := &Fixtures{byName: map[string]*fixture{}, ids: map[string]interface{}{}}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{path}
+		if info.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, entry := range entries {
+				if !entry.IsDir() && fixtureFormat(entry.Name()) != "" {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			format := fixtureFormat(file)
+			if format == "" {
+				return nil, fmt.Errorf("%s: unknown fixture format", file)
+			}
+			if err := fixtures.Parse(format, data); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	return fixtures, nil
+}
+
+func fixtureFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	}
+	return ""
+}
+
+// Parse adds the fixtures of data, in the "yaml" or "json" format. JSON
+// is read as relaxed Extended JSON, so values like {"$date": ...} and
+// {"$oid": ...} are decoded.
+func (f *Fixtures) Parse(format string, data []byte) error {
+	if f.byName == nil {
+		f.byName = map[string]*fixture{}
+		f.ids = map[string]interface{}{}
+	}
+	switch format {
+	case "yaml":
+		return f.parseYAML(data)
+	case "json":
+		return f.parseJSON(data)
+	}
+	return fmt.Errorf("unknown fixture format %q", format)
+}
+
+func (f *Fixtures) parseYAML(data []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	collections := root.Content[0]
+	if collections.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: fixtures must be a mapping of collections", collections.Line)
+	}
+	for i := 0; i+1 < len(collections.Content); i += 2 {
+		entries := collections.Content[i+1]
+		if entries.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: fixtures of %s must be a mapping of names", entries.Line, collections.Content[i].Value)
+		}
+		for j := 0; j+1 < len(entries.Content); j += 2 {
+			var doc map[string]interface{}
+			if err := entries.Content[j+1].Decode(&doc); err != nil {
+				return err
+			}
+			if err := f.add(collections.Content[i].Value, entries.Content[j].Value, doc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fixtures) parseJSON(data []byte) error {
+	var collections bson.D
+	if err := bson.UnmarshalExtJSON(data, false, &collections); err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		entries, ok := collection.Value.(bson.D)
+		if !ok {
+			return fmt.Errorf("fixtures of %s must be an object of names", collection.Key)
+		}
+		for _, entry := range entries {
+			doc, ok := entry.Value.(bson.D)
+			if !ok {
+				return fmt.Errorf("fixture %s must be an object", entry.Key)
+			}
+			if err := f.add(collection.Key, entry.Key, doc.Map()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fixtures) add(collection string, name string, doc map[string]interface{}) error {
+	if _, exists := f.byName[name]; exists {
+		return fmt.Errorf("duplicate fixture %s", name)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	entry := &fixture{collection: collection, name: name, doc: doc}
+	f.entries = append(f.entries, entry)
+	f.byName[name] = entry
+	return nil
+}
+
+// ID returns the _id of the fixture name once loaded.
+func (f *Fixtures) ID(name string) interface{} {
+	return f.ids[name]
+}
+
+// Load inserts the fixtures with the connection, each after the fixtures it
+// references. Fixtures of a collection with a model set on the connection
+// are decoded into the model and inserted like Create, so validation,
+// hooks and the _id and timestamp defaults apply; an _id, createdAt or
+// updatedAt given by the fixture is kept. Other fixtures are inserted as
+// is, with an _id when missing.
+func (f *Fixtures) Load(connect *Connect, opts ...FixtureOptions) error {
+	var opt FixtureOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	if opt.Reset {
+		reset := map[string]bool{}
+		for _, entry := range f.entries {
+			if reset[entry.collection] {
+				continue
+			}
+			reset[entry.collection] = true
+			if err := truncate(connect, entry.collection); err != nil {
+				return err
+			}
+		}
+	}
+
+	loaded := map[string]bool{}
+	var load func(entry *fixture, path []string) error
+	load = func(entry *fixture, path []string) error {
+		if loaded[entry.name] {
+			return nil
+		}
+		for i, name := range path {
+			if name == entry.name {
+				return &ErrFixtureCycle{Names: append(path[i:], entry.name)}
+			}
+		}
+		path = append(path, entry.name)
+
+		for _, name := range fixtureRefs(entry.doc, nil) {
+			dep := f.byName[name]
+			if dep == nil {
+				return &ErrUnknownFixture{Name: name}
+			}
+			if err := load(dep, path); err != nil {
+				return err
+			}
+		}
+
+		doc := resolveFixtureRefs(entry.doc, f.ids).(map[string]interface{})
+		id, err := insertFixture(connect, entry.collection, doc)
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", entry.name, err)
+		}
+		f.ids[entry.name] = id
+		loaded[entry.name] = true
+		return nil
+	}
+
+	for _, entry := range f.entries {
+		if err := load(entry, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixtureModel is implemented by Model[M] to load fixtures.
+type fixtureModel interface {
+	insertFixture(doc map[string]interface{}) (interface{}, error)
+	truncate() error
+}
+
+func truncate(connect *Connect, collection string) error {
+	if m, ok := connect.Model(collection).(fixtureModel); ok {
+		return m.truncate()
+	}
+	_, err := connect.Client.Database(connect.DB).Collection(collection).DeleteMany(connect.Ctx, bson.M{})
+	return err
+}
+
+func insertFixture(connect *Connect, collection string, doc map[string]interface{}) (interface{}, error) {
+	if m, ok := connect.Model(collection).(fixtureModel); ok {
+		return m.insertFixture(doc)
+	}
+
+	if _, exists := doc["_id"]; !exists {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	_, err := connect.Client.Database(connect.DB).Collection(collection).InsertOne(connect.Ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc["_id"], nil
+}
+
+// insertFixture decodes doc into M and inserts it like Create, keeping the
+// _id and timestamps given by doc.
+func (m *Model[M]) insertFixture(doc map[string]interface{}) (interface{}, error) {
+	typeInfo := GetTypeInfo[M]()
+
+	// Hex ids of YAML and plain JSON fixtures
+	if field, exists := typeInfo.FieldsByBson["_id"]; exists && field.Type == reflect.TypeOf(primitive.ObjectID{}) {
+		if hex, ok := doc["_id"].(string); ok {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return nil, err
+			}
+			doc["_id"] = id
+		}
+	}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	data := new(M)
+	if err := bson.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(data).Elem()
+	kept := map[*FieldInfo]reflect.Value{}
+	for _, name := range []string{"_id", "createdAt", "updatedAt"} {
+		if field, exists := typeInfo.FieldsByBson[name]; exists && doc[name] != nil {
+			value := v.FieldByIndex(field.IndexPath)
+			kept[field] = reflect.ValueOf(value.Interface())
+		}
+	}
+
+	if err := m.beforeInsert(data); err != nil {
+		return nil, err
+	}
+	for field, value := range kept {
+		v.FieldByIndex(field.IndexPath).Set(value)
+	}
+
+	err = ExecutePreHook(Create, m)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.Collection.InsertOne(m.Ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	err = m.afterInsert(Create, result, []interface{}{result.InsertedID}, []interface{}{data})
+	if err != nil {
+		return nil, err
+	}
+	return result.InsertedID, nil
+}
+
+// truncate deletes every document of the collection, without hooks nor
+// onDelete actions. Trackers record the deletes.
+func (m *Model[M]) truncate() error {
+	err := m.writeBatches(m.Ctx, bson.M{}, func(filter interface{}, batch []Change) error {
+		if _, err := m.Collection.DeleteMany(m.Ctx, filter); err != nil {
+			return err
+		}
+		return m.track(m.Ctx, DeleteMany, batch)
+	})
+	if err != nil {
+		return err
+	}
+	return m.invalidateCache()
+}
+
+// fixtureRefs appends the names referenced by v to names.
+func fixtureRefs(v interface{}, names []string) []string {
+	switch value := v.(type) {
+	case string:
+		if strings.HasPrefix(value, "@") && !strings.HasPrefix(value, "@@") {
+			names = append(names, value[1:])
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			names = fixtureRefs(value[key], names)
+		}
+	case bson.D:
+		for _, e := range value {
+			names = fixtureRefs(e.Value, names)
+		}
+	case []interface{}:
+		for _, item := range value {
+			names = fixtureRefs(item, names)
+		}
+	case bson.A:
+		for _, item := range value {
+			names = fixtureRefs(item, names)
+		}
+	}
+	return names
+}
+
+// resolveFixtureRefs returns a copy of v with its refs replaced by ids.
+func resolveFixtureRefs(v interface{}, ids map[string]interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		if strings.HasPrefix(value, "@@") {
+			return value[1:]
+		}
+		if strings.HasPrefix(value, "@") {
+			return ids[value[1:]]
+		}
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			resolved[key] = resolveFixtureRefs(item, ids)
+		}
+		return resolved
+	case bson.D:
+		resolved := make(bson.D, len(value))
+		for i, e := range value {
+			resolved[i] = bson.E{Key: e.Key, Value: resolveFixtureRefs(e.Value, ids)}
+		}
+		return resolved
+	case []interface{}:
+		resolved := make([]interface{}, len(value))
+		for i, item := range value {
+			resolved[i] = resolveFixtureRefs(item, ids)
+		}
+		return resolved
+	case bson.A:
+		resolved := make(bson.A, len(value))
+		for i, item := range value {
+			resolved[i] = resolveFixtureRefs(item, ids)
+		}
+		return resolved
+	}
+	return v
+}
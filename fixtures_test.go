@@ -0,0 +1,124 @@
+package mongoose_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Novelist struct {
+	BaseSchema `bson:"inline"`
+	Name       string `bson:"name"`
+	Handle     string `bson:"handle"`
+}
+
+func (n Novelist) CollectionName() string {
+	return "novelists"
+}
+
+type Essay struct {
+	BaseSchema  `bson:"inline"`
+	Title       string               `bson:"title"`
+	WriterID    primitive.ObjectID   `bson:"writerId"`
+	Novelist    *Novelist            `bson:"writer,omitempty" ref:"writerId->novelists"`
+	ReviewerIDs []primitive.ObjectID `bson:"reviewerIds"`
+}
+
+func (e Essay) CollectionName() string {
+	return "essays"
+}
+
+const novelistsYAML = `
+essays:
+  essay_hello:
+    title: Hello
+    writerId: "@writer_alice"
+    reviewerIds: ["@writer_bob"]
+novelists:
+  writer_alice:
+    _id: "650000000000000000000001"
+    name: Alice
+    handle: "@@alice"
+  writer_bob:
+    name: Bob
+`
+
+const tagsJSON = `{
+  "tags": {
+    "tag_go": {"name": "go", "writer": "@writer_alice", "createdAt": {"$date": "2024-01-01T00:00:00Z"}}
+  }
+}`
+
+func TestFixtures(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	novelistModel := mongoose.NewModel[Novelist]()
+	novelistModel.SetConnect(connect)
+	essayModel := mongoose.NewModel[Essay]()
+	essayModel.SetConnect(connect)
+
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "novelists.yaml"), []byte(novelistsYAML), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "tags.json"), []byte(tagsJSON), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("ignored"), 0o644))
+
+	fixtures, err := mongoose.ReadFixtures(dir)
+	require.Nil(t, err)
+	require.Nil(t, fixtures.Load(connect, mongoose.FixtureOptions{Reset: true}))
+
+	alice, err := novelistModel.FindOne(bson.M{"name": "Alice"})
+	require.Nil(t, err)
+	require.Equal(t, "650000000000000000000001", alice.ID.Hex())
+	require.Equal(t, "@alice", alice.Handle)
+	require.False(t, alice.CreatedAt.IsZero())
+	require.Equal(t, alice.ID, fixtures.ID("writer_alice"))
+
+	essay, err := essayModel.FindOne(bson.M{"title": "Hello"})
+	require.Nil(t, err)
+	require.Equal(t, alice.ID, essay.WriterID)
+	require.Equal(t, []primitive.ObjectID{fixtures.ID("writer_bob").(primitive.ObjectID)}, essay.ReviewerIDs)
+
+	// Collections without a model are inserted as is
+	var tag bson.M
+	err = connect.Client.Database("test").Collection("tags").FindOne(connect.Ctx, bson.M{"name": "go"}).Decode(&tag)
+	require.Nil(t, err)
+	require.Equal(t, alice.ID, tag["writer"])
+	require.Equal(t, fixtures.ID("tag_go"), tag["_id"])
+
+	// Reset before loading again
+	fixtures, err = mongoose.ReadFixtures(dir)
+	require.Nil(t, err)
+	require.Nil(t, fixtures.Load(connect, mongoose.FixtureOptions{Reset: true}))
+	count, err := novelistModel.Count(nil)
+	require.Nil(t, err)
+	require.Equal(t, int64(2), count)
+}
+
+func TestFixtures_Errors(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	fixtures := &mongoose.Fixtures{}
+	require.Nil(t, fixtures.Parse("yaml", []byte("novelists:\n  a:\n    name: \"@b\"\n  b:\n    name: \"@a\"\n")))
+	err := fixtures.Load(connect)
+	var cycle *mongoose.ErrFixtureCycle
+	require.ErrorAs(t, err, &cycle)
+	require.Equal(t, []string{"a", "b", "a"}, cycle.Names)
+
+	fixtures = &mongoose.Fixtures{}
+	require.Nil(t, fixtures.Parse("json", []byte(`{"novelists": {"a": {"name": "@missing"}}}`)))
+	var unknown *mongoose.ErrUnknownFixture
+	require.ErrorAs(t, fixtures.Load(connect), &unknown)
+	require.Equal(t, "missing", unknown.Name)
+
+	// Duplicate name
+	require.NotNil(t, fixtures.Parse("json", []byte(`{"novelists": {"a": {}}}`)))
+	require.NotNil(t, fixtures.Parse("yaml", []byte("- a\n- b\n")))
+	require.NotNil(t, fixtures.Parse("csv", []byte("")))
+}
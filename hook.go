@@ -1,7 +1,13 @@
 package mongoose
 
 import (
+	"bytes"
+	"context"
+
 	"github.com/tinh-tinh/tinhtinh/v2/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type HookName string
@@ -21,8 +27,21 @@ const (
 	Update            HookName = "update"
 	UpdateMany        HookName = "updateMany"
 	Count             HookName = "count"
+	Aggregate         HookName = "aggregate"
+	BulkWrite         HookName = "bulkWrite"
 )
 
+// HookFnc is the function of a hook. Post hooks of writes receive the
+// result of the write, then the []Change of the written documents, nil
+// unless the model tracks changes:
+//
+//	create, createMany                        (*mongo.InsertOneResult or *mongo.InsertManyResult, []Change)
+//	update, updateMany                        (*mongo.UpdateResult, []Change)
+//	delete, deleteMany                        (*mongo.DeleteResult, []Change)
+//	findOneAndUpdate, findOneAndReplace,
+//	findOneAndDelete                          (M, []Change)
+//	save                                      ([]bson.E, []Change)
+//	bulkWrite                                 (*mongo.BulkWriteResult, []Change)
 type HookFnc[M any] func(params ...any) error
 
 type Hook[M any] struct {
@@ -38,8 +57,7 @@ func ExecutePreHook[M any](hookName HookName, model *Model[M], params ...any) er
 	for _, hook := range hooks {
 		if hook.Async {
 			go hook.Func(params...)
-		} else {
-			err := hook.Func(params...)
+		} else if err := hook.Func(params...); err != nil {
 			return err
 		}
 	}
@@ -53,9 +71,296 @@ func ExecutePostHook[M any](hookName HookName, model *Model[M], params ...any) e
 	for _, hook := range hooks {
 		if hook.Async {
 			go hook.Func(params...)
+		} else if err := hook.Func(params...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Change is a document written by an operation, passed to its post hooks
+// when the model tracks changes.
+type Change struct {
+	ID     interface{}
+	Before bson.Raw // nil for inserts
+	After  bson.Raw // nil for deletes
+}
+
+// tracker records the changes of the writes of a model, e.g. Audit. It runs
+// right after each write with the context of the write, before the post
+// hooks, including for the writes without hooks like Import.
+type tracker func(ctx context.Context, name HookName, changes []Change) error
+
+// DefaultTrackBatchSize is the number of documents read and written at
+// once by the writes of many documents tracking changes, when
+// ModelOptions.TrackBatchSize is zero.
+const DefaultTrackBatchSize = 1000
+
+// tracksChanges reports whether writes read the documents they change.
+func (m *Model[M]) tracksChanges() bool {
+	return m.option.TrackChanges || len(m.trackers) > 0
+}
+
+// track runs the trackers of the model on changes, skipping the documents
+// left unchanged.
+func (m *Model[M]) track(ctx context.Context, name HookName, changes []Change) error {
+	if len(m.trackers) == 0 {
+		return nil
+	}
+	changed := make([]Change, 0, len(changes))
+	for _, change := range changes {
+		if change.Before == nil && change.After == nil {
+			continue
+		}
+		if change.Before != nil && bytes.Equal(change.Before, change.After) {
+			continue
+		}
+		changed = append(changed, change)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	for _, track := range m.trackers {
+		if err := track(ctx, name, changed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns the changes of the documents matching query, with their
+// Before set, when the model tracks changes. limit is zero for every
+// document.
+func (m *Model[M]) snapshot(ctx context.Context, query interface{}, limit int64, sort interface{}) ([]Change, error) {
+	if !m.tracksChanges() {
+		return nil, nil
+	}
+	opt := options.Find()
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+	if sort != nil {
+		opt.SetSort(sort)
+	}
+	cursor, err := m.Collection.Find(ctx, query, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	changes := []Change{}
+	for cursor.Next(ctx) {
+		before := append(bson.Raw(nil), cursor.Current...)
+		change, err := newChange(before, nil)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, cursor.Err()
+}
+
+// snapshotIDs returns the changes of the documents of ids, with the Before
+// of the existing ones, when the model tracks changes.
+func (m *Model[M]) snapshotIDs(ctx context.Context, ids []interface{}) ([]Change, error) {
+	if !m.tracksChanges() || len(ids) == 0 {
+		return nil, nil
+	}
+	existing, err := m.snapshot(ctx, bson.M{"_id": bson.M{"$in": ids}}, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]Change, len(existing))
+	for _, change := range existing {
+		found[idKey(change.ID)] = change
+	}
+	changes := make([]Change, 0, len(ids))
+	for _, id := range ids {
+		key := idKey(id)
+		if change, ok := found[key]; ok {
+			changes = append(changes, change)
+			delete(found, key)
 		} else {
-			return hook.Func(params...)
+			changes = append(changes, Change{ID: id})
+		}
+	}
+	return changes, nil
+}
+
+// newChange returns the change of a document from its before and after
+// versions, one of them being nil.
+func newChange(before, after bson.Raw) (Change, error) {
+	doc := before
+	if doc == nil {
+		doc = after
+	}
+	var id struct {
+		ID interface{} `bson:"_id"`
+	}
+	if err := bson.Unmarshal(doc, &id); err != nil {
+		return Change{}, err
+	}
+	return Change{ID: id.ID, Before: before, After: after}, nil
+}
+
+// trackBatchSize returns the number of documents of a batch of a write
+// tracking changes.
+func (m *Model[M]) trackBatchSize() int {
+	if m.option.TrackBatchSize > 0 {
+		return m.option.TrackBatchSize
+	}
+	return DefaultTrackBatchSize
+}
+
+// writeBatches runs write on the documents matching query. When the model
+// tracks changes, the documents are read by batches in _id order, and
+// write runs on each batch with its changes, their Before set, and a
+// filter restricted to them, so a write of many documents never holds
+// them all. Otherwise write runs once with query and nil changes.
+// Batches resume after the last _id, which MongoDB compares within a
+// BSON type: the _id of the documents of a model must share one.
+func (m *Model[M]) writeBatches(ctx context.Context, query interface{}, write func(filter interface{}, changes []Change) error) error {
+	if !m.tracksChanges() {
+		return write(query, nil)
+	}
+	size := m.trackBatchSize()
+	filter := query
+	for {
+		changes, err := m.snapshot(ctx, filter, int64(size), bson.D{{Key: "_id", Value: 1}})
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		if err := write(changedQuery(filter, changes), changes); err != nil {
+			return err
+		}
+		if len(changes) < size {
+			return nil
+		}
+		last := changes[len(changes)-1].ID
+		filter = bson.D{{Key: "$and", Value: bson.A{query, bson.M{"_id": bson.M{"$gt": last}}}}}
+	}
+}
+
+// keptChanges appends batch to changes when the post hooks receive them,
+// so the writes tracked only for Audit and Temporal do not hold them.
+func (m *Model[M]) keptChanges(changes []Change, batch []Change) []Change {
+	if !m.option.TrackChanges {
+		return nil
+	}
+	if changes == nil {
+		changes = []Change{}
+	}
+	return append(changes, batch...)
+}
+
+// changedQuery restricts query to the documents of changes, so a write
+// only changes the documents of its snapshot.
+func changedQuery(query interface{}, changes []Change) interface{} {
+	if changes == nil {
+		return query
+	}
+	ids := make(bson.A, 0, len(changes))
+	for _, change := range changes {
+		ids = append(ids, change.ID)
+	}
+	return bson.D{{Key: "$and", Value: bson.A{query, bson.M{"_id": bson.M{"$in": ids}}}}}
+}
+
+// reload sets the After of changes to the documents as they are now,
+// leaving it nil for the deleted ones. The documents are read by batches.
+func (m *Model[M]) reload(ctx context.Context, changes []Change) error {
+	size := m.trackBatchSize()
+	for start := 0; start < len(changes); start += size {
+		batch := changes[start:min(start+size, len(changes))]
+		cursor, err := m.Collection.Find(ctx, changedQuery(bson.D{}, batch))
+		if err != nil {
+			return err
+		}
+
+		current := make(map[string]bson.Raw, len(batch))
+		for cursor.Next(ctx) {
+			doc := append(bson.Raw(nil), cursor.Current...)
+			id := doc.Lookup("_id")
+			current[rawIDKey(id.Type, id.Value)] = doc
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range batch {
+			batch[i].After = current[idKey(batch[i].ID)]
 		}
 	}
 	return nil
 }
+
+// reloadOne sets the After of the changes of a FindOneAnd* write returning
+// model. Without a snapshot, model is an upserted document.
+func (m *Model[M]) reloadOne(changes []Change, model M) ([]Change, error) {
+	if changes == nil || len(changes) > 0 {
+		return changes, m.reload(m.Ctx, changes)
+	}
+	after, err := bson.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	change, err := newChange(nil, after)
+	if err != nil {
+		return nil, err
+	}
+	return []Change{change}, nil
+}
+
+// insertedChanges returns the changes of the inserted docs of ids, when
+// the model tracks changes.
+func (m *Model[M]) insertedChanges(ids []interface{}, docs []interface{}) ([]Change, error) {
+	if !m.tracksChanges() {
+		return nil, nil
+	}
+	changes := make([]Change, 0, len(docs))
+	for i, doc := range docs {
+		after, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, Change{ID: ids[i], After: after})
+	}
+	return changes, nil
+}
+
+// afterInsert runs the steps following the insert of docs, of ids, by the
+// write name: it invalidates the cache, records the changes and, unless
+// result is nil, runs the post hook of name with result and the changes.
+func (m *Model[M]) afterInsert(name HookName, result interface{}, ids []interface{}, docs []interface{}) error {
+	if err := m.invalidateCache(); err != nil {
+		return err
+	}
+	changes, err := m.insertedChanges(ids, docs)
+	if err != nil {
+		return err
+	}
+	if err := m.track(m.Ctx, name, changes); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return ExecutePostHook(name, m, result, changes)
+}
+
+// idKey returns a comparable key of an _id value, which may be a document.
+func idKey(id interface{}) string {
+	t, value, err := bson.MarshalValue(id)
+	if err != nil {
+		return ""
+	}
+	return rawIDKey(t, value)
+}
+
+func rawIDKey(t bsontype.Type, value []byte) string {
+	return string([]byte{byte(t)}) + string(value)
+}
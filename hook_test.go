@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/tinh-tinh/mongoose/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type PreTask struct {
@@ -336,3 +337,40 @@ func Test_Validate_Hook(t *testing.T) {
 	})
 	assert.NotNil(t, err)
 }
+
+func Test_Post_Hook_Results(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	model := mongoose.NewModel[Task]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	// Every sync hook runs, in order
+	calls := []string{}
+	model.Pre(mongoose.Update, func(params ...any) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	model.Pre(mongoose.Update, func(params ...any) error {
+		calls = append(calls, "second")
+		return nil
+	})
+
+	var result *mongo.UpdateResult
+	model.Post(mongoose.Update, func(params ...any) error {
+		result = params[0].(*mongo.UpdateResult)
+		return nil
+	})
+	model.Post(mongoose.Update, func(params ...any) error {
+		calls = append(calls, "post")
+		return nil
+	})
+
+	_, err := model.Create(&Task{Name: "1", Status: "todo"})
+	require.Nil(t, err)
+	err = model.Update(bson.M{"name": "1"}, &Task{Status: "done"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"first", "second", "post"}, calls)
+	require.NotNil(t, result)
+	require.Equal(t, int64(1), result.ModifiedCount)
+}
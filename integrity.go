@@ -0,0 +1,254 @@
+package mongoose
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeleteAction is applied to the documents referencing deleted documents.
+// It is set with the onDelete tag of the ref field, e.g.
+// `ref:"departmentId->departments" onDelete:"cascade"`, and enforced when
+// both models are set on the same connection.
+type DeleteAction string
+
+const (
+	NoAction DeleteAction = ""
+	// Restrict fails the delete while documents reference it, checked
+	// before the delete, see ModelOptions.TransactionalDeletes
+	Restrict DeleteAction = "restrict"
+	// Cascade deletes the referencing documents, applying their own actions
+	Cascade DeleteAction = "cascade"
+	// SetNull sets the foreign key to null, or pulls it from array refs
+	SetNull DeleteAction = "setNull"
+)
+
+// ErrDeleteRestricted is returned by deletes when a Restrict ref points
+// to a deleted document.
+type ErrDeleteRestricted struct {
+	Collection string // Collection of the referencing documents
+	Ref        string // Foreign key of the referencing documents
+	Count      int64  // Number of referencing documents
+}
+
+func (e *ErrDeleteRestricted) Error() string {
+	return fmt.Sprintf("cannot delete: %d documents of %s reference it by %s", e.Count, e.Collection, e.Ref)
+}
+
+// refChild is implemented by Model[M] to apply the delete actions of its
+// refs to a deleted parent.
+type refChild interface {
+	childRefs(parent string) []*RefPath
+	restrictDelete(ctx context.Context, refPath *RefPath, values []interface{}) error
+	applyDelete(ctx context.Context, refPath *RefPath, values []interface{}) error
+}
+
+type relation struct {
+	child   refChild
+	refPath *RefPath
+}
+
+// childRefs returns the refs of M to the parent collection with a delete action.
+func (m *Model[M]) childRefs(parent string) []*RefPath {
+	var refs []*RefPath
+	for _, refPath := range GetTypeInfo[M]().RefPaths {
+		if refPath.From == parent && !refPath.Virtual && refPath.OnDelete != NoAction {
+			refs = append(refs, refPath)
+		}
+	}
+	return refs
+}
+
+// relations returns the refs to the model with a delete action, from the
+// models set on its connection.
+func (m *Model[M]) relations() []relation {
+	if m.connect == nil {
+		return nil
+	}
+	var relations []relation
+	for _, model := range m.connect.Models() {
+		child, ok := model.(refChild)
+		if !ok {
+			continue
+		}
+		for _, refPath := range child.childRefs(m.GetName()) {
+			relations = append(relations, relation{child: child, refPath: refPath})
+		}
+	}
+	return relations
+}
+
+// deleteWithRefs runs del on the documents matching query, applying the
+// delete actions of the refs to them. Without refs del receives the query,
+// otherwise the _id of the matched documents, found with findOpt. It runs
+// in a transaction when TransactionalDeletes is set.
+func (m *Model[M]) deleteWithRefs(query interface{}, findOpt *options.FindOptions, del func(ctx context.Context, filter interface{}) error) error {
+	relations := m.relations()
+	if len(relations) == 0 {
+		return del(m.Ctx, query)
+	}
+
+	if !m.option.TransactionalDeletes {
+		return m.applyRefs(m.Ctx, query, findOpt, relations, del)
+	}
+
+	session, err := m.connect.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(m.Ctx)
+	_, err = session.WithTransaction(m.Ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, m.applyRefs(sessionContext, query, findOpt, relations, del)
+	})
+	return err
+}
+
+// applyRefs checks the Restrict refs to the documents matching query,
+// deletes them with del, then applies the Cascade and SetNull refs.
+func (m *Model[M]) applyRefs(ctx context.Context, query interface{}, findOpt *options.FindOptions, relations []relation, del func(ctx context.Context, filter interface{}) error) error {
+	projection := bson.M{"_id": 1}
+	for _, r := range relations {
+		projection[r.refPath.foreignField()] = 1
+	}
+	if findOpt == nil {
+		findOpt = options.Find()
+	}
+	findOpt.SetProjection(projection)
+
+	cursor, err := m.Collection.Find(ctx, query, findOpt)
+	if err != nil {
+		return err
+	}
+	var parents []bson.M
+	if err := cursor.All(ctx, &parents); err != nil {
+		return err
+	}
+
+	ids := make([]interface{}, 0, len(parents))
+	for _, parent := range parents {
+		ids = append(ids, parent["_id"])
+	}
+	values := func(field string) []interface{} {
+		var values []interface{}
+		for _, parent := range parents {
+			if value, ok := parent[field]; ok && value != nil {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+
+	for _, r := range relations {
+		if r.refPath.OnDelete != Restrict || len(parents) == 0 {
+			continue
+		}
+		if err := r.child.restrictDelete(ctx, r.refPath, values(r.refPath.foreignField())); err != nil {
+			return err
+		}
+	}
+
+	if err := del(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return err
+	}
+
+	for _, r := range relations {
+		if r.refPath.OnDelete == Restrict || len(parents) == 0 {
+			continue
+		}
+		if err := r.child.applyDelete(ctx, r.refPath, values(r.refPath.foreignField())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Model[M]) restrictDelete(ctx context.Context, refPath *RefPath, values []interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	count, err := m.Collection.CountDocuments(ctx, bson.M{refPath.ForeignKey: bson.M{"$in": values}})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &ErrDeleteRestricted{Collection: m.GetName(), Ref: refPath.ForeignKey, Count: count}
+	}
+	return nil
+}
+
+// applyDelete deletes or nullifies the documents referencing values by refPath.
+// Cascaded deletes run the DeleteMany hooks and the delete actions of the model.
+func (m *Model[M]) applyDelete(ctx context.Context, refPath *RefPath, values []interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	filter := bson.M{refPath.ForeignKey: bson.M{"$in": values}}
+
+	switch refPath.OnDelete {
+	case Cascade:
+		err := ExecutePreHook(DeleteMany, m, filter)
+		if err != nil {
+			return err
+		}
+		var result *mongo.DeleteResult
+		var changes []Change
+		del := func(ctx context.Context, filter interface{}) error {
+			result, changes = &mongo.DeleteResult{}, nil
+			return m.writeBatches(ctx, filter, func(filter interface{}, batch []Change) error {
+				deleted, err := m.Collection.DeleteMany(ctx, filter)
+				if err != nil {
+					return err
+				}
+				result.DeletedCount += deleted.DeletedCount
+				changes = m.keptChanges(changes, batch)
+				return m.track(ctx, DeleteMany, batch)
+			})
+		}
+		if relations := m.relations(); len(relations) == 0 {
+			err = del(ctx, filter)
+		} else {
+			err = m.applyRefs(ctx, filter, nil, relations, del)
+		}
+		if err != nil {
+			return err
+		}
+		if err := m.invalidateCache(); err != nil {
+			return err
+		}
+		return ExecutePostHook(DeleteMany, m, result, changes)
+	case SetNull:
+		var update bson.M
+		if refPath.Many {
+			update = bson.M{"$pull": bson.M{refPath.ForeignKey: bson.M{"$in": values}}}
+		} else {
+			update = bson.M{"$set": bson.M{refPath.ForeignKey: nil}}
+		}
+		if m.option.Timestamp {
+			if _, exists := GetTypeInfo[M]().FieldsByBson["updatedAt"]; exists {
+				set, _ := update["$set"].(bson.M)
+				if set == nil {
+					set = bson.M{}
+					update["$set"] = set
+				}
+				set["updatedAt"] = time.Now()
+			}
+		}
+		return m.writeBatches(ctx, filter, func(filter interface{}, batch []Change) error {
+			if _, err := m.Collection.UpdateMany(ctx, filter, update); err != nil {
+				return err
+			}
+			if err := m.invalidateCache(); err != nil {
+				return err
+			}
+			if err := m.reload(ctx, batch); err != nil {
+				return err
+			}
+			return m.track(ctx, UpdateMany, batch)
+		})
+	}
+	return nil
+}
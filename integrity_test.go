@@ -0,0 +1,134 @@
+package mongoose_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Team struct {
+	BaseSchema `bson:"inline"`
+	Name       string `bson:"name"`
+}
+
+func (t Team) CollectionName() string {
+	return "teams"
+}
+
+type Player struct {
+	BaseSchema `bson:"inline"`
+	Name       string             `bson:"name"`
+	TeamID     primitive.ObjectID `bson:"teamId"`
+	Team       *Team              `bson:"team,omitempty" ref:"teamId->teams" onDelete:"cascade"`
+}
+
+func (p Player) CollectionName() string {
+	return "players"
+}
+
+type Goal struct {
+	BaseSchema `bson:"inline"`
+	PlayerID   primitive.ObjectID `bson:"playerId"`
+	Player     *Player            `bson:"player,omitempty" ref:"playerId->players" onDelete:"cascade"`
+}
+
+func (g Goal) CollectionName() string {
+	return "goals"
+}
+
+type Fan struct {
+	BaseSchema `bson:"inline"`
+	Name       string               `bson:"name"`
+	TeamIDs    []primitive.ObjectID `bson:"teamIds"`
+	Teams      []*Team              `bson:"teams,omitempty" ref:"teamIds->teams" onDelete:"setNull"`
+}
+
+func (f Fan) CollectionName() string {
+	return "fans"
+}
+
+type Sponsor struct {
+	BaseSchema `bson:"inline"`
+	Name       string             `bson:"name"`
+	TeamID     primitive.ObjectID `bson:"teamId,omitempty"`
+	Team       *Team              `bson:"team,omitempty" ref:"teamId->teams" onDelete:"restrict"`
+}
+
+func (s Sponsor) CollectionName() string {
+	return "sponsors"
+}
+
+func TestOnDelete(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	teamModel := mongoose.NewModel[Team]()
+	teamModel.SetConnect(connect)
+	playerModel := mongoose.NewModel[Player]()
+	playerModel.SetConnect(connect)
+	goalModel := mongoose.NewModel[Goal]()
+	goalModel.SetConnect(connect)
+	fanModel := mongoose.NewModel[Fan]()
+	fanModel.SetConnect(connect)
+	sponsorModel := mongoose.NewModel[Sponsor]()
+	sponsorModel.SetConnect(connect)
+
+	require.Nil(t, sponsorModel.DeleteMany(nil))
+	require.Nil(t, teamModel.DeleteMany(nil))
+	require.Nil(t, playerModel.DeleteMany(nil))
+	require.Nil(t, goalModel.DeleteMany(nil))
+	require.Nil(t, fanModel.DeleteMany(nil))
+
+	teams := []*Team{{Name: "red"}, {Name: "blue"}}
+	_, err := teamModel.CreateMany(teams)
+	require.Nil(t, err)
+	player := &Player{Name: "kai", TeamID: teams[0].ID}
+	_, err = playerModel.Create(player)
+	require.Nil(t, err)
+	_, err = playerModel.Create(&Player{Name: "jin", TeamID: teams[1].ID})
+	require.Nil(t, err)
+	_, err = goalModel.Create(&Goal{PlayerID: player.ID})
+	require.Nil(t, err)
+	_, err = fanModel.Create(&Fan{Name: "fan", TeamIDs: []primitive.ObjectID{teams[0].ID, teams[1].ID}})
+	require.Nil(t, err)
+	_, err = sponsorModel.Create(&Sponsor{Name: "acme", TeamID: teams[1].ID})
+	require.Nil(t, err)
+
+	// Restricted by the sponsor, nothing is deleted
+	err = teamModel.DeleteByID(teams[1].ID)
+	var restricted *mongoose.ErrDeleteRestricted
+	require.ErrorAs(t, err, &restricted)
+	assert.Equal(t, "sponsors", restricted.Collection)
+	assert.Equal(t, int64(1), restricted.Count)
+	count, err := teamModel.Count(nil)
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// Cascades to players and their goals, pulls the team from fans
+	deleted, err := teamModel.FindOneAndDelete(bson.M{"name": "red"})
+	require.Nil(t, err)
+	require.NotNil(t, deleted)
+	assert.Equal(t, "red", deleted.Name)
+
+	players, err := playerModel.Find(nil)
+	require.Nil(t, err)
+	require.Len(t, players, 1)
+	assert.Equal(t, "jin", players[0].Name)
+	count, err = goalModel.Count(nil)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	fan, err := fanModel.FindOne(nil)
+	require.Nil(t, err)
+	assert.Equal(t, []primitive.ObjectID{teams[1].ID}, fan.TeamIDs)
+
+	require.Nil(t, sponsorModel.DeleteMany(nil))
+	require.Nil(t, teamModel.DeleteMany(nil))
+	count, err = playerModel.Count(nil)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
@@ -0,0 +1,318 @@
+package mongoose
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tinh-tinh/tinhtinh/v2/core"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultLoaderWait is the time a Loader waits for more ids before running
+// its query, when ModelOptions.LoaderWait is zero.
+const DefaultLoaderWait = 2 * time.Millisecond
+
+// Loader coalesces the FindByID calls made within a short window into one
+// $in query and caches the results for its lifetime, typically a request.
+// Missing documents are cached as nil, failed loads are not cached.
+// A Loader is safe for concurrent use.
+type Loader[M any] struct {
+	model   *Model[M]
+	ctx     context.Context
+	wait    time.Duration
+	mu      sync.Mutex
+	cache   map[interface{}]*loadResult[M]
+	pending []interface{}
+}
+
+type loadResult[M any] struct {
+	done chan struct{}
+	doc  *M
+	err  error
+}
+
+type loadersKey struct{}
+
+// loaderRegistry holds the loaders of a context, by model.
+type loaderRegistry struct {
+	mu      sync.Mutex
+	loaders map[interface{}]interface{}
+}
+
+// WithLoaders returns a context sharing loaders: Loader returns the same
+// Loader for a model on every call with the returned context.
+func WithLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaderRegistry{loaders: make(map[interface{}]interface{})})
+}
+
+// Loader returns the Loader of the model for ctx. When ctx comes from
+// WithLoaders, the Loader is shared by every call with ctx; otherwise a new
+// Loader is returned. Its queries run with ctx, and loads fail with the
+// error of ctx once it is done.
+func (m *Model[M]) Loader(ctx context.Context) *Loader[M] {
+	registry, ok := ctx.Value(loadersKey{}).(*loaderRegistry)
+	if !ok {
+		return m.newLoader(ctx)
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if loader, ok := registry.loaders[m].(*Loader[M]); ok {
+		return loader
+	}
+	loader := m.newLoader(ctx)
+	registry.loaders[m] = loader
+	return loader
+}
+
+func (m *Model[M]) newLoader(ctx context.Context) *Loader[M] {
+	wait := m.option.LoaderWait
+	if wait == 0 {
+		wait = DefaultLoaderWait
+	}
+	return &Loader[M]{
+		model: m,
+		ctx:   ctx,
+		wait:  wait,
+		cache: make(map[interface{}]*loadResult[M]),
+	}
+}
+
+// Load returns the document with the given id, like FindByID. Concurrent
+// calls are batched into one query running the Find hooks.
+// If no document has the id, Load returns nil, nil.
+func (l *Loader[M]) Load(id interface{}) (*M, error) {
+	res, err := l.start(id)
+	if err != nil {
+		return nil, err
+	}
+	return l.result(res)
+}
+
+// LoadMany returns the documents with the given ids in the same order,
+// nil for missing ones, in one batch.
+func (l *Loader[M]) LoadMany(ids ...interface{}) ([]*M, error) {
+	results := make([]*loadResult[M], 0, len(ids))
+	for _, id := range ids {
+		res, err := l.start(id)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+
+	docs := make([]*M, 0, len(ids))
+	for _, res := range results {
+		doc, err := l.result(res)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// Prime caches doc for id, e.g. after a create or an update.
+func (l *Loader[M]) Prime(id interface{}, doc *M) error {
+	key, err := l.key(id)
+	if err != nil {
+		return err
+	}
+	res := &loadResult[M]{done: make(chan struct{}), doc: doc}
+	close(res.done)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache[key] = res
+	return nil
+}
+
+// Clear removes id from the cache, so the next Load queries it again.
+func (l *Loader[M]) Clear(id interface{}) error {
+	key, err := l.key(id)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, key)
+	return nil
+}
+
+// key returns the _id matched by FindByID for id.
+func (l *Loader[M]) key(id interface{}) (interface{}, error) {
+	query, err := l.model.getQueryId(id)
+	if err != nil {
+		return nil, err
+	}
+	return query["_id"], nil
+}
+
+// start returns the cached result of id, queuing it in the next batch
+// when it is not cached.
+func (l *Loader[M]) start(id interface{}) (*loadResult[M], error) {
+	key, err := l.key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ids that cannot be map keys are loaded on their own
+	if key == nil || !reflect.TypeOf(key).Comparable() {
+		res := &loadResult[M]{done: make(chan struct{})}
+		res.doc, res.err = l.model.WithContext(l.ctx).FindByID(id)
+		close(res.done)
+		return res, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if res, ok := l.cache[key]; ok {
+		return res, nil
+	}
+	res := &loadResult[M]{done: make(chan struct{})}
+	l.cache[key] = res
+	l.pending = append(l.pending, key)
+	if len(l.pending) == 1 {
+		time.AfterFunc(l.wait, l.dispatch)
+	}
+	return res, nil
+}
+
+func (l *Loader[M]) result(res *loadResult[M]) (*M, error) {
+	select {
+	case <-res.done:
+		return res.doc, res.err
+	case <-l.ctx.Done():
+		return nil, l.ctx.Err()
+	}
+}
+
+// dispatch loads the pending ids with one query and resolves their results.
+func (l *Loader[M]) dispatch() {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	results := make([]*loadResult[M], len(keys))
+	for i, key := range keys {
+		results[i] = l.cache[key]
+	}
+	l.mu.Unlock()
+
+	// The query runs with the context of the loader, e.g. of its request
+	docs, err := l.model.WithContext(l.ctx).findByIDs(keys)
+	byID := make(map[interface{}]*M, len(docs))
+	if idField := GetTypeInfo[M]().FieldsByBson["_id"]; idField != nil {
+		for _, doc := range docs {
+			value, fieldErr := reflect.ValueOf(doc).Elem().FieldByIndexErr(idField.IndexPath)
+			if fieldErr != nil {
+				continue
+			}
+			for _, id := range keyValues(value, false) {
+				byID[id] = doc
+			}
+		}
+	}
+
+	l.mu.Lock()
+	for i, key := range keys {
+		res := results[i]
+		if res == nil {
+			continue
+		}
+		if err != nil {
+			res.err = err
+			if l.cache[key] == res {
+				delete(l.cache, key)
+			}
+		} else {
+			res.doc = byID[key]
+		}
+		close(res.done)
+	}
+	l.mu.Unlock()
+}
+
+// findByIDs returns the documents whose _id is in ids, running the Find hooks.
+func (m *Model[M]) findByIDs(ids []interface{}) ([]*M, error) {
+	filter := bson.M{"_id": bson.M{"$in": ids}}
+	err := ExecutePreHook(Find, m, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := ToDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := m.find(query, QueriesOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = ExecutePostHook(Find, m, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// loaderFactory is implemented by Model[M] to create loaders of any model.
+type loaderFactory interface {
+	newLoaderOf(ctx context.Context) interface{}
+}
+
+func (m *Model[M]) newLoaderOf(ctx context.Context) interface{} {
+	return m.newLoader(ctx)
+}
+
+// ForLoaders creates a request scoped module which provides a Loader for
+// each model in the given list, created with the context of the request.
+// The name of the provider is the name of the collection with "Loader_"
+// prefixed. The providers are exported by the module.
+func ForLoaders(models ...ModelCommon) core.Modules {
+	return func(module core.Module) core.Module {
+		loaderModule := module.New(core.NewModuleOptions{Scope: core.Request})
+
+		for _, m := range models {
+			factory, ok := m.(loaderFactory)
+			if !ok {
+				continue
+			}
+			loaderModule.NewProvider(core.ProviderOptions{
+				Name: GetLoaderName(m.GetName()),
+				Factory: func(param ...interface{}) interface{} {
+					req := param[0].(*http.Request)
+					return factory.newLoaderOf(req.Context())
+				},
+				Inject: []core.Provide{core.REQUEST},
+			})
+			loaderModule.Export(GetLoaderName(m.GetName()))
+		}
+
+		return loaderModule
+	}
+}
+
+// GetLoaderName returns a unique name for a loader provider given a collection name.
+// The returned name is in the format "Loader_<collection_name>".
+func GetLoaderName(name string) core.Provide {
+	return core.Provide("Loader_" + name)
+}
+
+// InjectLoader injects the loader provider of M for the current request and
+// returns its value as a *Loader[M]. The loader provider is created by the
+// ForLoaders function.
+func InjectLoader[M any](module core.RefProvider, ctx core.Ctx) *Loader[M] {
+	modelName := GetCachedCollectionName[M]()
+	data, ok := module.Ref(GetLoaderName(modelName), ctx).(*Loader[M])
+	if !ok {
+		return nil
+	}
+
+	return data
+}
@@ -0,0 +1,193 @@
+package mongoose_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"github.com/tinh-tinh/tinhtinh/v2/common"
+	"github.com/tinh-tinh/tinhtinh/v2/core"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Reader struct {
+	BaseSchema `bson:"inline"`
+	Name       string `bson:"name"`
+}
+
+func (r Reader) CollectionName() string {
+	return "readers"
+}
+
+func TestLoader(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Reader]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	var queries atomic.Int32
+	model.Pre(mongoose.Find, func(params ...any) error {
+		queries.Add(1)
+		return nil
+	})
+
+	readers := []*Reader{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	_, err := model.CreateMany(readers)
+	require.Nil(t, err)
+
+	ctx := mongoose.WithLoaders(context.Background())
+	loader := model.Loader(ctx)
+	require.Same(t, loader, model.Loader(ctx))
+
+	var wg sync.WaitGroup
+	names := make([]string, len(readers))
+	for i, reader := range readers {
+		wg.Add(1)
+		go func(i int, id primitive.ObjectID) {
+			defer wg.Done()
+			doc, err := loader.Load(id.Hex())
+			assert.Nil(t, err)
+			if doc != nil {
+				names[i] = doc.Name
+			}
+		}(i, reader.ID)
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+	assert.Equal(t, int32(1), queries.Load())
+
+	// Cached, including missing documents
+	missing := primitive.NewObjectID()
+	docs, err := loader.LoadMany(readers[0].ID, missing)
+	require.Nil(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "a", docs[0].Name)
+	assert.Nil(t, docs[1])
+	doc, err := loader.Load(missing)
+	require.Nil(t, err)
+	assert.Nil(t, doc)
+	assert.Equal(t, int32(2), queries.Load())
+
+	require.Nil(t, loader.Clear(readers[0].ID))
+	_, err = loader.Load(readers[0].ID)
+	require.Nil(t, err)
+	assert.Equal(t, int32(3), queries.Load())
+
+	_, err = loader.Load("invalid")
+	require.NotNil(t, err)
+
+	// Without WithLoaders every call returns a new loader
+	assert.NotSame(t, model.Loader(context.Background()), model.Loader(context.Background()))
+}
+
+func TestLoader_Context(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Reader]()
+	model.SetConnect(connect)
+	created, err := model.Create(&Reader{Name: "slow"})
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	model.Pre(mongoose.Find, func(params ...any) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+	var found atomic.Int32
+	model.Post(mongoose.Find, func(params ...any) error {
+		found.Add(1)
+		return nil
+	})
+
+	loaded := make(chan error)
+	go func() {
+		_, err := model.Loader(ctx).Load(created.InsertedID)
+		loaded <- err
+	}()
+	<-started
+	cancel()
+	require.ErrorIs(t, <-loaded, context.Canceled)
+
+	// The query of the canceled request does not run
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(0), found.Load())
+}
+
+func Test_ModuleLoader(t *testing.T) {
+	readerModel := mongoose.NewModel[Reader]()
+
+	readerController := func(module core.Module) core.Controller {
+		ctrl := module.NewController("readers")
+
+		ctrl.Get("", func(ctx core.Ctx) error {
+			loader := mongoose.InjectLoader[Reader](module, ctx)
+			if loader == nil {
+				return common.InternalServerException(ctx.Res(), "no loader")
+			}
+			data, err := loader.Load(primitive.NewObjectID())
+			if err != nil {
+				return common.InternalServerException(ctx.Res(), err.Error())
+			}
+
+			return ctx.JSON(core.Map{
+				"data": data,
+			})
+		})
+
+		return ctrl
+	}
+
+	readerModule := func(module core.Module) core.Module {
+		readerMod := module.New(core.NewModuleOptions{
+			Imports: []core.Modules{
+				mongoose.ForFeature(readerModel),
+				mongoose.ForLoaders(readerModel),
+			},
+			Controllers: []core.Controllers{readerController},
+		})
+
+		return readerMod
+	}
+
+	appModule := func() core.Module {
+		uri := os.Getenv("MONGO_URI")
+		u, _ := url.Parse(uri)
+
+		u.Path = "/test"
+		modifiedURI := u.String()
+
+		module := core.NewModule(core.NewModuleOptions{
+			Imports: []core.Modules{
+				mongoose.ForRoot(modifiedURI),
+				readerModule,
+			},
+		})
+
+		return module
+	}
+
+	app := core.CreateFactory(appModule)
+	app.SetGlobalPrefix("/app")
+
+	testServer := httptest.NewServer(app.PrepareBeforeListen())
+	defer testServer.Close()
+
+	testClient := testServer.Client()
+
+	resp, err := testClient.Get(testServer.URL + "/app/readers")
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+}
@@ -0,0 +1,251 @@
+package mongoose
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultLockCollection is the collection of the locks of Connect.Locks.
+	DefaultLockCollection = "mongoose_locks"
+	DefaultLockTTL        = 30 * time.Second
+)
+
+// lockCounter is the _id of the document holding the last token issued by
+// the collection. It is not a string, so no lock name matches it, and it
+// has no expiresAt, so the TTL index never removes it.
+var lockCounter = bson.D{{Key: "counter", Value: "token"}}
+
+var (
+	// ErrLockHeld is returned by Acquire when another owner holds the lock.
+	ErrLockHeld = errors.New("lock is held by another owner")
+	// ErrLockLost is returned by Renew when the lock expired and may have
+	// been acquired by another owner.
+	ErrLockLost = errors.New("lock was lost")
+)
+
+// LockManager hands out named locks stored in a collection. Each
+// acquisition gets a fencing token greater than the ones of the previous
+// acquisitions of the name, so resources can reject the writes of an owner
+// which lost the lock. The documents of released or expired locks are
+// removed by a TTL index on expiresAt; the tokens are drawn from a counter
+// document of the collection, so they keep growing after that.
+type LockManager struct {
+	Collection *mongo.Collection
+}
+
+// NewLockManager returns a LockManager storing the locks in name or
+// DefaultLockCollection of the connection database, and creates the TTL
+// index of the collection.
+func NewLockManager(connect *Connect, name ...string) *LockManager {
+	collection := DefaultLockCollection
+	if len(name) > 0 && name[0] != "" {
+		collection = name[0]
+	}
+	lm := &LockManager{Collection: connect.Client.Database(connect.DB).Collection(collection)}
+	_, err := lm.Collection.Indexes().CreateOne(connect.Ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return lm
+}
+
+// Locks returns the LockManager of the connection, stored in
+// DefaultLockCollection.
+func (c *Connect) Locks() *LockManager {
+	c.locksOnce.Do(func() {
+		c.locks = NewLockManager(c)
+	})
+	return c.locks
+}
+
+// Lock is an acquired lock, held until it is released or expires.
+type Lock struct {
+	Name  string
+	Token int64 // Fencing token of the acquisition
+	owner string
+	ttl   time.Duration
+	coll  *mongo.Collection
+
+	once sync.Once
+	done chan struct{}
+	mu   sync.Mutex
+	stop context.CancelFunc
+}
+
+// Acquire takes the lock name for ttl, or returns ErrLockHeld.
+func (lm *LockManager) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return lm.acquire(ctx, name, consumerName(), ttl)
+}
+
+// acquire takes the lock name for owner.
+func (lm *LockManager) acquire(ctx context.Context, name string, owner string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+
+	// A held lock does not match, and the upsert fails on its _id. Owners
+	// are unique to each acquisition.
+	now := time.Now()
+	_, err := lm.Collection.UpdateOne(ctx,
+		bson.M{"_id": name, "expiresAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrLockHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The token is drawn while the lock is held, so tokens follow the order
+	// of the acquisitions. If the lock expired and was taken meanwhile, the
+	// token is not set and the acquisition fails.
+	var counter struct {
+		Token int64 `bson:"token"`
+	}
+	err = lm.Collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": lockCounter},
+		bson.M{"$inc": bson.M{"token": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return nil, err
+	}
+	result, err := lm.Collection.UpdateOne(ctx,
+		bson.M{"_id": name, "owner": owner},
+		bson.M{"$set": bson.M{"token": counter.Token}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrLockHeld
+	}
+
+	return &Lock{
+		Name:  name,
+		Token: counter.Token,
+		owner: owner,
+		ttl:   ttl,
+		coll:  lm.Collection,
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// Renew extends the lock for its ttl, or returns ErrLockLost.
+func (l *Lock) Renew(ctx context.Context) error {
+	result, err := l.coll.UpdateOne(ctx,
+		bson.M{"_id": l.Name, "owner": l.owner, "token": l.Token},
+		bson.M{"$set": bson.M{"expiresAt": time.Now().Add(l.ttl)}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		l.close()
+		return ErrLockLost
+	}
+	return nil
+}
+
+// AutoRenew renews the lock every third of its ttl until it is released,
+// lost or ctx is done. Done is closed when a renewal fails.
+func (l *Lock) AutoRenew(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	l.mu.Lock()
+	l.stop = cancel
+	l.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.done:
+				return
+			case <-ticker.C:
+				if err := l.Renew(ctx); err != nil && ctx.Err() == nil {
+					l.close()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Done is closed when the lock is released or lost.
+func (l *Lock) Done() <-chan struct{} {
+	return l.done
+}
+
+// Release stops the renewals and frees the lock, unless another owner took
+// it after it expired. The document of the lock is then removed by the
+// TTL index.
+func (l *Lock) Release(ctx context.Context) error {
+	l.close()
+	_, err := l.coll.UpdateOne(ctx,
+		bson.M{"_id": l.Name, "owner": l.owner, "token": l.Token},
+		bson.M{"$set": bson.M{"owner": "", "expiresAt": time.Now()}},
+	)
+	return err
+}
+
+func (l *Lock) close() {
+	l.once.Do(func() {
+		l.mu.Lock()
+		stop := l.stop
+		l.mu.Unlock()
+		if stop != nil {
+			stop()
+		}
+		close(l.done)
+	})
+}
+
+// WithLock runs fn while holding the lock name, renewed automatically, and
+// releases it after. It returns ErrLockHeld without running fn when the
+// lock is held. The context of fn is canceled when the lock is lost.
+func (lm *LockManager) WithLock(ctx context.Context, name string, fn func(ctx context.Context, lock *Lock) error, ttl ...time.Duration) error {
+	lockTTL := DefaultLockTTL
+	if len(ttl) > 0 {
+		lockTTL = ttl[0]
+	}
+	return lm.withLock(ctx, name, consumerName(), lockTTL, fn)
+}
+
+// withLock runs fn while owner holds the lock name.
+func (lm *LockManager) withLock(ctx context.Context, name string, owner string, ttl time.Duration, fn func(ctx context.Context, lock *Lock) error) error {
+	lock, err := lm.acquire(ctx, name, owner, ttl)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(context.Background())
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lock.AutoRenew(lockCtx)
+	go func() {
+		select {
+		case <-lock.Done():
+			cancel()
+		case <-lockCtx.Done():
+		}
+	}()
+
+	return fn(lockCtx, lock)
+}
@@ -0,0 +1,171 @@
+package mongoose_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLock(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	locks := connect.Locks()
+	require.Same(t, locks, connect.Locks())
+	ctx := context.Background()
+
+	lock, err := locks.Acquire(ctx, "cron:report", 200*time.Millisecond)
+	require.Nil(t, err)
+
+	_, err = locks.Acquire(ctx, "cron:report", time.Second)
+	require.ErrorIs(t, err, mongoose.ErrLockHeld)
+	require.Nil(t, lock.Renew(ctx))
+
+	// Expired locks can be taken with a greater fencing token
+	time.Sleep(300 * time.Millisecond)
+	next, err := locks.Acquire(ctx, "cron:report", time.Second)
+	require.Nil(t, err)
+	require.Greater(t, next.Token, lock.Token)
+
+	require.ErrorIs(t, lock.Renew(ctx), mongoose.ErrLockLost)
+	<-lock.Done()
+	require.Nil(t, lock.Release(ctx))
+
+	_, err = locks.Acquire(ctx, "cron:report", time.Second)
+	require.ErrorIs(t, err, mongoose.ErrLockHeld)
+
+	require.Nil(t, next.Release(ctx))
+	again, err := locks.Acquire(ctx, "cron:report", time.Second)
+	require.Nil(t, err)
+	require.Nil(t, again.Release(ctx))
+}
+
+func TestWithLock(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	locks := connect.Locks()
+	ctx := context.Background()
+
+	ran := false
+	err := locks.WithLock(ctx, "cron:cleanup", func(ctx context.Context, lock *mongoose.Lock) error {
+		ran = true
+		// Held past its ttl thanks to the renewals
+		time.Sleep(300 * time.Millisecond)
+		require.Nil(t, ctx.Err())
+
+		err := locks.WithLock(ctx, "cron:cleanup", func(ctx context.Context, lock *mongoose.Lock) error {
+			t.Fatal("lock is held")
+			return nil
+		})
+		require.ErrorIs(t, err, mongoose.ErrLockHeld)
+		return nil
+	}, 150*time.Millisecond)
+	require.Nil(t, err)
+	require.True(t, ran)
+
+	// Released after fn
+	err = locks.WithLock(ctx, "cron:cleanup", func(ctx context.Context, lock *mongoose.Lock) error {
+		return nil
+	})
+	require.Nil(t, err)
+}
+
+func TestLock_FencingOrder(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	locks := connect.Locks()
+	ctx := context.Background()
+	_, err := locks.Collection.DeleteOne(ctx, bson.M{"_id": "cron:fence"})
+	require.Nil(t, err)
+
+	// A acquires then stalls past its ttl, B takes the lock and lets it
+	// expire, then A acquires again: its new token is above the one of B
+	first, err := locks.Acquire(ctx, "cron:fence", 100*time.Millisecond)
+	require.Nil(t, err)
+	time.Sleep(150 * time.Millisecond)
+	second, err := locks.Acquire(ctx, "cron:fence", 100*time.Millisecond)
+	require.Nil(t, err)
+	require.Greater(t, second.Token, first.Token)
+	time.Sleep(150 * time.Millisecond)
+	third, err := locks.Acquire(ctx, "cron:fence", time.Second)
+	require.Nil(t, err)
+	require.Greater(t, third.Token, second.Token)
+
+	// Tokens keep growing after a release
+	require.Nil(t, third.Release(ctx))
+	fourth, err := locks.Acquire(ctx, "cron:fence", time.Second)
+	require.Nil(t, err)
+	require.Greater(t, fourth.Token, third.Token)
+	require.Nil(t, fourth.Release(ctx))
+
+	// Concurrent acquisitions of a free lock: a single one wins
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acquired := []*mongoose.Lock{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := locks.Acquire(ctx, "cron:fence", time.Second)
+			if err == nil {
+				mu.Lock()
+				acquired = append(acquired, lock)
+				mu.Unlock()
+			} else {
+				require.ErrorIs(t, err, mongoose.ErrLockHeld)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, acquired, 1)
+	require.Equal(t, fourth.Token+1, acquired[0].Token)
+	require.Nil(t, acquired[0].Release(ctx))
+}
+
+func TestLock_Expiry(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	locks := connect.Locks()
+	ctx := context.Background()
+
+	specs, err := locks.Collection.Indexes().ListSpecifications(ctx)
+	require.Nil(t, err)
+	ttl := false
+	for _, spec := range specs {
+		if spec.Name == "expiresAt_1" && spec.ExpireAfterSeconds != nil {
+			ttl = true
+		}
+	}
+	require.True(t, ttl)
+
+	lock, err := locks.Acquire(ctx, "cron:expiry", time.Second)
+	require.Nil(t, err)
+	require.Nil(t, lock.Release(ctx))
+
+	// The TTL index removed the document of the lock
+	_, err = locks.Collection.DeleteOne(ctx, bson.M{"_id": "cron:expiry"})
+	require.Nil(t, err)
+	next, err := locks.Acquire(ctx, "cron:expiry", time.Second)
+	require.Nil(t, err)
+	require.Greater(t, next.Token, lock.Token)
+
+	// Released while renewing
+	next.AutoRenew(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		require.Nil(t, next.Release(ctx))
+	}()
+	wg.Wait()
+	<-next.Done()
+}
@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+var migrationTemplate = template.Must(template.New("migration").Parse(`package {{.Package}}
+
+import (
+	"context"
+
+	"github.com/tinh-tinh/mongoose/v2/migrate"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func init() {
+	migrate.Register(&migrate.Migration{
+		Version:     "{{.Version}}",
+		Description: "{{.Description}}",
+		// Change it when editing the migration after it was applied
+		Checksum: "v1",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return nil
+		},
+	})
+}
+`))
+
+// Create writes an empty migration named name in dir, registered in the
+// package of the directory, and returns its path.
+func Create(dir string, name string) (string, error) {
+	description := strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if description == "" {
+		return "", fmt.Errorf("invalid migration name %q", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	pkg := nonWord.ReplaceAllString(strings.ToLower(filepath.Base(abs)), "")
+	if pkg == "" || (pkg[0] >= '0' && pkg[0] <= '9') {
+		pkg = "migrations"
+	}
+
+	version := Version(time.Now())
+	path := filepath.Join(dir, version+"_"+description+".go")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	err = migrationTemplate.Execute(file, map[string]string{
+		"Package":     pkg,
+		"Version":     version,
+		"Description": description,
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
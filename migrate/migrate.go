@@ -0,0 +1,344 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultCollection is the collection recording the applied migrations.
+	DefaultCollection = "mongoose_migrations"
+	DefaultLockTTL    = time.Minute
+)
+
+var (
+	// ErrIrreversible is returned by Down for a migration without Down.
+	ErrIrreversible = errors.New("migration has no down")
+)
+
+// ErrChecksumMismatch is returned by Up when an applied migration was
+// modified since it ran.
+type ErrChecksumMismatch struct {
+	Version string
+}
+
+func (e ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("migration %s was modified after it was applied", e.Version)
+}
+
+// Migration changes the database from one version to the next.
+type Migration struct {
+	// Version orders the migrations, compared as strings, e.g. the
+	// 20060102150405 timestamps of Create
+	Version     string
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+	// Transaction runs Up and Down in a transaction with the record of the
+	// migration. Index builds and collection creation cannot run in one.
+	Transaction bool
+	// Checksum detects the migrations modified after they ran: change it,
+	// e.g. from "v1" to "v2", when editing an applied migration. Up fails
+	// when it differs from the recorded one. Migrations without a checksum
+	// are not checked.
+	Checksum string
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Migration
+)
+
+// Register adds a migration to the default migrations, usually from the
+// init function of the files generated by Create.
+func Register(migration *Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, migration)
+}
+
+// Registered returns the default migrations.
+func Registered() []*Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]*Migration(nil), registry...)
+}
+
+// Record is the document of an applied migration.
+type Record struct {
+	Version     string        `bson:"_id"`
+	Description string        `bson:"description"`
+	Checksum    string        `bson:"checksum,omitempty"`
+	AppliedAt   time.Time     `bson:"appliedAt"`
+	Duration    time.Duration `bson:"duration"`
+}
+
+// Status is the state of a migration.
+type Status struct {
+	Version     string
+	Description string
+	AppliedAt   time.Time // Zero when pending
+	Modified    bool      // Applied with another checksum
+	Missing     bool      // Applied but not registered
+}
+
+type Options struct {
+	Collection string         // DefaultCollection when empty
+	LockTTL    time.Duration  // DefaultLockTTL when zero
+	Migrations []*Migration   // Registered migrations when nil
+	Logger     func(v ...any) // Called with the progress of Up and Down when set
+}
+
+// Migrator applies migrations to the database of a connection. Runners
+// share a lock, so concurrent runners apply each migration once.
+type Migrator struct {
+	connect    *mongoose.Connect
+	collection *mongo.Collection
+	opt        Options
+	migrations []*Migration
+}
+
+// New returns a Migrator for the database of connect.
+func New(connect *mongoose.Connect, opts ...Options) *Migrator {
+	var opt Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Collection == "" {
+		opt.Collection = DefaultCollection
+	}
+	if opt.LockTTL <= 0 {
+		opt.LockTTL = DefaultLockTTL
+	}
+	if opt.Migrations == nil {
+		opt.Migrations = Registered()
+	}
+
+	migrations := append([]*Migration(nil), opt.Migrations...)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for _, migration := range migrations {
+		if migration.Checksum == "" && opt.Logger != nil {
+			opt.Logger("migration", migration.Version, "has no checksum, its changes are not detected")
+		}
+	}
+
+	return &Migrator{
+		connect:    connect,
+		collection: connect.Client.Database(connect.DB).Collection(opt.Collection),
+		opt:        opt,
+		migrations: migrations,
+	}
+}
+
+// Up applies the pending migrations up to target, or all of them. It
+// returns the versions applied.
+func (m *Migrator) Up(ctx context.Context, target ...string) ([]string, error) {
+	var applied []string
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		records, err := m.records(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if len(target) > 0 && target[0] != "" && migration.Version > target[0] {
+				break
+			}
+			if record, ok := records[migration.Version]; ok {
+				if modified(record, migration) {
+					return ErrChecksumMismatch{Version: migration.Version}
+				}
+				continue
+			}
+			if err := m.apply(ctx, migration); err != nil {
+				return fmt.Errorf("migration %s: %w", migration.Version, err)
+			}
+			applied = append(applied, migration.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations. It returns the versions
+// reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]string, error) {
+	var reverted []string
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		records, err := m.records(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := records[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("migration %s: %w", migration.Version, ErrIrreversible)
+			}
+			if err := m.revert(ctx, migration); err != nil {
+				return fmt.Errorf("migration %s: %w", migration.Version, err)
+			}
+			reverted = append(reverted, migration.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns the state of the registered migrations, followed by the
+// applied ones which are not registered.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Description: migration.Description}
+		if record, ok := records[migration.Version]; ok {
+			status.AppliedAt = record.AppliedAt
+			status.Modified = modified(record, migration)
+			delete(records, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	var missing []Status
+	for _, record := range records {
+		missing = append(missing, Status{
+			Version:     record.Version,
+			Description: record.Description,
+			AppliedAt:   record.AppliedAt,
+			Missing:     true,
+		})
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Version < missing[j].Version })
+	return append(statuses, missing...), nil
+}
+
+// Pending returns the versions of the migrations not applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]string, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedAt.IsZero() {
+			pending = append(pending, status.Version)
+		}
+	}
+	return pending, nil
+}
+
+// withLock calls fnc holding the lock of the migrations, waiting for the
+// other runners to finish.
+func (m *Migrator) withLock(ctx context.Context, fnc func(ctx context.Context) error) error {
+	for {
+		err := m.connect.Locks().WithLock(ctx, "migrate:"+m.collection.Name(), func(ctx context.Context, _ *mongoose.Lock) error {
+			return fnc(ctx)
+		}, m.opt.LockTTL)
+		if !errors.Is(err, mongoose.ErrLockHeld) {
+			return err
+		}
+		m.log("waiting for another runner")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (m *Migrator) records(ctx context.Context) (map[string]*Record, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	byVersion := make(map[string]*Record, len(records))
+	for _, record := range records {
+		byVersion[record.Version] = record
+	}
+	return byVersion, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration *Migration) error {
+	m.log("applying", migration.Version, migration.Description)
+	start := time.Now()
+	return m.run(ctx, migration.Transaction, func(ctx context.Context) error {
+		if migration.Up != nil {
+			if err := migration.Up(ctx, m.collection.Database()); err != nil {
+				return err
+			}
+		}
+		_, err := m.collection.InsertOne(ctx, &Record{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Checksum:    migration.Checksum,
+			AppliedAt:   time.Now(),
+			Duration:    time.Since(start),
+		})
+		return err
+	})
+}
+
+func (m *Migrator) revert(ctx context.Context, migration *Migration) error {
+	m.log("reverting", migration.Version, migration.Description)
+	return m.run(ctx, migration.Transaction, func(ctx context.Context) error {
+		if err := migration.Down(ctx, m.collection.Database()); err != nil {
+			return err
+		}
+		_, err := m.collection.DeleteOne(ctx, bson.M{"_id": migration.Version})
+		return err
+	})
+}
+
+// run calls fnc, in a transaction when transactional.
+func (m *Migrator) run(ctx context.Context, transactional bool, fnc func(ctx context.Context) error) error {
+	if !transactional {
+		return fnc(ctx)
+	}
+	session, err := m.connect.Client.StartSession()
+	if err != nil {
+		return err
+	}
+
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, fnc(sessionContext)
+	}, options.Transaction())
+
+	return err
+}
+
+func (m *Migrator) log(v ...any) {
+	if m.opt.Logger != nil {
+		m.opt.Logger(v...)
+	}
+}
+
+func modified(record *Record, migration *Migration) bool {
+	return record.Checksum != "" && migration.Checksum != "" && record.Checksum != migration.Checksum
+}
+
+// Version returns a migration version for t, as used by Create.
+func Version(t time.Time) string {
+	return t.UTC().Format("20060102150405")
+}
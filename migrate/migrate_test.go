@@ -0,0 +1,165 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"github.com/tinh-tinh/mongoose/v2/migrate"
+	"github.com/tinh-tinh/tinhtinh/v2/core"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func migrations(calls *[]string) []*migrate.Migration {
+	step := func(name string) func(ctx context.Context, db *mongo.Database) error {
+		return func(ctx context.Context, db *mongo.Database) error {
+			*calls = append(*calls, name)
+			return nil
+		}
+	}
+	return []*migrate.Migration{
+		{Version: "2", Description: "backfill", Up: step("up 2"), Down: step("down 2"), Transaction: true, Checksum: "v1"},
+		{Version: "1", Description: "add email", Up: step("up 1"), Down: step("down 1"), Checksum: "v1"},
+		{Version: "3", Description: "index", Up: step("up 3")},
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	ctx := context.Background()
+	_, err := connect.Client.Database("test").Collection(migrate.DefaultCollection).DeleteMany(ctx, bson.M{})
+	require.Nil(t, err)
+
+	var calls []string
+	migrator := migrate.New(connect, migrate.Options{Migrations: migrations(&calls)})
+
+	applied, err := migrator.Up(ctx, "2")
+	require.Nil(t, err)
+	require.Equal(t, []string{"1", "2"}, applied)
+
+	pending, err := migrator.Pending(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []string{"3"}, pending)
+
+	applied, err = migrator.Up(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []string{"3"}, applied)
+
+	// 3 has no down
+	_, err = migrator.Down(ctx, 1)
+	require.True(t, errors.Is(err, migrate.ErrIrreversible))
+
+	statuses, err := migrator.Status(ctx)
+	require.Nil(t, err)
+	require.Len(t, statuses, 3)
+	require.False(t, statuses[0].AppliedAt.IsZero())
+	require.NotEmpty(t, statuses[0].Description)
+	require.Equal(t, []string{"up 1", "up 2", "up 3"}, calls)
+
+	// Applied migrations which are no longer registered
+	calls = nil
+	migrator = migrate.New(connect, migrate.Options{Migrations: migrations(&calls)[:2]})
+	statuses, err = migrator.Status(ctx)
+	require.Nil(t, err)
+	require.Len(t, statuses, 3)
+	require.True(t, statuses[2].Missing)
+
+	reverted, err := migrator.Down(ctx, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"2", "1"}, reverted)
+	require.Equal(t, []string{"down 2", "down 1"}, calls)
+}
+
+func TestMigrator_Checksum(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	ctx := context.Background()
+	_, err := connect.Client.Database("test").Collection("checksum_migrations").DeleteMany(ctx, bson.M{})
+	require.Nil(t, err)
+
+	var calls []string
+	list := migrations(&calls)
+	migrator := migrate.New(connect, migrate.Options{Collection: "checksum_migrations", Migrations: list})
+	_, err = migrator.Up(ctx)
+	require.Nil(t, err)
+
+	// Migrations without a checksum are not checked
+	list = migrations(&calls)
+	list[2].Up = func(ctx context.Context, db *mongo.Database) error { return nil }
+	migrator = migrate.New(connect, migrate.Options{Collection: "checksum_migrations", Migrations: list})
+	_, err = migrator.Up(ctx)
+	require.Nil(t, err)
+
+	list = migrations(&calls)
+	list[1].Checksum = "v2"
+	migrator = migrate.New(connect, migrate.Options{Collection: "checksum_migrations", Migrations: list})
+	_, err = migrator.Up(ctx)
+	require.Equal(t, migrate.ErrChecksumMismatch{Version: "1"}, err)
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+
+	path, err := migrate.Create(dir, "Add users email")
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(path, "_add_users_email.go"))
+
+	content, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Contains(t, string(content), "package migrations")
+	require.Contains(t, string(content), `Description: "add_users_email"`)
+	require.Contains(t, string(content), `Checksum: "v1"`)
+
+	_, err = migrate.Create(dir, "!!")
+	require.NotNil(t, err)
+}
+
+func Test_Module(t *testing.T) {
+	var calls []string
+	appModule := func() core.Module {
+		connect := mongoose.New(os.Getenv("MONGO_URI"))
+		connect.SetDB("test")
+		_, err := connect.Client.Database("test").Collection("module_migrations").DeleteMany(context.Background(), bson.M{})
+		require.Nil(t, err)
+
+		module := core.NewModule(core.NewModuleOptions{
+			Imports: []core.Modules{
+				mongoose.ForRootFactory(func(ref core.RefProvider) *mongoose.Connect {
+					return connect
+				}),
+				migrate.ForRoot(migrate.Options{Collection: "module_migrations", Migrations: migrations(&calls)}),
+			},
+		})
+		return module
+	}
+
+	module := appModule()
+	require.NotNil(t, migrate.InjectMigrator(module))
+	require.Equal(t, []string{"up 1", "up 2", "up 3"}, calls)
+}
+
+func TestMigrator_NoChecksum(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	var logs []string
+	var calls []string
+	list := migrations(&calls)
+	migrate.New(connect, migrate.Options{Migrations: list, Logger: func(v ...any) {
+		logs = append(logs, fmt.Sprint(v...))
+	}})
+	require.Len(t, logs, 1)
+	require.Contains(t, logs[0], "3")
+	// The migrations are left as registered
+	require.Empty(t, list[2].Checksum)
+}
@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tinh-tinh/mongoose/v2"
+	"github.com/tinh-tinh/tinhtinh/v2/core"
+)
+
+const MIGRATOR core.Provide = "MIGRATOR"
+
+// ForRoot creates a module which applies the pending migrations with the
+// CONNECT_MONGO provider when the application starts, and provides the
+// Migrator as MIGRATOR. It panics when a migration fails, like a failed
+// connection in mongoose.ForRoot.
+func ForRoot(opts ...Options) core.Modules {
+	return func(module core.Module) core.Module {
+		migrateModule := module.New(core.NewModuleOptions{})
+		migrateModule.NewProvider(core.ProviderOptions{
+			Name: MIGRATOR,
+			Factory: func(param ...interface{}) interface{} {
+				connect := param[0].(*mongoose.Connect)
+				migrator := New(connect, opts...)
+				if _, err := migrator.Up(context.Background()); err != nil {
+					panic(fmt.Sprintf("Failed to migrate MongoDB: %v", err.Error()))
+				}
+
+				return migrator
+			},
+			Inject: []core.Provide{mongoose.CONNECT_MONGO},
+		})
+		migrateModule.Export(MIGRATOR)
+
+		return migrateModule
+	}
+}
+
+// InjectMigrator injects the MIGRATOR provider and returns its value as a
+// *Migrator. The MIGRATOR provider is created by the ForRoot function.
+func InjectMigrator(module core.RefProvider) *Migrator {
+	data, ok := module.Ref(MIGRATOR).(*Migrator)
+	if !ok {
+		return nil
+	}
+
+	return data
+}
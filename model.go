@@ -22,22 +22,55 @@ type ModelCommon interface {
 }
 
 type Model[M any] struct {
-	option     *ModelOptions
-	docs       []bson.E
-	connect    *Connect
-	indexes    []mongo.IndexModel
-	preHooks   []Hook[M]
-	postHooks  []Hook[M]
-	Ctx        context.Context
-	Collection *mongo.Collection
+	option      *ModelOptions
+	docs        []bson.E
+	connect     *Connect
+	indexes     []mongo.IndexModel
+	preHooks    []Hook[M]
+	postHooks   []Hook[M]
+	changeHooks []changeHook[M]
+	trackers    []tracker
+	audit       *auditor
+	temporal    *temporal
+	Ctx         context.Context
+	Collection  *mongo.Collection
+	cacheOpt    *CacheOptions
 }
 
 type ModelOptions struct {
+	ReadOptions   // Default read settings for Find, FindOne, Count and Aggregate
 	Timestamp     bool
 	ID            bool
 	Validation    bool
 	StrictFilters bool // When true, rejects filters containing MongoDB operators
 	Indexes       []mongo.IndexModel
+	// MaxPopulateDepth is the number of refs a populate path may follow,
+	// DefaultMaxPopulateDepth when zero
+	MaxPopulateDepth int
+	// PopulateStrategy is the strategy of populate paths without one,
+	// PopulateLookup when PopulateDefault
+	PopulateStrategy PopulateStrategy
+	// TransactionalDeletes runs deletes applying onDelete actions of refs
+	// in a transaction, so a failed action rolls back the whole delete.
+	// Without it, the Restrict check and the delete are separate writes: a
+	// document referencing a deleted one can be written in between, and a
+	// failed Cascade or SetNull leaves the delete done. Even in a
+	// transaction, the referencing collections are not locked, so a
+	// referencing document inserted concurrently is not detected.
+	TransactionalDeletes bool
+	// LoaderWait is the time a Loader waits for more ids before running
+	// its query, DefaultLoaderWait when zero
+	LoaderWait time.Duration
+	// Cache enables a read-through cache of FindByID and selected FindOne calls
+	Cache *CacheOptions
+	// TrackChanges passes the documents before and after each write to the
+	// post hooks, at the cost of reading them. Audit and Temporal track the
+	// changes without it.
+	TrackChanges bool
+	// TrackBatchSize is the number of documents read and written at once by
+	// UpdateMany, DeleteMany and the onDelete actions of refs when the model
+	// tracks changes, DefaultTrackBatchSize when zero
+	TrackBatchSize int
 }
 
 // NewModel returns a new instance of Model[M] with the given connect and name
@@ -55,8 +88,9 @@ func NewModel[M any](opts ...ModelOptions) *Model[M] {
 	}
 
 	return &Model[M]{
-		option:  &defaultOption,
-		indexes: defaultOption.Indexes,
+		option:   &defaultOption,
+		indexes:  defaultOption.Indexes,
+		cacheOpt: newCache(defaultOption.Cache),
 	}
 }
 
@@ -67,6 +101,7 @@ func (m *Model[M]) SetConnect(connect *Connect) {
 	m.Ctx = connect.Ctx
 	m.connect = connect
 	m.Collection = connect.Client.Database(connect.DB).Collection(m.GetName())
+	connect.register(m)
 
 	if len(m.indexes) > 0 {
 		_, err := m.Collection.Indexes().CreateMany(m.Ctx, m.indexes)
@@ -74,12 +109,39 @@ func (m *Model[M]) SetConnect(connect *Connect) {
 			log.Println(err)
 		}
 	}
+	if m.audit != nil {
+		m.createAuditIndex()
+	}
+	if m.temporal != nil {
+		m.createVersionIndexes()
+	}
 }
 
 func (m *Model[M]) SetContext(ctx context.Context) {
 	m.Ctx = ctx
 }
 
+// WithContext returns a copy of the model running its operations with ctx,
+// e.g. the context of a request with its actor for Audit, so concurrent
+// requests can share the model. The copy shares the options and hooks of
+// the model; hooks added to it later are not added to the model.
+func (m *Model[M]) WithContext(ctx context.Context) *Model[M] {
+	return &Model[M]{
+		option:      m.option,
+		connect:     m.connect,
+		indexes:     slices.Clip(m.indexes),
+		preHooks:    slices.Clip(m.preHooks),
+		postHooks:   slices.Clip(m.postHooks),
+		changeHooks: slices.Clip(m.changeHooks),
+		trackers:    slices.Clip(m.trackers),
+		audit:       m.audit,
+		temporal:    m.temporal,
+		Ctx:         ctx,
+		Collection:  m.Collection,
+		cacheOpt:    m.cacheOpt,
+	}
+}
+
 // GetName returns the name of the collection in the database
 // Uses cached type info to avoid repeated reflection calls
 func (m *Model[M]) GetName() string {
@@ -134,6 +196,7 @@ func (m *Model[M]) Save() error {
 		return nil
 	}
 
+	var changes []Change
 	idIndex := slices.IndexFunc(m.docs, func(e bson.E) bool {
 		return e.Key == "_id"
 	})
@@ -153,7 +216,11 @@ func (m *Model[M]) Save() error {
 			)
 		}
 
-		_, err := m.Collection.InsertOne(m.Ctx, inserts)
+		result, err := m.Collection.InsertOne(m.Ctx, inserts)
+		if err != nil {
+			return err
+		}
+		changes, err = m.insertedChanges([]interface{}{result.InsertedID}, []interface{}{inserts})
 		if err != nil {
 			return err
 		}
@@ -164,13 +231,28 @@ func (m *Model[M]) Save() error {
 		if m.option.Timestamp {
 			updates = append(updates, bson.E{Key: "updatedAt", Value: time.Now()})
 		}
+		changes, err = m.snapshotIDs(m.Ctx, []interface{}{id})
+		if err != nil {
+			return err
+		}
 		_, err := m.Collection.UpdateByID(m.Ctx, id, bson.D{{Key: "$set", Value: updates}})
 		if err != nil {
 			return err
 		}
+		if err := m.reload(m.Ctx, changes); err != nil {
+			return err
+		}
 	}
 
-	err = ExecutePostHook(Save, m, m.docs)
+	if err := m.invalidateCache(); err != nil {
+		return err
+	}
+
+	if err := m.track(m.Ctx, Save, changes); err != nil {
+		return err
+	}
+
+	err = ExecutePostHook(Save, m, m.docs, changes)
 	if err != nil {
 		return err
 	}
@@ -231,6 +313,24 @@ func (m *Model[M]) sanitizeFilter(filter interface{}) error {
 	return nil
 }
 
+// sanitizePipeline checks the $match stages of the pipeline for dangerous
+// MongoDB operators when StrictFilters is enabled on the model.
+func (m *Model[M]) sanitizePipeline(pipeline mongo.Pipeline) error {
+	if !m.option.StrictFilters {
+		return nil
+	}
+	for _, stage := range pipeline {
+		for _, e := range stage {
+			if e.Key == "$match" {
+				if err := SanitizeFilter(e.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (m *Model[M]) getQueryId(id interface{}) (bson.M, error) {
 	var query bson.M
 
@@ -3,6 +3,8 @@ package mongoose
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/tinh-tinh/tinhtinh/v2/common/color"
@@ -26,9 +28,13 @@ type Options struct {
 }
 
 type Connect struct {
-	Client *mongo.Client
-	Ctx    context.Context
-	DB     string
+	Client    *mongo.Client
+	Ctx       context.Context
+	DB        string
+	hosts     []string // Sorted hosts of the client options
+	models    sync.Map // Models set on the connection, by collection name
+	locks     *LockManager
+	locksOnce sync.Once
 }
 
 func New[C Config](cfg C) *Connect {
@@ -71,13 +77,21 @@ func New[C Config](cfg C) *Connect {
 		panic(fmt.Sprintf("Failed to connect to MongoDB: %v", err.Error()))
 	}
 
+	hosts := slices.Clone(connectOptions.Hosts)
+	slices.Sort(hosts)
 	return &Connect{
 		Client: client,
 		Ctx:    ctx,
 		DB:     cs.Database,
+		hosts:  hosts,
 	}
 }
 
+// sameServer reports whether c and other connect to the same servers.
+func (c *Connect) sameServer(other *Connect) bool {
+	return c.Client == other.Client || (len(c.hosts) > 0 && slices.Equal(c.hosts, other.hosts))
+}
+
 // Ping pings the MongoDB server to check if the connection is alive.
 // It returns an error if the connection is not alive.
 func (c *Connect) Ping() error {
@@ -87,3 +101,26 @@ func (c *Connect) Ping() error {
 func (c *Connect) SetDB(db string) {
 	c.DB = db
 }
+
+// Model returns the model set on the connection for the given collection
+// name, or nil when there is none. Models are registered by SetConnect.
+func (c *Connect) Model(name string) ModelCommon {
+	if m, ok := c.models.Load(name); ok {
+		return m.(ModelCommon)
+	}
+	return nil
+}
+
+// Models returns every model set on the connection.
+func (c *Connect) Models() []ModelCommon {
+	var models []ModelCommon
+	c.models.Range(func(_, m any) bool {
+		models = append(models, m.(ModelCommon))
+		return true
+	})
+	return models
+}
+
+func (c *Connect) register(m ModelCommon) {
+	c.models.Store(m.GetName(), m)
+}
@@ -1,6 +1,7 @@
 package mongoose
 
 import (
+	"context"
 	"reflect"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var validation = validator.Validator{}
@@ -30,7 +32,7 @@ func (m *Model[M]) Create(input *M) (*mongo.InsertOneResult, error) {
 		return nil, err
 	}
 
-	err = ExecutePostHook(Create, m, result)
+	err = m.afterInsert(Create, result, []interface{}{result.InsertedID}, []interface{}{input})
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +63,7 @@ func (m *Model[M]) CreateMany(input []*M) (*mongo.InsertManyResult, error) {
 		return nil, err
 	}
 
-	err = ExecutePostHook(CreateMany, m, result)
+	err = m.afterInsert(CreateMany, result, result.InsertedIDs, data)
 	if err != nil {
 		return nil, err
 	}
@@ -92,12 +94,29 @@ func (m *Model[M]) Update(filter interface{}, data *M) error {
 	if err != nil {
 		return err
 	}
-	_, err = m.Collection.UpdateOne(m.Ctx, query, bson.D{{Key: "$set", Value: update}})
+
+	changes, err := m.snapshot(m.Ctx, query, 1, nil)
+	if err != nil {
+		return err
+	}
+	result, err := m.Collection.UpdateOne(m.Ctx, changedQuery(query, changes), bson.D{{Key: "$set", Value: update}})
 	if err != nil {
 		return err
 	}
 
-	err = ExecutePostHook(Update, m)
+	if err := m.invalidateCache(); err != nil {
+		return err
+	}
+
+	if err := m.reload(m.Ctx, changes); err != nil {
+		return err
+	}
+
+	if err := m.track(m.Ctx, Update, changes); err != nil {
+		return err
+	}
+
+	err = ExecutePostHook(Update, m, result, changes)
 	if err != nil {
 		return err
 	}
@@ -139,12 +158,30 @@ func (m *Model[M]) UpdateMany(filter interface{}, data *M) error {
 		return err
 	}
 
-	_, err = m.Collection.UpdateMany(m.Ctx, query, bson.D{{Key: "$set", Value: update}})
+	result := &mongo.UpdateResult{}
+	var changes []Change
+	err = m.writeBatches(m.Ctx, query, func(filter interface{}, batch []Change) error {
+		updated, err := m.Collection.UpdateMany(m.Ctx, filter, bson.D{{Key: "$set", Value: update}})
+		if err != nil {
+			return err
+		}
+		result.MatchedCount += updated.MatchedCount
+		result.ModifiedCount += updated.ModifiedCount
+
+		if err := m.invalidateCache(); err != nil {
+			return err
+		}
+		if err := m.reload(m.Ctx, batch); err != nil {
+			return err
+		}
+		changes = m.keptChanges(changes, batch)
+		return m.track(m.Ctx, UpdateMany, batch)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = ExecutePostHook(UpdateMany, m)
+	err = ExecutePostHook(UpdateMany, m, result, changes)
 	if err != nil {
 		return err
 	}
@@ -154,7 +191,8 @@ func (m *Model[M]) UpdateMany(filter interface{}, data *M) error {
 
 // Delete deletes a single document in the collection based on the provided filter.
 // It converts the filter to a BSON document using ToDoc.
-// Finally, it performs the delete operation using DeleteOne.
+// Finally, it performs the delete operation using DeleteOne, applying the
+// onDelete actions of the refs to the document.
 // Returns an error if the delete operation fails.
 func (m *Model[M]) Delete(filter interface{}) error {
 	err := ExecutePreHook(Delete, m, filter)
@@ -171,12 +209,29 @@ func (m *Model[M]) Delete(filter interface{}) error {
 		return err
 	}
 
-	_, err = m.Collection.DeleteOne(m.Ctx, query)
+	var result *mongo.DeleteResult
+	var changes []Change
+	err = m.deleteWithRefs(query, options.Find().SetLimit(1), func(ctx context.Context, filter interface{}) (err error) {
+		changes, err = m.snapshot(ctx, filter, 1, nil)
+		if err != nil {
+			return err
+		}
+		result, err = m.Collection.DeleteOne(ctx, changedQuery(filter, changes))
+		if err != nil {
+			return err
+		}
+		// In the transaction of the delete, if any
+		return m.track(ctx, Delete, changes)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = ExecutePostHook(Delete, m)
+	if err := m.invalidateCache(); err != nil {
+		return err
+	}
+
+	err = ExecutePostHook(Delete, m, result, changes)
 	if err != nil {
 		return err
 	}
@@ -194,55 +249,67 @@ func (m *Model[M]) DeleteByID(id interface{}) error {
 
 // DeleteMany deletes multiple documents in the collection based on the provided filter.
 // It converts the filter to a BSON document using ToDoc.
-// Finally, it performs the delete operation using DeleteMany.
+// Finally, it performs the delete operation using DeleteMany, applying the
+// onDelete actions of the refs to the documents.
 // Returns an error if the delete operation fails.
 func (m *Model[M]) DeleteMany(filter interface{}) error {
+	_, err := m.deleteMany(filter)
+	return err
+}
+
+// deleteMany is DeleteMany returning the result of the delete.
+func (m *Model[M]) deleteMany(filter interface{}) (*mongo.DeleteResult, error) {
 	err := ExecutePreHook(DeleteMany, m, filter)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := m.sanitizeFilter(filter); err != nil {
-		return err
+		return nil, err
 	}
 
 	query, err := ToDoc(filter)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = m.Collection.DeleteMany(m.Ctx, query)
+	var result *mongo.DeleteResult
+	var changes []Change
+	err = m.deleteWithRefs(query, nil, func(ctx context.Context, filter interface{}) error {
+		result, changes = &mongo.DeleteResult{}, nil
+		return m.writeBatches(ctx, filter, func(filter interface{}, batch []Change) error {
+			deleted, err := m.Collection.DeleteMany(ctx, filter)
+			if err != nil {
+				return err
+			}
+			result.DeletedCount += deleted.DeletedCount
+			changes = m.keptChanges(changes, batch)
+			// In the transaction of the delete, if any
+			return m.track(ctx, DeleteMany, batch)
+		})
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := m.invalidateCache(); err != nil {
+		return nil, err
 	}
 
-	err = ExecutePostHook(DeleteMany, m)
+	err = ExecutePostHook(DeleteMany, m, result, changes)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return result, nil
 }
 
 // beforeInsert validates and prepares the data for insert.
 // It sets the _id field if m.option.ID is true.
 // It sets createdAt and updatedAt to the current time if m.option.Timestamp is true.
 func (m *Model[M]) beforeInsert(data *M) error {
-	if m.option.Validation {
-		err := ExecutePreHook(Validate, m, data)
-		if err != nil {
-			return err
-		}
-
-		err = validation.Validate(data)
-		if err != nil {
-			return err
-		}
-
-		err = ExecutePostHook(Validate, m)
-		if err != nil {
-			return err
-		}
+	if err := m.validate(data); err != nil {
+		return err
 	}
 
 	typeInfo := GetTypeInfo[M]()
@@ -278,27 +345,34 @@ func (m *Model[M]) beforeInsert(data *M) error {
 	return nil
 }
 
+// validate runs the validate hooks and the validation of data when
+// m.option.Validation is true.
+func (m *Model[M]) validate(data *M) error {
+	if !m.option.Validation {
+		return nil
+	}
+
+	err := ExecutePreHook(Validate, m, data)
+	if err != nil {
+		return err
+	}
+
+	err = validation.Validate(data)
+	if err != nil {
+		return err
+	}
+
+	return ExecutePostHook(Validate, m)
+}
+
 // beforeUpdate validates and prepares the data for update/replace.
 // It validates the data and constructs a bson.E slice for the update.
 // If isReplace is true and m.option.Timestamp is true, it sets createdAt to current time.
 // If m.option.Timestamp is true, it sets updatedAt to current time.
 // It respects "readonly" tags.
 func (m *Model[M]) beforeUpdate(data *M, isReplace bool) ([]bson.E, error) {
-	if m.option.Validation {
-		err := ExecutePreHook(Validate, m, data)
-		if err != nil {
-			return nil, err
-		}
-
-		err = validation.Validate(data)
-		if err != nil {
-			return nil, err
-		}
-
-		err = ExecutePostHook(Validate, m)
-		if err != nil {
-			return nil, err
-		}
+	if err := m.validate(data); err != nil {
+		return nil, err
 	}
 
 	upsert := []bson.E{}
@@ -329,19 +403,20 @@ func (m *Model[M]) beforeUpdate(data *M, isReplace bool) ([]bson.E, error) {
 		}
 
 		// Skip _id and timestamp fields (handled separately via ModelOptions)
-		if field.BsonTag == "_id" || field.BsonTag == "createdAt" || field.BsonTag == "updatedAt" {
+		name := bsonName(field.BsonTag)
+		if name == "_id" || name == "createdAt" || name == "updatedAt" {
 			continue
 		}
 
 		// Skip readonly fields during update/replace to prevent mass assignment
-		if field.MongooseTag == "readonly" {
+		if field.HasOption("readonly") {
 			continue
 		}
 
 		val := ct.Field(field.Index).Interface()
-		if field.BsonTag != "" && !reflect.ValueOf(val).IsZero() {
+		if name != "" && name != "-" && !reflect.ValueOf(val).IsZero() {
 			upsert = append(upsert, bson.E{
-				Key:   field.BsonTag,
+				Key:   name,
 				Value: val,
 			})
 		}
@@ -0,0 +1,282 @@
+package mongoose
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultOutboxCollection is the collection of the outbox events.
+	DefaultOutboxCollection = "mongoose_outbox"
+	DefaultOutboxBatchSize  = 100
+	DefaultOutboxPoll       = time.Second
+	DefaultOutboxAttempts   = 10
+)
+
+// Status of an outbox event.
+const (
+	OutboxPending = "pending"
+	OutboxDone    = "done"
+	OutboxDead    = "dead" // Dead letter, failed MaxAttempts times
+)
+
+// OutboxEvent is an event stored in the outbox until it is published.
+type OutboxEvent struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Topic         string             `bson:"topic"`
+	Key           string             `bson:"key"` // Aggregate key, events of a key are published in order
+	Payload       bson.Raw           `bson:"payload"`
+	Headers       map[string]string  `bson:"headers,omitempty"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"lastError,omitempty"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt"`
+	CreatedAt     time.Time          `bson:"createdAt"`
+	PublishedAt   time.Time          `bson:"publishedAt,omitempty"`
+}
+
+// Decode unmarshals the payload of the event into v.
+func (e *OutboxEvent) Decode(v interface{}) error {
+	return bson.Unmarshal(e.Payload, v)
+}
+
+// Publisher delivers outbox events to a broker.
+type Publisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, event *OutboxEvent) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event *OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// Outbox stores events in a collection of the connection database, in the
+// same transaction as the documents they describe.
+type Outbox struct {
+	Collection *mongo.Collection
+}
+
+// NewOutbox returns the outbox of the connection, stored in name or
+// DefaultOutboxCollection.
+func NewOutbox(connect *Connect, name ...string) *Outbox {
+	collection := DefaultOutboxCollection
+	if len(name) > 0 && name[0] != "" {
+		collection = name[0]
+	}
+	outbox := &Outbox{Collection: connect.Client.Database(connect.DB).Collection(collection)}
+
+	_, err := outbox.Collection.Indexes().CreateOne(connect.Ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "key", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return outbox
+}
+
+// Enqueue adds an event to the outbox. Pass the session context of a
+// Transaction to commit it with the writes of the transaction, e.g.
+//
+//	model.Transaction(func(session mongo.SessionContext) error {
+//		if _, err := model.Create(order); err != nil {
+//			return err
+//		}
+//		return outbox.Enqueue(session, "order.created", order.ID.Hex(), order)
+//	})
+func (o *Outbox) Enqueue(ctx context.Context, topic string, key string, payload interface{}, headers ...map[string]string) error {
+	raw, err := bson.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	event := &OutboxEvent{
+		ID:            primitive.NewObjectID(),
+		Topic:         topic,
+		Key:           key,
+		Payload:       raw,
+		Status:        OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if len(headers) > 0 {
+		event.Headers = headers[0]
+	}
+	_, err = o.Collection.InsertOne(ctx, event)
+	return err
+}
+
+// DeadLetters returns the events that failed MaxAttempts times.
+func (o *Outbox) DeadLetters(ctx context.Context) ([]*OutboxEvent, error) {
+	cursor, err := o.Collection.Find(ctx, bson.M{"status": OutboxDead}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var events []*OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Retry puts a dead letter back in the outbox with its attempts reset.
+func (o *Outbox) Retry(ctx context.Context, id primitive.ObjectID) error {
+	_, err := o.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": OutboxDead},
+		bson.M{"$set": bson.M{"status": OutboxPending, "attempts": 0, "nextAttemptAt": time.Now()}},
+	)
+	return err
+}
+
+// Purge deletes the published events older than age.
+func (o *Outbox) Purge(ctx context.Context, age time.Duration) (int64, error) {
+	result, err := o.Collection.DeleteMany(ctx, bson.M{
+		"status":      OutboxDone,
+		"publishedAt": bson.M{"$lt": time.Now().Add(-age)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type DispatcherOptions struct {
+	BatchSize    int           // Events published per poll, DefaultOutboxBatchSize when zero
+	PollInterval time.Duration // DefaultOutboxPoll when zero
+	MaxAttempts  int           // Attempts before dead-lettering, DefaultOutboxAttempts when zero
+	// Backoff returns the wait before the next attempt, exponential from
+	// one second up to five minutes when nil
+	Backoff  func(attempts int) time.Duration
+	LeaseTTL time.Duration // Lease of the active dispatcher, DefaultLeaseTTL when zero
+}
+
+// Dispatcher publishes the events of an outbox. Events of the same key are
+// published one at a time in insertion order: a failing event holds back
+// the next ones of its key until it is published or dead-lettered.
+// Dispatchers of the same outbox share a lease so only one publishes; it
+// is renewed before each batch and publishing stops when it is lost.
+type Dispatcher struct {
+	outbox    *Outbox
+	publisher Publisher
+	opt       DispatcherOptions
+}
+
+// NewDispatcher returns a Dispatcher publishing the events of outbox.
+func NewDispatcher(outbox *Outbox, publisher Publisher, opts ...DispatcherOptions) *Dispatcher {
+	var opt DispatcherOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = DefaultOutboxBatchSize
+	}
+	if opt.PollInterval <= 0 {
+		opt.PollInterval = DefaultOutboxPoll
+	}
+	if opt.MaxAttempts <= 0 {
+		opt.MaxAttempts = DefaultOutboxAttempts
+	}
+	if opt.Backoff == nil {
+		opt.Backoff = exponentialBackoff
+	}
+	if opt.LeaseTTL <= 0 {
+		opt.LeaseTTL = DefaultLeaseTTL
+	}
+	return &Dispatcher{outbox: outbox, publisher: publisher, opt: opt}
+}
+
+// Run publishes events every PollInterval until ctx is done, while holding
+// the lease of the outbox.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	leases := &LockManager{Collection: d.outbox.Collection.Database().Collection(DefaultLeaseCollection)}
+	owner := consumerName()
+
+	for {
+		err := leases.withLock(ctx, "outbox:"+d.outbox.Collection.Name(), owner, d.opt.LeaseTTL, func(ctx context.Context, lock *Lock) error {
+			// Publish until the outbox is drained, renewing the lease before
+			// each batch so a lost lease stops publishing
+			for {
+				if err := lock.Renew(ctx); err != nil {
+					return err
+				}
+				published, err := d.DispatchOnce(ctx)
+				if err != nil || published == 0 {
+					return err
+				}
+			}
+		})
+		if err != nil && err != ErrLockHeld && ctx.Err() == nil {
+			log.Println(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.opt.PollInterval):
+		}
+	}
+}
+
+// DispatchOnce publishes the next ready event of up to BatchSize keys and
+// returns the number of events handled, published or not.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	cursor, err := d.outbox.Collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": OutboxPending}}},
+		{{Key: "$sort", Value: bson.D{{Key: "key", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$key", "event": bson.M{"$first": "$$ROOT"}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$event"}}},
+		{{Key: "$match", Value: bson.M{"nextAttemptAt": bson.M{"$lte": time.Now()}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: d.opt.BatchSize}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var events []*OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := d.publish(ctx, event); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
+
+// publish publishes event and records the outcome.
+func (d *Dispatcher) publish(ctx context.Context, event *OutboxEvent) error {
+	pubErr := d.publisher.Publish(ctx, event)
+	now := time.Now()
+
+	var update bson.M
+	switch {
+	case pubErr == nil:
+		update = bson.M{"$set": bson.M{"status": OutboxDone, "publishedAt": now}}
+	case event.Attempts+1 >= d.opt.MaxAttempts:
+		update = bson.M{
+			"$set": bson.M{"status": OutboxDead, "lastError": pubErr.Error()},
+			"$inc": bson.M{"attempts": 1},
+		}
+	default:
+		update = bson.M{
+			"$set": bson.M{"lastError": pubErr.Error(), "nextAttemptAt": now.Add(d.opt.Backoff(event.Attempts + 1))},
+			"$inc": bson.M{"attempts": 1},
+		}
+	}
+	_, err := d.outbox.Collection.UpdateOne(ctx, bson.M{"_id": event.ID}, update)
+	return err
+}
+
+func exponentialBackoff(attempts int) time.Duration {
+	wait := time.Second << min(attempts-1, 9)
+	return min(wait, 5*time.Minute)
+}
@@ -0,0 +1,156 @@
+package mongoose_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestOutbox(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Order]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	outbox := mongoose.NewOutbox(connect, "test_outbox")
+	_, err := outbox.Collection.DeleteMany(context.Background(), bson.M{})
+	require.Nil(t, err)
+
+	// The event is only stored when the transaction commits
+	err = model.Transaction(func(session mongo.SessionContext) error {
+		order := &Order{Code: "rollback"}
+		if _, err := model.Create(order); err != nil {
+			return err
+		}
+		if err := outbox.Enqueue(session, "order.created", "rollback", order); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	require.NotNil(t, err)
+
+	err = model.Transaction(func(session mongo.SessionContext) error {
+		for _, code := range []string{"a1", "a2", "a3"} {
+			order := &Order{Code: code}
+			if _, err := model.Create(order); err != nil {
+				return err
+			}
+			if err := outbox.Enqueue(session, "order.created", "a", order); err != nil {
+				return err
+			}
+		}
+		order := &Order{Code: "b1"}
+		if _, err := model.Create(order); err != nil {
+			return err
+		}
+		return outbox.Enqueue(session, "order.created", "b", order)
+	})
+	require.Nil(t, err)
+	model.SetContext(context.Background())
+
+	var published []string
+	fails := map[string]int{"a2": 1, "b1": 100}
+	publisher := mongoose.PublisherFunc(func(ctx context.Context, event *mongoose.OutboxEvent) error {
+		var order Order
+		if err := event.Decode(&order); err != nil {
+			return err
+		}
+		if fails[order.Code] > 0 {
+			fails[order.Code]--
+			return errors.New("broker unavailable")
+		}
+		published = append(published, order.Code)
+		return nil
+	})
+	dispatcher := mongoose.NewDispatcher(outbox, publisher, mongoose.DispatcherOptions{
+		MaxAttempts: 3,
+		Backoff:     func(int) time.Duration { return 0 },
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		_, err := dispatcher.DispatchOnce(ctx)
+		require.Nil(t, err)
+	}
+
+	// a2 failed once and held back a3, b1 was dead-lettered
+	assert.Equal(t, []string{"a1", "a2", "a3"}, published)
+	dead, err := outbox.DeadLetters(ctx)
+	require.Nil(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "b", dead[0].Key)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "broker unavailable", dead[0].LastError)
+
+	fails["b1"] = 0
+	require.Nil(t, outbox.Retry(ctx, dead[0].ID))
+	handled, err := dispatcher.DispatchOnce(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, []string{"a1", "a2", "a3", "b1"}, published)
+
+	purged, err := outbox.Purge(ctx, 0)
+	require.Nil(t, err)
+	assert.Equal(t, int64(4), purged)
+}
+
+func TestDispatcher_Lease(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	outbox := mongoose.NewOutbox(connect, "test_outbox_lease")
+	ctx := context.Background()
+	_, err := outbox.Collection.DeleteMany(ctx, bson.M{})
+	require.Nil(t, err)
+	require.Nil(t, outbox.Enqueue(ctx, "order.created", "a", bson.M{"code": "a1"}))
+
+	var mu sync.Mutex
+	published := 0
+	publisher := mongoose.PublisherFunc(func(ctx context.Context, event *mongoose.OutboxEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		published++
+		return nil
+	})
+	dispatcher := mongoose.NewDispatcher(outbox, publisher, mongoose.DispatcherOptions{
+		PollInterval: 50 * time.Millisecond,
+		LeaseTTL:     time.Second,
+	})
+
+	// Another dispatcher holds the lease
+	leases := mongoose.NewLockManager(connect, mongoose.DefaultLeaseCollection)
+	lock, err := leases.Acquire(ctx, "outbox:test_outbox_lease", time.Second)
+	require.Nil(t, err)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.Nil(t, dispatcher.Run(runCtx))
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	require.Equal(t, 0, published)
+	mu.Unlock()
+
+	require.Nil(t, lock.Release(ctx))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return published == 1
+	}, 2*time.Second, 50*time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,260 @@
+package mongoose
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PII is the kind of personal data of a field tagged mongoose:"pii=<kind>".
+type PII string
+
+const (
+	PIIEmail  PII = "email"  // Replaced by a fake address of example.com
+	PIIName   PII = "name"   // Replaced by a fake full name
+	PIIPhone  PII = "phone"  // Replaced by a fake +1555 number
+	PIIHash   PII = "hash"   // Replaced by a keyed hash of the same type, for ids and refs
+	PIIRedact PII = "redact" // Replaced by "[redacted]" for strings, removed otherwise
+)
+
+// DefaultCopyBatchSize is the number of documents written at once by CopyTo
+// when CopyOptions.BatchSize is zero.
+const DefaultCopyBatchSize = 500
+
+var (
+	firstNames = []string{"Alex", "Blair", "Casey", "Dana", "Eden", "Finley", "Gray", "Harper",
+		"Indigo", "Jordan", "Kai", "Logan", "Morgan", "Noel", "Parker", "Quinn"}
+	lastNames = []string{"Abbott", "Brooks", "Carter", "Dalton", "Ellis", "Foster", "Garcia", "Hayes",
+		"Ingram", "Jensen", "Keller", "Larsen", "Mendez", "Nolan", "Ortiz", "Porter"}
+)
+
+// Anonymizer replaces personal data deterministically: a value is always
+// replaced by the same fake value for a key, in every collection, so
+// equality joins and refs between anonymized fields still match.
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer returns an Anonymizer keyed by key. The key must be kept
+// secret, as values can be guessed back from it.
+func NewAnonymizer(key []byte) *Anonymizer {
+	return &Anonymizer{key: key}
+}
+
+func (a *Anonymizer) mac(kind PII, value []byte) []byte {
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// Anonymize returns the replacement of value, or false when it must be
+// removed. Arrays are anonymized element by element. Unknown kinds redact.
+func (a *Anonymizer) Anonymize(kind PII, value interface{}) (interface{}, bool) {
+	switch kind {
+	case PIIEmail, PIIName, PIIPhone, PIIHash:
+	default:
+		kind = PIIRedact
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case bson.A:
+		values := make(bson.A, 0, len(v))
+		for _, item := range v {
+			if anonymized, ok := a.Anonymize(kind, item); ok {
+				values = append(values, anonymized)
+			}
+		}
+		return values, true
+	case string:
+		if kind == PIIRedact {
+			return "[redacted]", true
+		}
+		return a.anonymizeString(kind, v), true
+	}
+	if kind == PIIRedact {
+		return nil, false
+	}
+
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		var id primitive.ObjectID
+		copy(id[:], a.mac(PIIHash, v[:]))
+		return id, true
+	case int32:
+		sum := a.mac(PIIHash, binary.BigEndian.AppendUint32(nil, uint32(v)))
+		return int32(binary.BigEndian.Uint32(sum) & 0x7fffffff), true
+	case int64:
+		sum := a.mac(PIIHash, binary.BigEndian.AppendUint64(nil, uint64(v)))
+		return int64(binary.BigEndian.Uint64(sum) & 0x7fffffffffffffff), true
+	}
+	// No fake value of the same type
+	return nil, false
+}
+
+func (a *Anonymizer) anonymizeString(kind PII, value string) string {
+	sum := a.mac(kind, []byte(value))
+	switch kind {
+	case PIIEmail:
+		return "user_" + hex.EncodeToString(sum[:6]) + "@example.com"
+	case PIIName:
+		return firstNames[int(sum[0])%len(firstNames)] + " " + lastNames[int(sum[1])%len(lastNames)]
+	case PIIPhone:
+		return fmt.Sprintf("+1555%07d", binary.BigEndian.Uint32(sum)%10000000)
+	}
+	return hex.EncodeToString(sum)
+}
+
+// anonymizeDoc replaces the fields of doc tagged with a PII kind. Fields
+// are keyed by their dotted path, the ones of embedded documents and arrays
+// of them included.
+func anonymizeDoc(doc bson.D, fields map[string]PII, anonymizer *Anonymizer) bson.D {
+	anonymized := make(bson.D, 0, len(doc))
+	for _, e := range doc {
+		if kind, tagged := fields[e.Key]; tagged {
+			if value, ok := anonymizer.Anonymize(kind, e.Value); ok {
+				anonymized = append(anonymized, bson.E{Key: e.Key, Value: value})
+			}
+			continue
+		}
+		if nested := nestedPII(fields, e.Key); len(nested) > 0 {
+			e.Value = anonymizeNested(e.Value, nested, anonymizer)
+		}
+		anonymized = append(anonymized, e)
+	}
+	return anonymized
+}
+
+func anonymizeNested(value interface{}, fields map[string]PII, anonymizer *Anonymizer) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		return anonymizeDoc(v, fields, anonymizer)
+	case bson.A:
+		values := make(bson.A, len(v))
+		for i, item := range v {
+			values[i] = anonymizeNested(item, fields, anonymizer)
+		}
+		return values
+	}
+	return value
+}
+
+// nestedPII returns the fields under key, keyed by their path relative to it.
+func nestedPII(fields map[string]PII, key string) map[string]PII {
+	var nested map[string]PII
+	for path, kind := range fields {
+		if rest, ok := strings.CutPrefix(path, key+"."); ok {
+			if nested == nil {
+				nested = make(map[string]PII)
+			}
+			nested[rest] = kind
+		}
+	}
+	return nested
+}
+
+// Anonymize returns doc with its PII fields replaced by anonymizer.
+func (m *Model[M]) Anonymize(doc bson.Raw, anonymizer *Anonymizer) (bson.D, error) {
+	var d bson.D
+	if err := bson.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	return anonymizeDoc(d, GetTypeInfo[M]().PIIFields, anonymizer), nil
+}
+
+type CopyOptions struct {
+	Anonymizer *Anonymizer // Required
+	Filter     interface{}
+	Collection string // Target collection, the collection of the model when empty
+	BatchSize  int    // DefaultCopyBatchSize when zero
+	Reset      bool   // Deletes the documents of the target collection first
+}
+
+// CopyTo streams the documents of the collection matching Filter to the
+// database of target, with their PII fields anonymized. Documents are
+// upserted by their anonymized _id, so a copy can be run again. It returns
+// the number of documents copied. Copying to the collection of the model
+// itself is an error.
+func (m *Model[M]) CopyTo(target *Connect, opt CopyOptions) (int64, error) {
+	if opt.Anonymizer == nil {
+		return 0, errors.New("CopyTo needs an Anonymizer")
+	}
+	if opt.Collection == "" {
+		opt.Collection = m.GetName()
+	}
+	if target.DB == m.connect.DB && opt.Collection == m.GetName() && target.sameServer(m.connect) {
+		return 0, errors.New("CopyTo target is the collection of the model")
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = DefaultCopyBatchSize
+	}
+	if err := m.sanitizeFilter(opt.Filter); err != nil {
+		return 0, err
+	}
+	query, err := ToDoc(opt.Filter)
+	if err != nil {
+		return 0, err
+	}
+
+	collection := target.Client.Database(target.DB).Collection(opt.Collection)
+	if opt.Reset {
+		if _, err := collection.DeleteMany(target.Ctx, bson.M{}); err != nil {
+			return 0, err
+		}
+	}
+
+	cursor, err := m.Collection.Find(m.Ctx, query, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(m.Ctx)
+
+	fields := GetTypeInfo[M]().PIIFields
+	copied := int64(0)
+	writes := make([]mongo.WriteModel, 0, opt.BatchSize)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := collection.BulkWrite(target.Ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		copied += int64(len(writes))
+		writes = writes[:0]
+		return nil
+	}
+
+	for cursor.Next(m.Ctx) {
+		var doc bson.D
+		if err := bson.Unmarshal(cursor.Current, &doc); err != nil {
+			return copied, err
+		}
+		doc = anonymizeDoc(doc, fields, opt.Anonymizer)
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": doc.Map()["_id"]}).
+			SetReplacement(doc).
+			SetUpsert(true))
+		if len(writes) >= opt.BatchSize {
+			if err := flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return copied, err
+	}
+	return copied, flush()
+}
@@ -0,0 +1,194 @@
+package mongoose_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Patient struct {
+	BaseSchema `bson:"inline"`
+	Name       string   `bson:"name" mongoose:"pii=name"`
+	Email      string   `bson:"email" mongoose:"pii=email"`
+	Phones     []string `bson:"phones" mongoose:"pii=phone"`
+	SSN        string   `bson:"ssn" mongoose:"pii=redact"`
+	Notes      string   `bson:"notes" mongoose:"pii=unknown"`
+	Ward       string   `bson:"ward"`
+}
+
+func (p Patient) CollectionName() string {
+	return "patients"
+}
+
+type Visit struct {
+	BaseSchema `bson:"inline"`
+	PatientID  primitive.ObjectID `bson:"patientId"`
+	Email      string             `bson:"email" mongoose:"pii=email"`
+}
+
+func (v Visit) CollectionName() string {
+	return "visits"
+}
+
+func TestAnonymizer(t *testing.T) {
+	anonymizer := mongoose.NewAnonymizer([]byte("secret"))
+
+	email, ok := anonymizer.Anonymize(mongoose.PIIEmail, "alice@corp.com")
+	require.True(t, ok)
+	require.True(t, strings.HasSuffix(email.(string), "@example.com"))
+	again, _ := anonymizer.Anonymize(mongoose.PIIEmail, "alice@corp.com")
+	require.Equal(t, email, again)
+	other, _ := mongoose.NewAnonymizer([]byte("other")).Anonymize(mongoose.PIIEmail, "alice@corp.com")
+	require.NotEqual(t, email, other)
+
+	phone, _ := anonymizer.Anonymize(mongoose.PIIPhone, "+33 6 12 34 56 78")
+	require.Len(t, phone.(string), 12)
+	require.True(t, strings.HasPrefix(phone.(string), "+1555"))
+
+	name, _ := anonymizer.Anonymize(mongoose.PIIName, "Alice Martin")
+	require.Len(t, strings.Fields(name.(string)), 2)
+
+	id := primitive.NewObjectID()
+	hashed, ok := anonymizer.Anonymize(mongoose.PIIHash, id)
+	require.True(t, ok)
+	require.NotEqual(t, id, hashed)
+	require.IsType(t, primitive.ObjectID{}, hashed)
+
+	redacted, ok := anonymizer.Anonymize(mongoose.PIIRedact, "123-45-6789")
+	require.True(t, ok)
+	require.Equal(t, "[redacted]", redacted)
+	_, ok = anonymizer.Anonymize(mongoose.PIIRedact, int64(42))
+	require.False(t, ok)
+	unknown, _ := anonymizer.Anonymize(mongoose.PII("unknown"), "secret notes")
+	require.Equal(t, "[redacted]", unknown)
+
+	phones, _ := anonymizer.Anonymize(mongoose.PIIPhone, bson.A{"1", "2"})
+	require.Len(t, phones, 2)
+}
+
+func TestPIIFields(t *testing.T) {
+	fields := mongoose.GetTypeInfo[Patient]().PIIFields
+	require.Equal(t, map[string]mongoose.PII{
+		"name":   mongoose.PIIName,
+		"email":  mongoose.PIIEmail,
+		"phones": mongoose.PIIPhone,
+		"ssn":    mongoose.PIIRedact,
+		"notes":  mongoose.PII("unknown"),
+	}, fields)
+}
+
+type Contact struct {
+	Email string `bson:"email" mongoose:"pii=email"`
+	Kind  string `bson:"kind"`
+}
+
+type Account struct {
+	BaseSchema `bson:"inline"`
+	Name       string    `bson:"name" mongoose:"pii=name"`
+	Primary    *Contact  `bson:"primary"`
+	Contacts   []Contact `bson:"contacts"`
+}
+
+func (c Account) CollectionName() string {
+	return "accounts"
+}
+
+func TestPIIFields_Nested(t *testing.T) {
+	fields := mongoose.GetTypeInfo[Account]().PIIFields
+	require.Equal(t, map[string]mongoose.PII{
+		"name":           mongoose.PIIName,
+		"primary.email":  mongoose.PIIEmail,
+		"contacts.email": mongoose.PIIEmail,
+	}, fields)
+
+	raw, err := bson.Marshal(Account{
+		Name:     "Alice Martin",
+		Primary:  &Contact{Email: "alice@corp.com", Kind: "work"},
+		Contacts: []Contact{{Email: "alice@home.com", Kind: "home"}},
+	})
+	require.Nil(t, err)
+	model := mongoose.NewModel[Account]()
+	doc, err := model.Anonymize(raw, mongoose.NewAnonymizer([]byte("secret")))
+	require.Nil(t, err)
+
+	out, err := bson.Marshal(doc)
+	require.Nil(t, err)
+	var account Account
+	require.Nil(t, bson.Unmarshal(out, &account))
+	require.NotEqual(t, "alice@corp.com", account.Primary.Email)
+	require.True(t, strings.HasSuffix(account.Primary.Email, "@example.com"))
+	require.Equal(t, "work", account.Primary.Kind)
+	require.NotEqual(t, "alice@home.com", account.Contacts[0].Email)
+	require.Equal(t, "home", account.Contacts[0].Kind)
+}
+
+func TestCopyTo(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	staging := mongoose.New(os.Getenv("MONGO_URI"))
+	staging.SetDB("test_staging")
+
+	patientModel := mongoose.NewModel[Patient]()
+	patientModel.SetConnect(connect)
+	require.Nil(t, patientModel.DeleteMany(nil))
+	visitModel := mongoose.NewModel[Visit]()
+	visitModel.SetConnect(connect)
+	require.Nil(t, visitModel.DeleteMany(nil))
+
+	patient := &Patient{Name: "Alice Martin", Email: "alice@corp.com", Phones: []string{"0612345678"}, SSN: "123-45-6789", Ward: "B"}
+	_, err := patientModel.Create(patient)
+	require.Nil(t, err)
+	_, err = visitModel.Create(&Visit{PatientID: patient.ID, Email: "alice@corp.com"})
+	require.Nil(t, err)
+
+	anonymizer := mongoose.NewAnonymizer([]byte("secret"))
+	copied, err := patientModel.CopyTo(staging, mongoose.CopyOptions{Anonymizer: anonymizer, Reset: true})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), copied)
+	copied, err = visitModel.CopyTo(staging, mongoose.CopyOptions{Anonymizer: anonymizer, Reset: true})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), copied)
+
+	var copy Patient
+	err = staging.Client.Database("test_staging").Collection("patients").FindOne(staging.Ctx, bson.M{}).Decode(&copy)
+	require.Nil(t, err)
+	require.Equal(t, patient.ID, copy.ID)
+	require.Equal(t, "B", copy.Ward)
+	require.NotEqual(t, patient.Email, copy.Email)
+	require.NotEqual(t, patient.Phones, copy.Phones)
+	require.Equal(t, "[redacted]", copy.SSN)
+
+	var visit Visit
+	err = staging.Client.Database("test_staging").Collection("visits").FindOne(staging.Ctx, bson.M{}).Decode(&visit)
+	require.Nil(t, err)
+	// Refs and anonymized values still match
+	require.Equal(t, copy.ID, visit.PatientID)
+	require.Equal(t, copy.Email, visit.Email)
+
+	// Running the copy again replaces the documents
+	_, err = patientModel.CopyTo(staging, mongoose.CopyOptions{Anonymizer: anonymizer})
+	require.Nil(t, err)
+	count, err := staging.Client.Database("test_staging").Collection("patients").CountDocuments(staging.Ctx, bson.M{})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), count)
+
+	_, err = patientModel.CopyTo(staging, mongoose.CopyOptions{})
+	require.NotNil(t, err)
+	// Never over the source
+	_, err = patientModel.CopyTo(connect, mongoose.CopyOptions{Anonymizer: anonymizer})
+	require.NotNil(t, err)
+	_, err = patientModel.CopyTo(connect, mongoose.CopyOptions{Anonymizer: anonymizer, Collection: "patients_copy", Reset: true})
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	_, err = patientModel.Export(&buf, nil, mongoose.FormatNDJSON, mongoose.ExportOptions{Anonymizer: anonymizer})
+	require.Nil(t, err)
+	require.NotContains(t, buf.String(), "alice@corp.com")
+	require.Contains(t, buf.String(), copy.Email)
+}
@@ -0,0 +1,492 @@
+package mongoose
+
+import (
+	"fmt"
+	"go/token"
+	"maps"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrInvalidFieldPath is returned by PipelineBuilder.Build when a stage
+// references a field that does not exist on the documents at that point.
+type ErrInvalidFieldPath struct {
+	Stage string
+	Path  string
+}
+
+func (e *ErrInvalidFieldPath) Error() string {
+	return fmt.Sprintf("invalid field path %q in %s stage", e.Path, e.Stage)
+}
+
+// PipelineBuilder builds an aggregation pipeline for the collection of M.
+// Field paths are validated against the cached TypeInfo of M until a stage
+// reshapes the documents; from then on the fields produced by the previous
+// stages are used. Nested paths are validated against the types of the
+// fields of M, and accepted below maps, interfaces and computed fields.
+// After UnionWith or Stage the shape is unknown and paths are no longer
+// validated.
+type PipelineBuilder[M any] struct {
+	stages mongo.Pipeline
+	fields map[string]reflect.Type // Known fields by name, nil when computed
+	err    error
+	ops    []func(*PipelineBuilder[M]) // Stages to replay on another shape
+}
+
+// Pipeline returns a new PipelineBuilder for the model.
+func (m *Model[M]) Pipeline() *PipelineBuilder[M] {
+	return NewPipeline[M]()
+}
+
+// NewPipeline returns a new PipelineBuilder validating against the fields of M.
+func NewPipeline[M any]() *PipelineBuilder[M] {
+	var m M
+	fields := fieldTypes(reflect.TypeOf(m))
+	if _, ok := fields["_id"]; !ok {
+		fields["_id"] = nil
+	}
+
+	return &PipelineBuilder[M]{fields: fields}
+}
+
+// Match appends a $match stage. Top-level keys of the filter, including the
+// ones nested in $and, $or and $nor, must be known fields.
+func (p *PipelineBuilder[M]) Match(filter interface{}) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Match(filter) })
+	query, err := ToDoc(filter)
+	if err != nil {
+		return p.fail(err)
+	}
+	p.checkFilter("$match", *query)
+	return p.add("$match", *query)
+}
+
+// Group appends a $group stage grouping by id with the given accumulators.
+// The output documents only contain _id and the accumulator fields.
+func (p *PipelineBuilder[M]) Group(id interface{}, fields bson.D) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Group(id, fields) })
+	p.checkExpr("$group", id)
+	group := bson.D{{Key: "_id", Value: id}}
+	next := map[string]reflect.Type{"_id": nil}
+	for _, e := range fields {
+		p.checkExpr("$group", e.Value)
+		group = append(group, e)
+		next[e.Key] = nil
+	}
+	p.add("$group", group)
+	p.fields = next
+	return p
+}
+
+// Project appends a $project stage. Inclusion projections keep only the
+// listed fields, exclusion projections remove them.
+func (p *PipelineBuilder[M]) Project(fields bson.D) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Project(fields) })
+	exclusion := len(fields) > 0
+	for _, e := range fields {
+		if !isExcluded(e.Value) {
+			exclusion = false
+		}
+	}
+
+	if exclusion {
+		for _, e := range fields {
+			p.checkPath("$project", e.Key)
+		}
+		if p.fields != nil {
+			for _, e := range fields {
+				delete(p.fields, e.Key)
+			}
+		}
+		return p.add("$project", fields)
+	}
+
+	next := map[string]reflect.Type{"_id": p.fields["_id"]}
+	for _, e := range fields {
+		if isExcluded(e.Value) {
+			delete(next, e.Key)
+			continue
+		}
+		if isIncluded(e.Value) {
+			p.checkPath("$project", e.Key)
+			next[rootField(e.Key)] = p.fields[rootField(e.Key)]
+		} else {
+			p.checkExpr("$project", e.Value)
+			next[rootField(e.Key)] = nil
+		}
+	}
+	p.add("$project", fields)
+	if p.fields != nil {
+		p.fields = next
+	}
+	return p
+}
+
+// Lookup appends a $lookup stage joining from on localField = foreignField.
+// The as field is added to the known fields.
+func (p *PipelineBuilder[M]) Lookup(from, localField, foreignField, as string) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Lookup(from, localField, foreignField, as) })
+	p.checkPath("$lookup", localField)
+	p.add("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+	p.addField(as)
+	return p
+}
+
+// Unwind appends an $unwind stage for the array at path. When preserve is
+// true, documents with a null, missing or empty array are kept.
+func (p *PipelineBuilder[M]) Unwind(path string, preserve ...bool) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Unwind(path, preserve...) })
+	path = strings.TrimPrefix(path, "$")
+	p.checkPath("$unwind", path)
+	unwind := bson.D{{Key: "path", Value: "$" + path}}
+	if len(preserve) > 0 && preserve[0] {
+		unwind = append(unwind, bson.E{Key: "preserveNullAndEmptyArrays", Value: true})
+	}
+	return p.add("$unwind", unwind)
+}
+
+// Facet appends a $facet stage running each sub-pipeline on the same input.
+// Sub-pipelines are validated against the fields of the documents at this
+// point, which are the fields of M only when Facet is the first stage.
+// The output documents contain one array field per facet.
+func (p *PipelineBuilder[M]) Facet(facets map[string]*PipelineBuilder[M]) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Facet(facets) })
+	names := make([]string, 0, len(facets))
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	facet := bson.D{}
+	next := map[string]reflect.Type{}
+	for _, name := range names {
+		// Replayed on the current fields instead of the ones of M
+		sub := &PipelineBuilder[M]{fields: maps.Clone(p.fields)}
+		for _, op := range facets[name].ops {
+			op(sub)
+		}
+		stages, err := sub.Build()
+		if err != nil {
+			return p.fail(err)
+		}
+		facet = append(facet, bson.E{Key: name, Value: stages})
+		next[name] = nil
+	}
+	p.add("$facet", facet)
+	p.fields = next
+	return p
+}
+
+// Bucket appends a $bucket stage categorizing documents by groupBy into the
+// given boundaries. Documents outside the boundaries go to defaultBucket
+// when it is not nil. Without output, each bucket only has a count field.
+func (p *PipelineBuilder[M]) Bucket(groupBy interface{}, boundaries []interface{}, defaultBucket interface{}, output bson.D) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Bucket(groupBy, boundaries, defaultBucket, output) })
+	p.checkExpr("$bucket", groupBy)
+	bucket := bson.D{
+		{Key: "groupBy", Value: groupBy},
+		{Key: "boundaries", Value: boundaries},
+	}
+	if defaultBucket != nil {
+		bucket = append(bucket, bson.E{Key: "default", Value: defaultBucket})
+	}
+
+	next := map[string]reflect.Type{"_id": nil}
+	if output != nil {
+		for _, e := range output {
+			p.checkExpr("$bucket", e.Value)
+			next[e.Key] = nil
+		}
+		bucket = append(bucket, bson.E{Key: "output", Value: output})
+	} else {
+		next["count"] = nil
+	}
+	p.add("$bucket", bucket)
+	p.fields = next
+	return p
+}
+
+// UnionWith appends a $unionWith stage merging the results of pipeline run
+// on coll. The output shape is no longer known, so later stages are not
+// validated.
+func (p *PipelineBuilder[M]) UnionWith(coll string, pipeline mongo.Pipeline) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.UnionWith(coll, pipeline) })
+	union := bson.D{{Key: "coll", Value: coll}}
+	if pipeline != nil {
+		union = append(union, bson.E{Key: "pipeline", Value: pipeline})
+	}
+	p.add("$unionWith", union)
+	p.fields = nil
+	return p
+}
+
+// SetWindowFields appends a $setWindowFields stage. partitionBy may be nil.
+// The output fields are added to the known fields.
+func (p *PipelineBuilder[M]) SetWindowFields(partitionBy interface{}, sortBy bson.D, output bson.D) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.SetWindowFields(partitionBy, sortBy, output) })
+	window := bson.D{}
+	if partitionBy != nil {
+		p.checkExpr("$setWindowFields", partitionBy)
+		window = append(window, bson.E{Key: "partitionBy", Value: partitionBy})
+	}
+	if sortBy != nil {
+		for _, e := range sortBy {
+			p.checkPath("$setWindowFields", e.Key)
+		}
+		window = append(window, bson.E{Key: "sortBy", Value: sortBy})
+	}
+	for _, e := range output {
+		p.checkExpr("$setWindowFields", e.Value)
+	}
+	window = append(window, bson.E{Key: "output", Value: output})
+	p.add("$setWindowFields", window)
+	for _, e := range output {
+		p.addField(e.Key)
+	}
+	return p
+}
+
+// Sort appends a $sort stage.
+func (p *PipelineBuilder[M]) Sort(sort bson.D) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Sort(sort) })
+	for _, e := range sort {
+		p.checkPath("$sort", e.Key)
+	}
+	return p.add("$sort", sort)
+}
+
+// Skip appends a $skip stage.
+func (p *PipelineBuilder[M]) Skip(n int64) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Skip(n) })
+	return p.add("$skip", n)
+}
+
+// Limit appends a $limit stage.
+func (p *PipelineBuilder[M]) Limit(n int64) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Limit(n) })
+	return p.add("$limit", n)
+}
+
+// Stage appends a raw stage. The output shape is no longer known, so later
+// stages are not validated.
+func (p *PipelineBuilder[M]) Stage(stage bson.D) *PipelineBuilder[M] {
+	p.record(func(q *PipelineBuilder[M]) { q.Stage(stage) })
+	p.stages = append(p.stages, stage)
+	p.fields = nil
+	return p
+}
+
+// Build returns the pipeline or the first error met while building it.
+func (p *PipelineBuilder[M]) Build() (mongo.Pipeline, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.stages, nil
+}
+
+// record keeps op, the call of a stage method, so Facet can replay it.
+func (p *PipelineBuilder[M]) record(op func(*PipelineBuilder[M])) {
+	p.ops = append(p.ops, op)
+}
+
+func (p *PipelineBuilder[M]) add(name string, value interface{}) *PipelineBuilder[M] {
+	p.stages = append(p.stages, bson.D{{Key: name, Value: value}})
+	return p
+}
+
+func (p *PipelineBuilder[M]) fail(err error) *PipelineBuilder[M] {
+	if p.err == nil {
+		p.err = err
+	}
+	return p
+}
+
+func (p *PipelineBuilder[M]) addField(path string) {
+	if p.fields != nil {
+		p.fields[rootField(path)] = nil
+	}
+}
+
+// checkPath validates every segment of a dotted field path.
+func (p *PipelineBuilder[M]) checkPath(stage string, path string) {
+	if p.fields == nil || path == "" {
+		return
+	}
+	root, rest, _ := strings.Cut(path, ".")
+	t, ok := p.fields[root]
+	if !ok || !hasPath(t, rest) {
+		p.fail(&ErrInvalidFieldPath{Stage: stage, Path: path})
+	}
+}
+
+// checkFilter validates the field names of a query filter, a bson.D or a
+// bson.M.
+func (p *PipelineBuilder[M]) checkFilter(stage string, filter interface{}) {
+	switch f := filter.(type) {
+	case bson.D:
+		for _, e := range f {
+			p.checkCondition(stage, e.Key, e.Value)
+		}
+	case bson.M:
+		for key, value := range f {
+			p.checkCondition(stage, key, value)
+		}
+	}
+}
+
+// checkCondition validates the field name of a condition of a query
+// filter, or the filters of a logical operator.
+func (p *PipelineBuilder[M]) checkCondition(stage string, key string, value interface{}) {
+	switch key {
+	case "$and", "$or", "$nor":
+		switch conditions := value.(type) {
+		case bson.A:
+			for _, c := range conditions {
+				p.checkFilter(stage, c)
+			}
+		case []interface{}:
+			for _, c := range conditions {
+				p.checkFilter(stage, c)
+			}
+		}
+	default:
+		if !strings.HasPrefix(key, "$") {
+			p.checkPath(stage, key)
+		}
+	}
+}
+
+// checkExpr validates every "$field" reference inside an expression.
+// Variables ("$$var") and operator keys are ignored.
+func (p *PipelineBuilder[M]) checkExpr(stage string, expr interface{}) {
+	switch v := expr.(type) {
+	case string:
+		if strings.HasPrefix(v, "$") && !strings.HasPrefix(v, "$$") {
+			p.checkPath(stage, v[1:])
+		}
+	case bson.D:
+		for _, e := range v {
+			p.checkExpr(stage, e.Value)
+		}
+	case bson.M:
+		for _, val := range v {
+			p.checkExpr(stage, val)
+		}
+	case bson.A:
+		for _, val := range v {
+			p.checkExpr(stage, val)
+		}
+	case []interface{}:
+		for _, val := range v {
+			p.checkExpr(stage, val)
+		}
+	}
+}
+
+// bsonName returns the field name of a bson tag without its options.
+func bsonName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+// fieldTypes returns the types of the stored fields of the struct type t
+// by their name.
+func fieldTypes(t reflect.Type) map[string]reflect.Type {
+	typeInfo := getTypeInfoOf(t)
+	fields := make(map[string]reflect.Type)
+	for tag, field := range typeInfo.FieldsByBson {
+		if name := bsonName(tag); name != "" {
+			fields[name] = field.Type
+		}
+	}
+	for _, field := range typeInfo.Fields {
+		// Untagged fields are stored by their lowercased name
+		if len(field.IndexPath) == 1 && bsonName(field.BsonTag) == "" && field.BsonTag != "-" && token.IsExported(field.Name) {
+			fields[strings.ToLower(field.Name)] = field.Type
+		}
+	}
+	return fields
+}
+
+// hasPath reports whether the dotted path exists below a field of type t.
+// Array elements are reached by index or directly, and any path is
+// accepted below computed fields, maps, interfaces and other non struct
+// types.
+func hasPath(t reflect.Type, path string) bool {
+	for path != "" && t != nil {
+		var segment string
+		segment, path, _ = strings.Cut(path, ".")
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+			for t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			if _, err := strconv.Atoi(segment); err == nil {
+				continue
+			}
+		}
+		if t.Kind() != reflect.Struct {
+			return true
+		}
+		next, ok := fieldTypes(t)[segment]
+		if !ok {
+			return false
+		}
+		t = next
+	}
+	return true
+}
+
+func rootField(path string) string {
+	root, _, _ := strings.Cut(path, ".")
+	return root
+}
+
+func isIncluded(v interface{}) bool {
+	switch n := v.(type) {
+	case bool:
+		return n
+	case int:
+		return n == 1
+	case int32:
+		return n == 1
+	case int64:
+		return n == 1
+	case float32:
+		return n == 1
+	case float64:
+		return n == 1
+	}
+	return false
+}
+
+func isExcluded(v interface{}) bool {
+	switch n := v.(type) {
+	case bool:
+		return !n
+	case int:
+		return n == 0
+	case int32:
+		return n == 0
+	case int64:
+		return n == 0
+	case float32:
+		return n == 0
+	case float64:
+		return n == 0
+	}
+	return false
+}
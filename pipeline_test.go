@@ -0,0 +1,280 @@
+package mongoose_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Sale struct {
+	BaseSchema `bson:"inline"`
+	Item       string `bson:"item"`
+	Region     string `bson:"region"`
+	Amount     int    `bson:"amount"`
+}
+
+func (s Sale) CollectionName() string {
+	return "sales"
+}
+
+type SaleReport struct {
+	Region string `bson:"_id"`
+	Total  int    `bson:"total"`
+	Count  int    `bson:"count"`
+}
+
+func TestPipelineBuilder_Valid(t *testing.T) {
+	pipeline, err := mongoose.NewPipeline[Sale]().
+		Match(bson.M{"region": "north"}).
+		Lookup("items", "item", "code", "itemInfo").
+		Unwind("itemInfo", true).
+		SetWindowFields("$region", bson.D{{Key: "amount", Value: 1}}, bson.D{
+			{Key: "runningTotal", Value: bson.M{"$sum": "$amount"}},
+		}).
+		Sort(bson.D{{Key: "runningTotal", Value: -1}}).
+		Group("$region", bson.D{
+			{Key: "total", Value: bson.M{"$sum": "$amount"}},
+		}).
+		Project(bson.D{{Key: "total", Value: 1}}).
+		Limit(10).
+		Build()
+	require.Nil(t, err)
+	assert.Len(t, pipeline, 8)
+	assert.Equal(t, "$match", pipeline[0][0].Key)
+	assert.Equal(t, "$limit", pipeline[7][0].Key)
+}
+
+func TestPipelineBuilder_InvalidField(t *testing.T) {
+	_, err := mongoose.NewPipeline[Sale]().Match(bson.M{"unknown": 1}).Build()
+	require.NotNil(t, err)
+	var pathErr *mongoose.ErrInvalidFieldPath
+	assert.ErrorAs(t, err, &pathErr)
+	assert.Equal(t, "$match", pathErr.Stage)
+	assert.Equal(t, "unknown", pathErr.Path)
+
+	// Fields removed by $group are no longer available
+	_, err = mongoose.NewPipeline[Sale]().
+		Group("$region", bson.D{{Key: "total", Value: bson.M{"$sum": "$amount"}}}).
+		Sort(bson.D{{Key: "amount", Value: 1}}).
+		Build()
+	assert.NotNil(t, err)
+
+	// Expressions are validated
+	_, err = mongoose.NewPipeline[Sale]().
+		Group("$country", nil).
+		Build()
+	assert.NotNil(t, err)
+
+	// Logical operators are walked
+	_, err = mongoose.NewPipeline[Sale]().
+		Match(bson.M{"$or": bson.A{bson.M{"region": "north"}, bson.M{"city": "x"}}}).
+		Build()
+	assert.NotNil(t, err)
+
+	// Facets report the errors of their sub-pipelines
+	_, err = mongoose.NewPipeline[Sale]().Facet(map[string]*mongoose.PipelineBuilder[Sale]{
+		"bad": mongoose.NewPipeline[Sale]().Sort(bson.D{{Key: "missing", Value: 1}}),
+	}).Build()
+	assert.NotNil(t, err)
+
+	// Unknown shapes are not validated
+	_, err = mongoose.NewPipeline[Sale]().
+		UnionWith("archived_sales", nil).
+		Match(bson.M{"archivedAt": bson.M{"$exists": true}}).
+		Build()
+	assert.Nil(t, err)
+}
+
+func TestPipelineBuilder_Shapes(t *testing.T) {
+	_, err := mongoose.NewPipeline[Sale]().
+		Bucket("$amount", []interface{}{0, 100, 1000}, "other", nil).
+		Sort(bson.D{{Key: "count", Value: -1}}).
+		Build()
+	assert.Nil(t, err)
+
+	_, err = mongoose.NewPipeline[Sale]().
+		Facet(map[string]*mongoose.PipelineBuilder[Sale]{
+			"byRegion": mongoose.NewPipeline[Sale]().Group("$region", nil),
+			"top":      mongoose.NewPipeline[Sale]().Sort(bson.D{{Key: "amount", Value: -1}}).Limit(3),
+		}).
+		Unwind("top").
+		Build()
+	assert.Nil(t, err)
+
+	_, err = mongoose.NewPipeline[Sale]().
+		Project(bson.D{{Key: "amount", Value: 0}}).
+		Sort(bson.D{{Key: "amount", Value: 1}}).
+		Build()
+	assert.NotNil(t, err)
+
+	// Facets see the documents of the previous stages
+	_, err = mongoose.NewPipeline[Sale]().
+		Group("$region", bson.D{{Key: "total", Value: bson.M{"$sum": "$amount"}}}).
+		Facet(map[string]*mongoose.PipelineBuilder[Sale]{
+			"top": mongoose.NewPipeline[Sale]().Sort(bson.D{{Key: "total", Value: -1}}).Limit(3),
+		}).
+		Build()
+	assert.Nil(t, err)
+	_, err = mongoose.NewPipeline[Sale]().
+		Group("$region", bson.D{{Key: "total", Value: bson.M{"$sum": "$amount"}}}).
+		Facet(map[string]*mongoose.PipelineBuilder[Sale]{
+			"top": mongoose.NewPipeline[Sale]().Sort(bson.D{{Key: "amount", Value: -1}}),
+		}).
+		Build()
+	assert.NotNil(t, err)
+}
+
+type Visitor struct {
+	ID      string `bson:"_id"`
+	Country string
+	Pages   int `bson:",omitempty"`
+	secret  string
+}
+
+func TestPipelineBuilder_UntaggedFields(t *testing.T) {
+	_, err := mongoose.NewPipeline[Visitor]().
+		Match(bson.M{"country": "vn"}).
+		Sort(bson.D{{Key: "pages", Value: -1}}).
+		Build()
+	assert.Nil(t, err)
+
+	_, err = mongoose.NewPipeline[Visitor]().Match(bson.M{"secret": "x"}).Build()
+	assert.NotNil(t, err)
+}
+
+func TestAggregateInto(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	model := mongoose.NewModel[Sale]()
+	model.SetConnect(connect)
+
+	err := model.DeleteMany(nil)
+	require.Nil(t, err)
+
+	_, err = model.CreateMany([]*Sale{
+		{Item: "a", Region: "north", Amount: 10},
+		{Item: "b", Region: "north", Amount: 20},
+		{Item: "c", Region: "south", Amount: 5},
+	})
+	require.Nil(t, err)
+
+	hooks := 0
+	model.Pre(mongoose.Aggregate, func(params ...any) error {
+		hooks++
+		return nil
+	})
+
+	pipeline, err := model.Pipeline().
+		Group("$region", bson.D{
+			{Key: "total", Value: bson.M{"$sum": "$amount"}},
+			{Key: "count", Value: bson.M{"$sum": 1}},
+		}).
+		Sort(bson.D{{Key: "_id", Value: 1}}).
+		Build()
+	require.Nil(t, err)
+
+	reports, err := mongoose.AggregateInto[SaleReport](model, pipeline)
+	require.Nil(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "north", reports[0].Region)
+	assert.Equal(t, 30, reports[0].Total)
+	assert.Equal(t, 2, reports[0].Count)
+	assert.Equal(t, 1, hooks)
+
+	total := 0
+	err = mongoose.AggregateEach(model, pipeline, func(report *SaleReport) error {
+		total += report.Total
+		return nil
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 35, total)
+
+	strict := mongoose.NewModel[Sale](mongoose.ModelOptions{StrictFilters: true})
+	strict.SetConnect(connect)
+	unsafe, err := strict.Pipeline().Match(bson.M{"amount": bson.M{"$gt": 1}}).Build()
+	require.Nil(t, err)
+	_, err = mongoose.AggregateInto[Sale](strict, unsafe)
+	assert.True(t, mongoose.IsDangerousOperatorError(err))
+}
+
+type ShelfOwner struct {
+	Name string `bson:"name"`
+}
+
+type ShelfSlot struct {
+	Code string `bson:"code"`
+}
+
+type Shelf struct {
+	BaseSchema `bson:"inline"`
+	Label      string      `bson:"label"`
+	Owner      *ShelfOwner `bson:"owner"`
+	Slots      []ShelfSlot `bson:"slots"`
+	Extra      bson.M      `bson:"extra"`
+}
+
+func (s Shelf) CollectionName() string {
+	return "shelves"
+}
+
+func TestPipelineBuilder_NestedPaths(t *testing.T) {
+	_, err := mongoose.NewPipeline[Shelf]().
+		Match(bson.M{"owner.name": "ann", "slots.code": "a1", "slots.0.code": "a1", "extra.any.key": 1}).
+		Sort(bson.D{{Key: "owner.name", Value: 1}}).
+		Build()
+	assert.Nil(t, err)
+
+	_, err = mongoose.NewPipeline[Shelf]().Match(bson.M{"owner.nmae": "ann"}).Build()
+	var pathErr *mongoose.ErrInvalidFieldPath
+	require.ErrorAs(t, err, &pathErr)
+	assert.Equal(t, "owner.nmae", pathErr.Path)
+
+	_, err = mongoose.NewPipeline[Shelf]().Sort(bson.D{{Key: "slots.0.cdoe", Value: 1}}).Build()
+	assert.NotNil(t, err)
+
+	// Computed fields have no known shape
+	_, err = mongoose.NewPipeline[Shelf]().
+		Group("$label", bson.D{{Key: "owner", Value: bson.M{"$first": "$owner"}}}).
+		Sort(bson.D{{Key: "owner.anything", Value: 1}}).
+		Build()
+	assert.Nil(t, err)
+
+	// Included fields keep their shape
+	_, err = mongoose.NewPipeline[Shelf]().
+		Project(bson.D{{Key: "owner", Value: 1.0}}).
+		Sort(bson.D{{Key: "owner.nmae", Value: 1}}).
+		Build()
+	assert.NotNil(t, err)
+}
+
+func TestPipelineBuilder_FloatProjection(t *testing.T) {
+	// 0.0 excludes the field
+	_, err := mongoose.NewPipeline[Sale]().
+		Project(bson.D{{Key: "amount", Value: 0.0}}).
+		Sort(bson.D{{Key: "region", Value: 1}}).
+		Build()
+	assert.Nil(t, err)
+
+	// 1.0 includes it
+	_, err = mongoose.NewPipeline[Sale]().
+		Project(bson.D{{Key: "amount", Value: 1.0}}).
+		Sort(bson.D{{Key: "region", Value: 1}}).
+		Build()
+	assert.NotNil(t, err)
+}
+
+func TestPipelineBuilder_LogicalFilters(t *testing.T) {
+	_, err := mongoose.NewPipeline[Sale]().
+		Match(bson.D{{Key: "$and", Value: []interface{}{bson.M{"region": "north"}, bson.M{"city": "x"}}}}).
+		Build()
+	assert.NotNil(t, err)
+
+	_, err = mongoose.NewPipeline[Sale]().
+		Match(bson.M{"$nor": bson.A{bson.D{{Key: "region", Value: "north"}}, bson.M{"$or": bson.A{bson.M{"town": "x"}}}}}).
+		Build()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,539 @@
+package mongoose
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RefPath describes how a field is populated from another collection.
+// A ref (`ref:"authorId->users"`) matches the local ForeignKey against the
+// _id of From. A virtual (`virtual:"_id->posts.authorId"`) matches the
+// local ForeignKey against ForeignField of From, typically to load the
+// children of a has-many relation.
+type RefPath struct {
+	From         string
+	ForeignKey   string
+	As           string
+	Many         bool         // The populated field is a slice of documents
+	Type         reflect.Type // Struct type of the populated documents
+	ForeignField string       // Field of From matched by a virtual
+	Virtual      bool         // Declared with a virtual tag
+	Count        bool         // Virtual populating the number of matching documents
+	OnDelete     DeleteAction // Action applied when the referenced document is deleted
+}
+
+func (r *RefPath) foreignField() string {
+	if r.ForeignField == "" {
+		return "_id"
+	}
+	return r.ForeignField
+}
+
+// Populate is a populate path with options applied to the referenced
+// documents, translated into a $lookup sub-pipeline. The options apply to
+// the last ref of the path. Fields of the referenced model tagged
+// mongoose:"hidden" are always left out.
+//
+// Models have no soft delete, so no deleted filter is added to populated
+// documents. To leave out documents flagged as deleted, filter them with
+// Match, or with a find pre hook of the referenced model, which only runs
+// for batched paths.
+type Populate struct {
+	Path   string      // Ref path, e.g. "author" or "author.company"
+	Select bson.D      // Projection of the referenced documents
+	Match  interface{} // Filter of the referenced documents, checked like the filters of the model
+	Sort   bson.D      // Order of array refs, instead of the foreign keys order
+	Limit  int64       // Maximum number of documents of array refs
+	// Strategy populates the path with $lookup stages or batched queries,
+	// the PopulateStrategy of the model when PopulateDefault
+	Strategy PopulateStrategy
+	// Model loads the referenced documents of a batched path, the model
+	// registered on the connection for the ref collection when nil
+	Model ModelCommon
+}
+
+func (p *Populate) hasOptions() bool {
+	return p.Select != nil || p.Match != nil || p.Sort != nil || p.Limit > 0
+}
+
+// populates returns the refs as Populate paths followed by the populates.
+func populates(refs []string, populates []Populate) []Populate {
+	if len(refs) == 0 {
+		return populates
+	}
+	list := make([]Populate, 0, len(refs)+len(populates))
+	for _, ref := range refs {
+		list = append(list, Populate{Path: ref})
+	}
+	return append(list, populates...)
+}
+
+// DanglingRef describes a foreign key whose referenced document does not exist.
+type DanglingRef struct {
+	Ref      string      // Ref path as requested in Ref
+	ID       interface{} // Foreign key without a referenced document
+	Document interface{} // Pointer to the document holding the foreign key
+}
+
+// ErrDanglingRef is returned by Find and FindOne when StrictRefs is enabled
+// and a populated ref points to a missing document.
+type ErrDanglingRef struct {
+	DanglingRef
+}
+
+func (e *ErrDanglingRef) Error() string {
+	return fmt.Sprintf("dangling ref %s: referenced document %v not found", e.Ref, e.ID)
+}
+
+// ErrPopulateCycle is returned when a populate path follows the same ref
+// twice, e.g. "manager.manager" on a self-referencing model.
+type ErrPopulateCycle struct {
+	Path string
+	Ref  string
+}
+
+func (e *ErrPopulateCycle) Error() string {
+	return fmt.Sprintf("populate path %s: cycle detected at ref %s", e.Path, e.Ref)
+}
+
+// ErrPopulateDepth is returned when a populate path follows more refs than
+// the MaxPopulateDepth of the model.
+type ErrPopulateDepth struct {
+	Path     string
+	MaxDepth int
+}
+
+func (e *ErrPopulateDepth) Error() string {
+	return fmt.Sprintf("populate path %s exceeds max depth %d", e.Path, e.MaxDepth)
+}
+
+// DefaultMaxPopulateDepth is the number of refs a populate path may follow
+// when ModelOptions.MaxPopulateDepth is not set.
+const DefaultMaxPopulateDepth = 5
+
+func (m *Model[M]) getRefPath(ref string) *RefPath {
+	// Use cached ref paths from type info
+	typeInfo := GetTypeInfo[M]()
+	return typeInfo.refPath(ref)
+}
+
+// refPath returns the ref path by foreign key or by populated field name.
+func (info *TypeInfo) refPath(name string) *RefPath {
+	if refPath, ok := info.RefPaths[name]; ok {
+		return refPath
+	}
+	for _, refPath := range info.RefPaths {
+		if refPath.As == name {
+			return refPath
+		}
+	}
+	return nil
+}
+
+// lookupStages builds the stages populating the given paths.
+// Single refs are unwound into one document and documents with a null or
+// missing ref are preserved. Array refs are kept as an array in the order
+// of the foreign keys, skipping missing documents.
+// A path may be dotted ("author.company") going through populated refs,
+// embedded structs and arrays of subdocuments; each ref is resolved with
+// the cached RefPaths of the type it belongs to.
+// Invalid paths are skipped. Match is checked like the filters of the model.
+func (m *Model[M]) lookupStages(populates []Populate) ([]bson.M, error) {
+	maxDepth := m.option.MaxPopulateDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxPopulateDepth
+	}
+
+	builder := &populateBuilder{stages: []bson.M{}, maxDepth: maxDepth, done: map[string]bool{}}
+	var model M
+	for i := range populates {
+		// Match is embedded in the $lookup sub-pipeline of the query
+		if err := m.sanitizeFilter(populates[i].Match); err != nil {
+			return nil, err
+		}
+		if err := builder.populate(reflect.TypeOf(model), &populates[i]); err != nil {
+			return nil, err
+		}
+	}
+	return builder.stages, nil
+}
+
+// populateBuilder accumulates the stages of the populate paths of a query.
+type populateBuilder struct {
+	stages   []bson.M
+	maxDepth int
+	tmp      int
+	done     map[string]bool // Refs already populated, by path
+}
+
+// populateScope is the position of a path segment in the document.
+// prefix is the dotted path of the current subdocument. When array is set,
+// the current subdocument is an element of that array and prefix is
+// relative to the element.
+type populateScope struct {
+	info   *TypeInfo
+	prefix string
+	array  string
+	nested bool // Inside an array of an array, which cannot be populated
+}
+
+// populate appends the stages for one populate path. The options of the
+// path apply to its last ref. Paths that do not end on a ref are skipped.
+func (b *populateBuilder) populate(t reflect.Type, opt *Populate) error {
+	path := opt.Path
+	scope := populateScope{info: getTypeInfoOf(t)}
+	visited := map[*RefPath]bool{}
+	var stages []bson.M
+	var populated, fields []string
+	depth := 0
+	endsOnRef := false
+
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		endsOnRef = false
+		if refPath := scope.info.refPath(segment); refPath != nil {
+			if visited[refPath] {
+				return &ErrPopulateCycle{Path: path, Ref: segment}
+			}
+			visited[refPath] = true
+			depth++
+			if depth > b.maxDepth {
+				return &ErrPopulateDepth{Path: path, MaxDepth: b.maxDepth}
+			}
+			// Refs nested deeper inside array elements are not supported
+			if scope.nested || (scope.array != "" && scope.prefix != "") {
+				return nil
+			}
+
+			// Refs shared with a previous path are populated once
+			fields = append(fields, refPath.As)
+			key := strings.Join(fields, ".")
+			if i == len(segments)-1 && opt.hasOptions() {
+				stages = append(stages, b.refStages(scope, refPath, opt)...)
+			} else if !b.done[key] {
+				stages = append(stages, b.refStages(scope, refPath, nil)...)
+				populated = append(populated, key)
+			}
+			endsOnRef = true
+			info := &TypeInfo{}
+			if refPath.Type != nil {
+				info = getTypeInfoOf(refPath.Type)
+			}
+			scope = scope.enter(info, refPath.As, refPath.Many)
+			continue
+		}
+
+		field := scope.info.FieldsByBson[segment]
+		if field == nil {
+			return nil // Skip invalid ref names
+		}
+		elem, many := elemType(field.Type)
+		if elem.Kind() != reflect.Struct {
+			return nil
+		}
+		fields = append(fields, segment)
+		scope = scope.enter(getTypeInfoOf(elem), segment, many)
+	}
+
+	if endsOnRef {
+		b.stages = append(b.stages, stages...)
+		for _, key := range populated {
+			b.done[key] = true
+		}
+	}
+	return nil
+}
+
+// enter returns the scope of the subdocument at field.
+func (s populateScope) enter(info *TypeInfo, field string, many bool) populateScope {
+	next := populateScope{info: info, prefix: s.prefix, array: s.array, nested: s.nested}
+	if many {
+		if next.array != "" {
+			next.nested = true
+			return next
+		}
+		next.array = joinPath(s.prefix, field)
+		next.prefix = ""
+		return next
+	}
+	next.prefix = joinPath(s.prefix, field)
+	return next
+}
+
+// refStages returns the stages populating refPath at the given scope,
+// applying opt to the referenced documents when it is not nil.
+func (b *populateBuilder) refStages(scope populateScope, refPath *RefPath, opt *Populate) []bson.M {
+	inArray := scope.array != ""
+	sorted := opt != nil && opt.Sort != nil
+
+	lookup := bson.M{
+		"from":         refPath.From,
+		"localField":   joinPath(scope.array, joinPath(scope.prefix, refPath.ForeignKey)),
+		"foreignField": refPath.foreignField(),
+	}
+	if pipeline := lookupPipeline(refPath, opt, !inArray); len(pipeline) > 0 {
+		lookup["pipeline"] = pipeline
+	}
+
+	// Top-level refs are looked up in place
+	if scope.prefix == "" && !inArray {
+		lookup["as"] = refPath.As
+		stages := []bson.M{{"$lookup": lookup}}
+
+		switch {
+		case refPath.Count:
+			stages = append(stages, bson.M{"$addFields": bson.M{
+				refPath.As: bson.M{"$size": "$" + refPath.As},
+			}})
+		case refPath.Many:
+			// Sorted refs and virtuals keep the lookup order, and the
+			// foreign keys are lost when they are populated in place
+			if !sorted && !refPath.Virtual && refPath.As != refPath.ForeignKey {
+				stages = append(stages, bson.M{"$addFields": bson.M{
+					refPath.As: orderByKeys("$"+refPath.ForeignKey, "$"+refPath.As),
+				}})
+			}
+		default:
+			stages = append(stages, bson.M{"$unwind": bson.M{
+				"path":                       fmt.Sprintf("$%s", refPath.As),
+				"preserveNullAndEmptyArrays": true,
+			}})
+		}
+		return stages
+	}
+
+	// Nested refs are looked up in a temporary field and merged into
+	// their subdocument, so missing subdocuments stay missing
+	tmp := fmt.Sprintf("__populate%d", b.tmp)
+	b.tmp++
+	lookup["as"] = tmp
+
+	var local string
+	var docs interface{} = "$" + tmp
+	if inArray {
+		// The lookup is shared by every element of the array
+		local = "$$item." + refPath.ForeignKey
+		cond := bson.M{"$eq": bson.A{"$$doc." + refPath.foreignField(), local}}
+		if refPath.Many && !refPath.Virtual {
+			cond = bson.M{"$in": bson.A{"$$doc._id", bson.M{"$ifNull": bson.A{local, bson.A{}}}}}
+		}
+		docs = bson.M{"$filter": bson.M{"input": "$" + tmp, "as": "doc", "cond": cond}}
+	} else {
+		local = "$" + joinPath(scope.prefix, refPath.ForeignKey)
+	}
+
+	var value interface{}
+	switch {
+	case refPath.Count:
+		value = bson.M{"$size": docs}
+	case refPath.Many && (sorted || refPath.Virtual):
+		value = docs
+	case refPath.Many:
+		value = orderByKeys(local, "$"+tmp)
+	default:
+		value = bson.M{"$arrayElemAt": bson.A{docs, 0}}
+	}
+	if inArray && refPath.Many && !refPath.Count && opt != nil && opt.Limit > 0 {
+		value = bson.M{"$slice": bson.A{value, opt.Limit}}
+	}
+
+	var set bson.M
+	if inArray {
+		set = bson.M{scope.array: bson.M{"$map": bson.M{
+			"input": "$" + scope.array,
+			"as":    "item",
+			"in":    bson.M{"$mergeObjects": bson.A{"$$item", bson.M{refPath.As: value}}},
+		}}}
+	} else {
+		set = bson.M{scope.prefix: bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": "$" + scope.prefix}, "object"}},
+			bson.M{"$mergeObjects": bson.A{"$" + scope.prefix, bson.M{refPath.As: value}}},
+			"$" + scope.prefix,
+		}}}
+	}
+
+	return []bson.M{
+		{"$lookup": lookup},
+		{"$addFields": set},
+		{"$unset": tmp},
+	}
+}
+
+// lookupPipeline returns the $lookup sub-pipeline applying opt and removing
+// the hidden fields of the referenced model. The limit is only applied when
+// the lookup belongs to a single document.
+func lookupPipeline(refPath *RefPath, opt *Populate, limit bool) []bson.M {
+	pipeline := []bson.M{}
+	if opt != nil {
+		if opt.Match != nil {
+			pipeline = append(pipeline, bson.M{"$match": opt.Match})
+		}
+		if opt.Sort != nil {
+			pipeline = append(pipeline, bson.M{"$sort": opt.Sort})
+		}
+		if opt.Limit > 0 && limit {
+			pipeline = append(pipeline, bson.M{"$limit": opt.Limit})
+		}
+		if opt.Select != nil {
+			pipeline = append(pipeline, bson.M{"$project": opt.Select})
+		}
+	}
+	if refPath.Count {
+		return append(pipeline, bson.M{"$project": bson.M{"_id": 1}})
+	}
+	if refPath.Type != nil {
+		if hidden := getTypeInfoOf(refPath.Type).HiddenFields; len(hidden) > 0 {
+			pipeline = append(pipeline, bson.M{"$unset": hidden})
+		}
+	}
+	return pipeline
+}
+
+// orderByKeys returns an expression mapping the array of keys to the
+// documents of docs with a matching _id, keeping the order of keys and
+// dropping the keys without a document.
+func orderByKeys(keys string, docs string) bson.M {
+	return bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{keys, bson.A{}}},
+			"as":    "key",
+			"cond":  bson.M{"$in": bson.A{"$$key", docs + "._id"}},
+		}},
+		"as": "key",
+		"in": bson.M{"$arrayElemAt": bson.A{
+			docs,
+			bson.M{"$indexOfArray": bson.A{docs + "._id", "$$key"}},
+		}},
+	}}
+}
+
+// checkDanglingRefs reports the top-level populated refs of data whose foreign key is
+// set but whose referenced document is missing. It returns ErrDanglingRef
+// for the first one when strict is true, otherwise onDangling is called for
+// each of them.
+func (m *Model[M]) checkDanglingRefs(data []*M, paths []Populate, strict bool, onDangling func(DanglingRef)) error {
+	if !strict && onDangling == nil {
+		return nil
+	}
+
+	typeInfo := GetTypeInfo[M]()
+	for _, path := range paths {
+		// Filtered refs are expected to be missing
+		if path.Match != nil || path.Limit > 0 {
+			continue
+		}
+		ref := path.Path
+		refPath := m.getRefPath(ref)
+		if refPath == nil || refPath.Virtual || refPath.As == refPath.ForeignKey {
+			continue
+		}
+		keyField := typeInfo.FieldsByBson[refPath.ForeignKey]
+		asField := typeInfo.FieldsByBson[refPath.As]
+		if keyField == nil || asField == nil {
+			continue
+		}
+
+		for _, doc := range data {
+			v := reflect.ValueOf(doc).Elem()
+			keys, err := v.FieldByIndexErr(keyField.IndexPath)
+			if err != nil {
+				continue
+			}
+			populated, err := v.FieldByIndexErr(asField.IndexPath)
+			if err != nil {
+				continue
+			}
+
+			for _, id := range missingKeys(keys, populated, refPath.Many) {
+				dangling := DanglingRef{Ref: ref, ID: id, Document: doc}
+				if strict {
+					return &ErrDanglingRef{DanglingRef: dangling}
+				}
+				onDangling(dangling)
+			}
+		}
+	}
+	return nil
+}
+
+// missingKeys returns the foreign keys that have no matching populated document.
+func missingKeys(keys reflect.Value, populated reflect.Value, many bool) []interface{} {
+	if !many {
+		if keys.IsZero() || !populated.IsZero() {
+			return nil
+		}
+		return []interface{}{keys.Interface()}
+	}
+
+	if keys.Kind() != reflect.Slice || populated.Kind() != reflect.Slice {
+		return nil
+	}
+
+	found := make(map[interface{}]bool, populated.Len())
+	for i := 0; i < populated.Len(); i++ {
+		if id, ok := documentID(populated.Index(i)); ok {
+			found[id] = true
+		}
+	}
+
+	var missing []interface{}
+	for i := 0; i < keys.Len(); i++ {
+		key := keys.Index(i)
+		if key.IsZero() || !key.Comparable() {
+			continue
+		}
+		if !found[key.Interface()] {
+			missing = append(missing, key.Interface())
+		}
+	}
+	return missing
+}
+
+// documentID returns the value of the _id field of a struct or struct pointer.
+func documentID(v reflect.Value) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	idField := getTypeInfoOf(v.Type()).FieldsByBson["_id"]
+	if idField == nil {
+		return nil, false
+	}
+	id, err := v.FieldByIndexErr(idField.IndexPath)
+	if err != nil || !id.Comparable() {
+		return nil, false
+	}
+	return id.Interface(), true
+}
+
+// elemType returns the struct type behind pointers and slices of t, and
+// whether t is a slice.
+func elemType(t reflect.Type) (reflect.Type, bool) {
+	many := false
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		if t.Kind() != reflect.Ptr {
+			many = true
+		}
+		t = t.Elem()
+	}
+	return t, many
+}
+
+func joinPath(prefix string, field string) string {
+	if prefix == "" {
+		return field
+	}
+	if field == "" {
+		return prefix
+	}
+	return prefix + "." + field
+}
@@ -1,23 +1,67 @@
 package mongoose
 
 import (
+	"context"
+	"time"
+
+	"github.com/tinh-tinh/tinhtinh/v2/common"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
 )
 
+// ReadOptions holds the advanced read settings shared by Find, FindOne,
+// Count and Aggregate. Zero values are left to the server defaults.
+// Model-level defaults are set on ModelOptions and overridden per query.
+type ReadOptions struct {
+	Hint         interface{}        // Index name or key document to force
+	Collation    *options.Collation // e.g. &options.Collation{Locale: "en", Strength: 2} for case-insensitive sorting
+	MaxTime      time.Duration      // Server-side time limit (maxTimeMS)
+	AllowDiskUse *bool              // Allow sorts and stages to spill to disk, see Bool
+	Comment      string             // Tag shown in the profiler and currentOp
+	BatchSize    int32              // Number of documents per cursor batch, unused by single-document reads
+	ReadConcern  *readconcern.ReadConcern
+}
+
 type QueryOptions struct {
+	ReadOptions
 	Sort       bson.D
 	Projection bson.D
 	Ref        []string
+	Populate   []Populate // Populate paths with options, in addition to Ref
+	// Dangling refs have a foreign key but no referenced document.
+	// The populated field is left nil unless StrictRefs is set, in which
+	// case ErrDanglingRef is returned. OnDanglingRef is called for each of them.
+	StrictRefs    bool
+	OnDanglingRef func(DanglingRef)
+	// Find-only options, ignored when Ref is set
+	Min       interface{}
+	Max       interface{}
+	ReturnKey bool
+	// Cache reads through the cache of the model when enabled in ModelOptions.
+	// Queries with Ref or Populate are not cached. FindByID always caches.
+	Cache bool
 }
 
 type QueriesOptions struct {
+	ReadOptions
 	Sort       bson.D
 	Skip       int64
 	Limit      int64
 	Projection bson.D
 	Ref        []string
+	Populate   []Populate // Populate paths with options, in addition to Ref
+	// Dangling refs have a foreign key but no referenced document.
+	// The populated field is left nil unless StrictRefs is set, in which
+	// case ErrDanglingRef is returned. OnDanglingRef is called for each of them.
+	StrictRefs    bool
+	OnDanglingRef func(DanglingRef)
+	// Find-only options, ignored when Ref is set
+	Min        interface{}
+	Max        interface{}
+	ReturnKey  bool
+	CursorType *options.CursorType // e.g. options.Tailable for capped collections
 }
 
 // FindByID returns a single document that matches the id. The id is the
@@ -28,22 +72,28 @@ type QueriesOptions struct {
 //
 // FindByID returns an error if there is a problem with the query or the document
 // cannot be decoded. If no document matches the id, the function returns
-// nil, nil.
+// nil, nil. Results are cached when the model has a cache.
 func (m *Model[M]) FindByID(id interface{}, opt ...QueryOptions) (*M, error) {
 	query, err := m.getQueryId(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return m.FindOne(query, opt...)
+	findOpt := QueryOptions{}
+	if len(opt) > 0 {
+		findOpt = opt[0]
+	}
+	findOpt.Cache = true
+	return m.FindOne(query, findOpt)
 }
 
 // Count returns the number of documents that match the filter. The filter can be any
 // type that can be marshaled to a bson.D. It converts the filter to a BSON document
 // using ToDoc. The function then counts the number of documents that match the query
-// and returns the count as an int64. It returns an error if there is a problem with
-// the query or the counting operation fails.
-func (m *Model[M]) Count(filter interface{}) (int64, error) {
+// and returns the count as an int64. Skip, Limit and the ReadOptions of the given
+// QueriesOptions are applied to the count. It returns an error if there is a problem
+// with the query or the counting operation fails.
+func (m *Model[M]) Count(filter interface{}, opts ...QueriesOptions) (int64, error) {
 	err := ExecutePreHook(Count, m, filter)
 	if err != nil {
 		return 0, err
@@ -58,7 +108,38 @@ func (m *Model[M]) Count(filter interface{}) (int64, error) {
 		return 0, err
 	}
 
-	count, err := m.Collection.CountDocuments(m.Ctx, query)
+	var opt QueriesOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	read := m.readOptions(opt.ReadOptions)
+
+	countOpts := options.Count()
+	if read.Hint != nil {
+		countOpts.SetHint(read.Hint)
+	}
+	if read.Collation != nil {
+		countOpts.SetCollation(read.Collation)
+	}
+	if read.MaxTime != 0 {
+		countOpts.SetMaxTime(read.MaxTime)
+	}
+	if read.Comment != "" {
+		countOpts.SetComment(read.Comment)
+	}
+	if opt.Skip != 0 {
+		countOpts.SetSkip(opt.Skip)
+	}
+	if opt.Limit != 0 {
+		countOpts.SetLimit(opt.Limit)
+	}
+
+	collection, err := m.readCollection(read)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := collection.CountDocuments(m.Ctx, query, countOpts)
 	if err != nil {
 		return 0, err
 	}
@@ -98,13 +179,31 @@ func (m *Model[M]) FindOneAndUpdate(filter interface{}, data *M, opt ...*options
 		return nil, err
 	}
 
+	changes, err := m.snapshot(m.Ctx, query, 1, options.MergeFindOneAndUpdateOptions(opt...).Sort)
+	if err != nil {
+		return nil, err
+	}
+
 	var model M
-	err = m.Collection.FindOneAndUpdate(m.Ctx, query, bson.D{{Key: "$set", Value: upsert}}, opt...).Decode(&model)
+	err = m.Collection.FindOneAndUpdate(m.Ctx, changedQuery(query, changes), bson.D{{Key: "$set", Value: upsert}}, opt...).Decode(&model)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.invalidateCache(); err != nil {
+		return nil, err
+	}
+
+	changes, err = m.reloadOne(changes, model)
 	if err != nil {
 		return nil, err
 	}
 
-	err = ExecutePostHook(FindOneAndUpdate, m, model)
+	if err := m.track(m.Ctx, FindOneAndUpdate, changes); err != nil {
+		return nil, err
+	}
+
+	err = ExecutePostHook(FindOneAndUpdate, m, model, changes)
 	if err != nil {
 		return nil, err
 	}
@@ -137,6 +236,7 @@ func (m *Model[M]) FindByIDAndUpdate(id any, data *M, opt ...*options.FindOneAnd
 //
 // FindOneAndDelete returns an error if there is a problem with the query or the document cannot
 // be decoded. If no document matches the filter, the function returns nil, nil.
+// The onDelete actions of the refs to the document are applied.
 func (m *Model[M]) FindOneAndDelete(filter interface{}, opt ...*options.FindOneAndDeleteOptions) (*M, error) {
 	err := ExecutePreHook(FindOneAndDelete, m, filter)
 	if err != nil {
@@ -153,7 +253,19 @@ func (m *Model[M]) FindOneAndDelete(filter interface{}, opt ...*options.FindOneA
 	}
 
 	var model M
-	err = m.Collection.FindOneAndDelete(m.Ctx, query, opt...).Decode(&model)
+	findOpt := options.Find().SetLimit(1)
+	if sort := options.MergeFindOneAndDeleteOptions(opt...).Sort; sort != nil {
+		findOpt.SetSort(sort)
+	}
+	var deleted bson.Raw
+	err = m.deleteWithRefs(query, findOpt, func(ctx context.Context, filter interface{}) error {
+		raw, err := m.Collection.FindOneAndDelete(ctx, filter, opt...).Raw()
+		if err != nil {
+			return err
+		}
+		deleted = raw
+		return bson.Unmarshal(raw, &model)
+	})
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil
@@ -161,7 +273,24 @@ func (m *Model[M]) FindOneAndDelete(filter interface{}, opt ...*options.FindOneA
 		return nil, err
 	}
 
-	err = ExecutePostHook(FindOneAndDelete, m, model)
+	if err := m.invalidateCache(); err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	if m.tracksChanges() {
+		change, err := newChange(deleted, nil)
+		if err != nil {
+			return nil, err
+		}
+		changes = []Change{change}
+	}
+
+	if err := m.track(m.Ctx, FindOneAndDelete, changes); err != nil {
+		return nil, err
+	}
+
+	err = ExecutePostHook(FindOneAndDelete, m, model, changes)
 	if err != nil {
 		return nil, err
 	}
@@ -213,13 +342,31 @@ func (m *Model[M]) FindOneAndReplace(filter interface{}, data *M, opt ...*option
 		return nil, err
 	}
 
+	changes, err := m.snapshot(m.Ctx, query, 1, options.MergeFindOneAndReplaceOptions(opt...).Sort)
+	if err != nil {
+		return nil, err
+	}
+
 	var model M
-	err = m.Collection.FindOneAndReplace(m.Ctx, query, update, opt...).Decode(&model)
+	err = m.Collection.FindOneAndReplace(m.Ctx, changedQuery(query, changes), update, opt...).Decode(&model)
 	if err != nil {
 		return nil, err
 	}
 
-	err = ExecutePostHook(FindOneAndReplace, m, model)
+	if err := m.invalidateCache(); err != nil {
+		return nil, err
+	}
+
+	changes, err = m.reloadOne(changes, model)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.track(m.Ctx, FindOneAndReplace, changes); err != nil {
+		return nil, err
+	}
+
+	err = ExecutePostHook(FindOneAndReplace, m, model, changes)
 	if err != nil {
 		return nil, err
 	}
@@ -243,3 +390,48 @@ func (m *Model[M]) FindByIDAndReplace(id any, data *M, opt ...*options.FindOneAn
 
 	return m.FindOneAndReplace(query, data, opt...)
 }
+
+// Bool returns a pointer to v, to set the optional fields of ReadOptions.
+// A query setting AllowDiskUse to Bool(false) turns off a model default.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// readOptions merges the given per-query ReadOptions with the model defaults.
+// Non-zero per-query values take precedence, including pointers to false.
+func (m *Model[M]) readOptions(opt ReadOptions) ReadOptions {
+	return common.MergeStruct(opt, m.option.ReadOptions)
+}
+
+// readCollection returns the collection to read from, cloned with the read
+// concern of opt when one is set.
+func (m *Model[M]) readCollection(opt ReadOptions) (*mongo.Collection, error) {
+	if opt.ReadConcern == nil {
+		return m.Collection, nil
+	}
+	return m.Collection.Clone(options.Collection().SetReadConcern(opt.ReadConcern))
+}
+
+// aggregateOptions converts ReadOptions to driver options for Aggregate.
+func aggregateOptions(opt ReadOptions) *options.AggregateOptions {
+	aggOpts := options.Aggregate()
+	if opt.Hint != nil {
+		aggOpts.SetHint(opt.Hint)
+	}
+	if opt.Collation != nil {
+		aggOpts.SetCollation(opt.Collation)
+	}
+	if opt.MaxTime != 0 {
+		aggOpts.SetMaxTime(opt.MaxTime)
+	}
+	if opt.AllowDiskUse != nil {
+		aggOpts.SetAllowDiskUse(*opt.AllowDiskUse)
+	}
+	if opt.Comment != "" {
+		aggOpts.SetComment(opt.Comment)
+	}
+	if opt.BatchSize != 0 {
+		aggOpts.SetBatchSize(opt.BatchSize)
+	}
+	return aggOpts
+}
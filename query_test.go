@@ -3,10 +3,16 @@ package mongoose_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tinh-tinh/mongoose/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
 )
 
 type QueryTask struct {
@@ -326,3 +332,172 @@ func Test_StrictFilters_Query(t *testing.T) {
 		assert.NotContains(t, err.Error(), "dangerous MongoDB operator")
 	}
 }
+
+func Test_ReadOptions(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	model := mongoose.NewModel[QueryTask](mongoose.ModelOptions{
+		ID:        true,
+		Timestamp: true,
+		ReadOptions: mongoose.ReadOptions{
+			MaxTime: 5 * time.Second,
+			Comment: "read_options",
+		},
+	})
+	model.SetConnect(connect)
+
+	err := model.DeleteMany(nil)
+	require.Nil(t, err)
+
+	_, err = model.CreateMany([]*QueryTask{
+		{Name: "b", Status: "true"},
+		{Name: "A", Status: "true"},
+		{Name: "c", Status: "false"},
+	})
+	require.Nil(t, err)
+
+	caseInsensitive := &options.Collation{Locale: "en", Strength: 2}
+
+	data, err := model.Find(nil, mongoose.QueriesOptions{
+		ReadOptions: mongoose.ReadOptions{
+			Collation:    caseInsensitive,
+			AllowDiskUse: mongoose.Bool(true),
+			BatchSize:    1,
+			ReadConcern:  readconcern.Majority(),
+		},
+		Sort: bson.D{{Key: "name", Value: 1}},
+	})
+	require.Nil(t, err)
+	require.Len(t, data, 3)
+	assert.Equal(t, "A", data[0].Name)
+	assert.Equal(t, "b", data[1].Name)
+
+	first, err := model.FindOne(nil, mongoose.QueryOptions{
+		ReadOptions: mongoose.ReadOptions{Hint: bson.D{{Key: "_id", Value: 1}}},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, first)
+
+	total, err := model.Count(nil, mongoose.QueriesOptions{
+		ReadOptions: mongoose.ReadOptions{Hint: "_id_"},
+		Limit:       2,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+
+	results, err := model.Aggregate(mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": "true"}}},
+	}, mongoose.ReadOptions{AllowDiskUse: mongoose.Bool(true), Comment: "report"})
+	require.Nil(t, err)
+	assert.Len(t, results, 2)
+
+	_, err = model.Find(nil, mongoose.QueriesOptions{
+		ReadOptions: mongoose.ReadOptions{Hint: "missing_index"},
+	})
+	assert.NotNil(t, err)
+
+	// Queries turn off the defaults of the model
+	spilling := mongoose.NewModel[QueryTask](mongoose.ModelOptions{
+		ReadOptions: mongoose.ReadOptions{AllowDiskUse: mongoose.Bool(true)},
+	})
+	spilling.SetConnect(connect)
+	data, err = spilling.Find(nil, mongoose.QueriesOptions{
+		ReadOptions: mongoose.ReadOptions{AllowDiskUse: mongoose.Bool(false)},
+		Sort:        bson.D{{Key: "name", Value: 1}},
+	})
+	require.Nil(t, err)
+	assert.Len(t, data, 3)
+}
+
+func Test_FindNativeOptions(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	model := mongoose.NewModel[QueryTask]()
+	model.SetConnect(connect)
+
+	err := model.DeleteMany(nil)
+	require.Nil(t, err)
+
+	_, err = model.CreateMany([]*QueryTask{
+		{Name: "1", Status: "true"},
+		{Name: "2", Status: "false"},
+	})
+	require.Nil(t, err)
+
+	keys, err := model.Find(nil, mongoose.QueriesOptions{
+		ReadOptions: mongoose.ReadOptions{Hint: bson.D{{Key: "_id", Value: 1}}},
+		ReturnKey:   true,
+	})
+	require.Nil(t, err)
+	require.Len(t, keys, 2)
+	assert.False(t, keys[0].ID.IsZero())
+	assert.Equal(t, "", keys[0].Name)
+
+	first, err := model.FindOne(nil, mongoose.QueryOptions{
+		ReadOptions: mongoose.ReadOptions{Hint: bson.D{{Key: "_id", Value: 1}}},
+		Min:         bson.D{{Key: "_id", Value: keys[1].ID}},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, first)
+	assert.Equal(t, keys[1].ID, first.ID)
+
+	last, err := model.FindOne(nil, mongoose.QueryOptions{
+		ReadOptions: mongoose.ReadOptions{AllowDiskUse: mongoose.Bool(true)},
+		Sort:        bson.D{{Key: "name", Value: -1}},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, "2", last.Name)
+}
+
+// QueryTaskRef reads the documents of QueryTask with a ref, so Find takes
+// the pipeline path when the ref is populated.
+type QueryTaskRef struct {
+	BaseSchema `bson:"inline"`
+	Name       string             `bson:"name"`
+	Status     string             `bson:"status"`
+	OwnerID    primitive.ObjectID `bson:"ownerId,omitempty"`
+	Owner      *QueryTask         `bson:"owner,omitempty" ref:"ownerId->queries"`
+}
+
+func (t QueryTaskRef) CollectionName() string {
+	return "queries"
+}
+
+func Benchmark_Find_Native(b *testing.B) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	model := mongoose.NewModel[QueryTaskRef]()
+	model.SetConnect(connect)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := model.Find(bson.M{"status": "true"}, mongoose.QueriesOptions{
+			Sort:  bson.D{{Key: "name", Value: 1}},
+			Limit: 10,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_Find_Pipeline(b *testing.B) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	model := mongoose.NewModel[QueryTaskRef]()
+	model.SetConnect(connect)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The ref makes Find build an aggregation pipeline
+		_, err := model.Find(bson.M{"status": "true"}, mongoose.QueriesOptions{
+			Sort:  bson.D{{Key: "name", Value: 1}},
+			Limit: 10,
+			Ref:   []string{"ownerId"},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package mongoose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tinh-tinh/tinhtinh/v2/core"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultQueueCollection is the collection of the jobs of every queue.
+	DefaultQueueCollection = "mongoose_jobs"
+	DefaultVisibility      = 30 * time.Second
+	DefaultJobAttempts     = 5
+)
+
+// Status of a job.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead" // Dead letter, failed MaxAttempts times
+)
+
+var (
+	// ErrDuplicateJob is returned by Enqueue when a queued or running job of
+	// the queue has the same unique key.
+	ErrDuplicateJob = errors.New("a job with the same unique key is already queued")
+	// ErrJobLost is returned by Heartbeat, Complete and Fail when the
+	// visibility of the job expired and it was claimed again.
+	ErrJobLost = errors.New("job is no longer held by its worker")
+)
+
+// Job is a unit of work of a Queue, with a payload of type P.
+type Job[P any] struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Queue       string             `bson:"queue"`
+	Payload     P                  `bson:"payload"`
+	Status      string             `bson:"status"`
+	Priority    int                `bson:"priority"` // Higher priorities run first
+	RunAt       time.Time          `bson:"runAt"`
+	Attempts    int                `bson:"attempts"`
+	MaxAttempts int                `bson:"maxAttempts"`
+	UniqueKey   string             `bson:"uniqueKey,omitempty"`
+	ActiveKey   string             `bson:"activeKey,omitempty"` // UniqueKey while queued or running
+	LockedBy    string             `bson:"lockedBy,omitempty"`
+	LockedUntil time.Time          `bson:"lockedUntil,omitempty"`
+	LastError   string             `bson:"lastError,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt"`
+}
+
+func (j Job[P]) CollectionName() string {
+	return DefaultQueueCollection
+}
+
+type QueueOptions struct {
+	// Visibility is the time a claimed job stays hidden from other workers
+	// without a heartbeat, DefaultVisibility when zero
+	Visibility  time.Duration
+	MaxAttempts int // DefaultJobAttempts when zero
+	// Backoff returns the wait before retrying a failed job, exponential
+	// from one second up to five minutes when nil
+	Backoff func(attempts int) time.Duration
+}
+
+type EnqueueOptions struct {
+	UniqueKey   string // Rejects the job while another one with the key is queued or running
+	MaxAttempts int    // The MaxAttempts of the queue when zero
+}
+
+// Queue is a durable job queue stored in a collection. Jobs are claimed
+// atomically, kept hidden while their worker sends heartbeats, retried
+// with backoff and dead-lettered after MaxAttempts.
+type Queue[P any] struct {
+	*Model[Job[P]]
+	name string
+	opt  QueueOptions
+}
+
+// NewQueue returns the queue name, to be connected with SetConnect.
+func NewQueue[P any](name string, opts ...QueueOptions) *Queue[P] {
+	var opt QueueOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Visibility <= 0 {
+		opt.Visibility = DefaultVisibility
+	}
+	if opt.MaxAttempts <= 0 {
+		opt.MaxAttempts = DefaultJobAttempts
+	}
+	if opt.Backoff == nil {
+		opt.Backoff = exponentialBackoff
+	}
+
+	model := NewModel[Job[P]]()
+	model.Index(bson.D{
+		{Key: "queue", Value: 1},
+		{Key: "status", Value: 1},
+		{Key: "priority", Value: -1},
+		{Key: "runAt", Value: 1},
+	}, nil)
+	model.Index(bson.D{
+		{Key: "queue", Value: 1},
+		{Key: "activeKey", Value: 1},
+	}, options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"activeKey": bson.M{"$exists": true}}))
+
+	return &Queue[P]{Model: model, name: name, opt: opt}
+}
+
+// Name returns the name of the queue.
+func (q *Queue[P]) Name() string {
+	return q.name
+}
+
+// Enqueue adds a job running payload at runAt, or now when runAt is zero.
+func (q *Queue[P]) Enqueue(payload P, runAt time.Time, priority int, opts ...EnqueueOptions) (*Job[P], error) {
+	var opt EnqueueOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	if opt.MaxAttempts <= 0 {
+		opt.MaxAttempts = q.opt.MaxAttempts
+	}
+
+	job := &Job[P]{
+		Queue:       q.name,
+		Payload:     payload,
+		Status:      JobQueued,
+		Priority:    priority,
+		RunAt:       runAt,
+		MaxAttempts: opt.MaxAttempts,
+		UniqueKey:   opt.UniqueKey,
+		ActiveKey:   opt.UniqueKey,
+	}
+	_, err := q.Create(job)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateJob
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Claim atomically takes the next due job for worker, by priority then
+// runAt, including running jobs whose visibility expired. It returns nil
+// when no job is due.
+func (q *Queue[P]) Claim(ctx context.Context, worker string) (*Job[P], error) {
+	for {
+		now := time.Now()
+		filter := bson.M{
+			"queue": q.name,
+			"$or": bson.A{
+				bson.M{"status": JobQueued, "runAt": bson.M{"$lte": now}},
+				bson.M{"status": JobRunning, "lockedUntil": bson.M{"$lte": now}},
+			},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"status":      JobRunning,
+				"lockedBy":    worker,
+				"lockedUntil": now.Add(q.opt.Visibility),
+				"updatedAt":   now,
+			},
+			"$inc": bson.M{"attempts": 1},
+		}
+		opts := options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "runAt", Value: 1}}).
+			SetReturnDocument(options.After)
+
+		var job Job[P]
+		err := q.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Workers that stopped without failing the job count as attempts
+		if job.Attempts > job.MaxAttempts {
+			err := q.finish(ctx, &job, JobDead, "visibility timeout exceeded")
+			if err != nil && !errors.Is(err, ErrJobLost) {
+				return nil, err
+			}
+			continue
+		}
+		return &job, nil
+	}
+}
+
+// Heartbeat extends the visibility of a job claimed by worker. It returns
+// ErrJobLost when the job was claimed again in between.
+func (q *Queue[P]) Heartbeat(ctx context.Context, job *Job[P]) error {
+	until := time.Now().Add(q.opt.Visibility)
+	result, err := q.Collection.UpdateOne(ctx, q.held(job),
+		bson.M{"$set": bson.M{"lockedUntil": until}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("job %s: %w", job.ID.Hex(), ErrJobLost)
+	}
+	job.LockedUntil = until
+	return nil
+}
+
+// held returns the filter of job while it is held by the claim of job:
+// a new claim, even by the same worker, increments its attempts.
+func (q *Queue[P]) held(job *Job[P]) bson.M {
+	return bson.M{"_id": job.ID, "status": JobRunning, "lockedBy": job.LockedBy, "attempts": job.Attempts}
+}
+
+// Complete marks a claimed job as done, or returns ErrJobLost.
+func (q *Queue[P]) Complete(ctx context.Context, job *Job[P]) error {
+	return q.finish(ctx, job, JobDone, "")
+}
+
+// Fail retries a claimed job after the backoff, or dead-letters it when it
+// reached MaxAttempts. It returns ErrJobLost when the job was claimed again.
+func (q *Queue[P]) Fail(ctx context.Context, job *Job[P], cause error) error {
+	if job.Attempts >= job.MaxAttempts {
+		return q.finish(ctx, job, JobDead, cause.Error())
+	}
+	now := time.Now()
+	result, err := q.Collection.UpdateOne(ctx, q.held(job),
+		bson.M{
+			"$set": bson.M{
+				"status":    JobQueued,
+				"runAt":     now.Add(q.opt.Backoff(job.Attempts)),
+				"lastError": cause.Error(),
+				"updatedAt": now,
+			},
+			"$unset": bson.M{"lockedBy": "", "lockedUntil": ""},
+		},
+	)
+	return jobLost(job, result, err)
+}
+
+func (q *Queue[P]) finish(ctx context.Context, job *Job[P], status string, lastError string) error {
+	set := bson.M{"status": status, "updatedAt": time.Now()}
+	if lastError != "" {
+		set["lastError"] = lastError
+	}
+	result, err := q.Collection.UpdateOne(ctx, q.held(job),
+		bson.M{"$set": set, "$unset": bson.M{"activeKey": "", "lockedBy": "", "lockedUntil": ""}},
+	)
+	return jobLost(job, result, err)
+}
+
+// jobLost returns err, or ErrJobLost when the update of job matched nothing.
+func jobLost[P any](job *Job[P], result *mongo.UpdateResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("job %s: %w", job.ID.Hex(), ErrJobLost)
+	}
+	return nil
+}
+
+// Dead returns the dead-lettered jobs of the queue.
+func (q *Queue[P]) Dead() ([]*Job[P], error) {
+	return q.Find(bson.M{"queue": q.name, "status": JobDead}, QueriesOptions{
+		Sort: bson.D{{Key: "updatedAt", Value: 1}},
+	})
+}
+
+// Retry queues a dead-lettered job again with its attempts reset.
+func (q *Queue[P]) Retry(ctx context.Context, id primitive.ObjectID) error {
+	job, err := q.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if job == nil || job.Status != JobDead {
+		return fmt.Errorf("job %s is not dead", id.Hex())
+	}
+	set := bson.M{"status": JobQueued, "attempts": 0, "runAt": time.Now(), "updatedAt": time.Now()}
+	if job.UniqueKey != "" {
+		set["activeKey"] = job.UniqueKey
+	}
+	_, err = q.Collection.UpdateOne(ctx, bson.M{"_id": id, "status": JobDead}, bson.M{"$set": set})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateJob
+	}
+	return err
+}
+
+type JobHandler[P any] func(ctx context.Context, job *Job[P]) error
+
+type WorkerOptions struct {
+	Concurrency  int           // Jobs handled at once, 1 when zero
+	PollInterval time.Duration // Wait when no job is due, DefaultOutboxPoll when zero
+	Worker       string        // Name of the worker pool, random when empty
+}
+
+// Process runs handler on the jobs of the queue with a pool of workers
+// until ctx is done, then waits for the running jobs. Heartbeats are sent
+// while a job runs; the context of the job is canceled when one fails.
+// A job whose handler returns an error is retried or dead-lettered.
+// Process stops and returns the first error claiming a job or recording
+// its outcome, and nil once ctx is done. Jobs lost to another worker are
+// logged, as their new claim records them.
+func (q *Queue[P]) Process(ctx context.Context, handler JobHandler[P], opts ...WorkerOptions) error {
+	var opt WorkerOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = 1
+	}
+	if opt.PollInterval <= 0 {
+		opt.PollInterval = DefaultOutboxPoll
+	}
+	if opt.Worker == "" {
+		opt.Worker = consumerName()
+	}
+
+	poolCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	var once sync.Once
+	var poolErr error
+	fail := func(err error) {
+		once.Do(func() {
+			poolErr = err
+			stop()
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opt.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			for poolCtx.Err() == nil {
+				job, err := q.Claim(poolCtx, worker)
+				if err != nil {
+					if poolCtx.Err() == nil {
+						fail(err)
+					}
+					return
+				}
+				if job == nil {
+					select {
+					case <-poolCtx.Done():
+					case <-time.After(opt.PollInterval):
+					}
+					continue
+				}
+				err = q.run(poolCtx, job, handler)
+				if errors.Is(err, ErrJobLost) {
+					log.Println(err)
+				} else if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}(fmt.Sprintf("%s-%d", opt.Worker, i))
+	}
+	wg.Wait()
+	return poolErr
+}
+
+// run handles a claimed job, sending heartbeats until it returns, and
+// returns the error recording its outcome.
+func (q *Queue[P]) run(ctx context.Context, job *Job[P], handler JobHandler[P]) error {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(q.opt.Visibility / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+				if err := q.Heartbeat(jobCtx, job); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := handler(jobCtx, job)
+	// Record the outcome even when ctx is done
+	if err != nil {
+		return q.Fail(context.Background(), job, err)
+	}
+	return q.Complete(context.Background(), job)
+}
+
+// ForQueue creates a module which provides the queue name with payloads of
+// type P, connected with the CONNECT_MONGO provider. The name of the
+// provider is the name of the queue with "Queue_" prefixed.
+func ForQueue[P any](name string, opts ...QueueOptions) core.Modules {
+	return func(module core.Module) core.Module {
+		queueModule := module.New(core.NewModuleOptions{})
+		queueModule.NewProvider(core.ProviderOptions{
+			Name: GetQueueName(name),
+			Factory: func(param ...interface{}) interface{} {
+				connect := param[0].(*Connect)
+				queue := NewQueue[P](name, opts...)
+				queue.SetConnect(connect)
+
+				return queue
+			},
+			Inject: []core.Provide{CONNECT_MONGO},
+		})
+		queueModule.Export(GetQueueName(name))
+
+		return queueModule
+	}
+}
+
+// GetQueueName returns a unique name for a queue provider given a queue name.
+// The returned name is in the format "Queue_<queue_name>".
+func GetQueueName(name string) core.Provide {
+	return core.Provide("Queue_" + name)
+}
+
+// InjectQueue injects the queue provider name and returns its value as a
+// *Queue[P]. The queue provider is created by the ForQueue function.
+func InjectQueue[P any](module core.RefProvider, name string) *Queue[P] {
+	data, ok := module.Ref(GetQueueName(name)).(*Queue[P])
+	if !ok {
+		return nil
+	}
+
+	return data
+}
@@ -0,0 +1,179 @@
+package mongoose_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"github.com/tinh-tinh/tinhtinh/v2/core"
+)
+
+type Email struct {
+	To      string `bson:"to"`
+	Subject string `bson:"subject"`
+}
+
+func TestQueue(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	queue := mongoose.NewQueue[Email]("emails", mongoose.QueueOptions{
+		Visibility:  time.Second,
+		MaxAttempts: 2,
+		Backoff:     func(attempts int) time.Duration { return 0 },
+	})
+	queue.SetConnect(connect)
+	require.Nil(t, queue.DeleteMany(nil))
+
+	ctx := context.Background()
+	_, err := queue.Enqueue(Email{To: "low@mail.com"}, time.Time{}, 1)
+	require.Nil(t, err)
+	_, err = queue.Enqueue(Email{To: "high@mail.com"}, time.Time{}, 10, mongoose.EnqueueOptions{UniqueKey: "high"})
+	require.Nil(t, err)
+	_, err = queue.Enqueue(Email{To: "later@mail.com"}, time.Now().Add(time.Hour), 100)
+	require.Nil(t, err)
+
+	_, err = queue.Enqueue(Email{To: "high@mail.com"}, time.Time{}, 10, mongoose.EnqueueOptions{UniqueKey: "high"})
+	require.ErrorIs(t, err, mongoose.ErrDuplicateJob)
+
+	// Highest due priority first
+	job, err := queue.Claim(ctx, "worker")
+	require.Nil(t, err)
+	require.Equal(t, "high@mail.com", job.Payload.To)
+	require.Nil(t, queue.Heartbeat(ctx, job))
+	require.Nil(t, queue.Complete(ctx, job))
+
+	// The unique key is released once the job is done
+	_, err = queue.Enqueue(Email{To: "high@mail.com"}, time.Time{}, 0, mongoose.EnqueueOptions{UniqueKey: "high"})
+	require.Nil(t, err)
+
+	job, err = queue.Claim(ctx, "worker")
+	require.Nil(t, err)
+	require.Equal(t, "low@mail.com", job.Payload.To)
+
+	// Retried, then dead-lettered
+	require.Nil(t, queue.Fail(ctx, job, errors.New("smtp down")))
+	job, err = queue.Claim(ctx, "worker")
+	require.Nil(t, err)
+	require.Equal(t, "low@mail.com", job.Payload.To)
+	require.Equal(t, 2, job.Attempts)
+	require.Nil(t, queue.Fail(ctx, job, errors.New("smtp down")))
+
+	dead, err := queue.Dead()
+	require.Nil(t, err)
+	require.Len(t, dead, 1)
+	require.Equal(t, "smtp down", dead[0].LastError)
+
+	require.Nil(t, queue.Retry(ctx, dead[0].ID))
+	dead, err = queue.Dead()
+	require.Nil(t, err)
+	require.Len(t, dead, 0)
+}
+
+func TestQueue_Visibility(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	queue := mongoose.NewQueue[Email]("visibility", mongoose.QueueOptions{Visibility: 100 * time.Millisecond})
+	queue.SetConnect(connect)
+	require.Nil(t, queue.DeleteMany(nil))
+
+	ctx := context.Background()
+	_, err := queue.Enqueue(Email{To: "abc@mail.com"}, time.Time{}, 0)
+	require.Nil(t, err)
+
+	lost, err := queue.Claim(ctx, "a")
+	require.Nil(t, err)
+	require.NotNil(t, lost)
+
+	job, err := queue.Claim(ctx, "b")
+	require.Nil(t, err)
+	require.Nil(t, job)
+
+	// Worker a stopped sending heartbeats
+	time.Sleep(150 * time.Millisecond)
+	job, err = queue.Claim(ctx, "b")
+	require.Nil(t, err)
+	require.Equal(t, "b", job.LockedBy)
+	require.Equal(t, 2, job.Attempts)
+
+	// Worker a can no longer record the job of b
+	require.ErrorIs(t, queue.Heartbeat(ctx, lost), mongoose.ErrJobLost)
+	require.ErrorIs(t, queue.Complete(ctx, lost), mongoose.ErrJobLost)
+	require.ErrorIs(t, queue.Fail(ctx, lost, errors.New("timeout")), mongoose.ErrJobLost)
+	require.Nil(t, queue.Complete(ctx, job))
+}
+
+func TestQueue_Process(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	queue := mongoose.NewQueue[Email]("process", mongoose.QueueOptions{
+		Backoff: func(attempts int) time.Duration { return 0 },
+	})
+	queue.SetConnect(connect)
+	require.Nil(t, queue.DeleteMany(nil))
+
+	for i := 0; i < 10; i++ {
+		_, err := queue.Enqueue(Email{To: "abc@mail.com"}, time.Time{}, 0)
+		require.Nil(t, err)
+	}
+
+	var handled atomic.Int32
+	var failed atomic.Bool
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- queue.Process(ctx, func(ctx context.Context, job *mongoose.Job[Email]) error {
+			if failed.CompareAndSwap(false, true) {
+				return errors.New("retry")
+			}
+			if handled.Add(1) == 10 {
+				cancel()
+			}
+			return nil
+		}, mongoose.WorkerOptions{Concurrency: 4, PollInterval: 10 * time.Millisecond})
+	}()
+
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(10 * time.Second):
+		cancel()
+		t.Fatal("jobs were not processed")
+	}
+	require.Equal(t, int32(10), handled.Load())
+
+	count, err := queue.Count(map[string]interface{}{"queue": "process", "status": mongoose.JobDone})
+	require.Nil(t, err)
+	require.Equal(t, int64(10), count)
+}
+
+func Test_ModuleQueue(t *testing.T) {
+	appModule := func() core.Module {
+		uri := os.Getenv("MONGO_URI")
+		u, _ := url.Parse(uri)
+
+		u.Path = "/test"
+		modifiedURI := u.String()
+
+		module := core.NewModule(core.NewModuleOptions{
+			Imports: []core.Modules{
+				mongoose.ForRoot(modifiedURI),
+				mongoose.ForQueue[Email]("module_emails"),
+			},
+		})
+		return module
+	}
+
+	module := appModule()
+	queue := mongoose.InjectQueue[Email](module, "module_emails")
+	require.NotNil(t, queue)
+	require.Equal(t, "module_emails", queue.Name())
+}
@@ -0,0 +1,381 @@
+package mongoose
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultSyncBatchSize is the number of items written per BulkWrite by
+// SyncBy when SyncOptions.BatchSize is zero.
+const DefaultSyncBatchSize = 500
+
+type SyncOptions struct {
+	DeleteMissing bool // Deletes the documents whose key is not in the items
+	BatchSize     int  // Items per batch, DefaultSyncBatchSize when zero
+}
+
+// SyncResult counts the documents written by SyncBy.
+type SyncResult struct {
+	Inserted  int64
+	Updated   int64
+	Unchanged int64
+	Deleted   int64
+}
+
+// SyncBy upserts items by their natural key, the given bson fields.
+// Items are validated and every stored field is written, zero values
+// included; readonly fields are only set on insert. Existing documents keep
+// their _id and createdAt, and only changed ones get a new updatedAt.
+// With DeleteMissing, documents whose key is not in the items are deleted
+// like DeleteMany, by batches of _id. Each batch of items runs the
+// bulkWrite hooks.
+func (m *Model[M]) SyncBy(keys []string, items []*M, opts ...SyncOptions) (*SyncResult, error) {
+	var opt SyncOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = DefaultSyncBatchSize
+	}
+
+	typeInfo := GetTypeInfo[M]()
+	keyFields := make([]*FieldInfo, 0, len(keys))
+	for _, key := range keys {
+		field := typeInfo.FieldsByBson[key]
+		if field == nil {
+			return nil, &ErrInvalidFieldPath{Stage: "sync", Path: key}
+		}
+		keyFields = append(keyFields, field)
+	}
+
+	result := &SyncResult{}
+	synced := make(map[string]bool, len(items))
+	for start := 0; start < len(items); start += opt.BatchSize {
+		end := min(start+opt.BatchSize, len(items))
+		batchKeys, err := m.syncBatch(keys, keyFields, items[start:end], result)
+		if err != nil {
+			return result, err
+		}
+		for _, key := range batchKeys {
+			synced[key] = true
+		}
+	}
+
+	if opt.DeleteMissing {
+		deleted, err := m.syncDelete(keys, synced, opt.BatchSize)
+		result.Deleted = deleted
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// syncDelete deletes the documents whose key is not in synced, by batches
+// of _id so the queries stay small however many items were synced. The
+// deletes run like DeleteMany: hooks, onDelete actions of refs and
+// trackers.
+func (m *Model[M]) syncDelete(keys []string, synced map[string]bool, batchSize int) (int64, error) {
+	projection := bson.M{"_id": 1}
+	for _, key := range keys {
+		projection[key] = 1
+	}
+	cursor, err := m.Collection.Find(m.Ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(m.Ctx)
+
+	deleted := int64(0)
+	flush := func(ids bson.A) error {
+		res, err := m.deleteMany(bson.M{"_id": bson.M{"$in": ids}})
+		if res != nil {
+			deleted += res.DeletedCount
+		}
+		return err
+	}
+	missing := make(bson.A, 0, batchSize)
+	for cursor.Next(m.Ctx) {
+		if synced[rawKey(cursor.Current, keys)] {
+			continue
+		}
+		// Current is reused by the next batches
+		id := cursor.Current.Lookup("_id")
+		missing = append(missing, bson.RawValue{Type: id.Type, Value: bytes.Clone(id.Value)})
+		if len(missing) == batchSize {
+			if err := flush(missing); err != nil {
+				return deleted, err
+			}
+			missing = make(bson.A, 0, batchSize)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return deleted, err
+	}
+	if len(missing) > 0 {
+		if err := flush(missing); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// syncBatch upserts items, adding their counts to result. It returns the
+// keys of the items, as returned by rawKey.
+func (m *Model[M]) syncBatch(keys []string, keyFields []*FieldInfo, items []*M, result *SyncResult) ([]string, error) {
+	filters := make(bson.A, 0, len(items))
+	for _, item := range items {
+		v := reflect.ValueOf(item).Elem()
+		filter := make(bson.D, 0, len(keys))
+		for i, field := range keyFields {
+			filter = append(filter, bson.E{Key: keys[i], Value: v.FieldByIndex(field.IndexPath).Interface()})
+		}
+		filters = append(filters, filter)
+	}
+
+	// Existing documents by key
+	cursor, err := m.Collection.Find(m.Ctx, bson.M{"$or": filters})
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.Raw
+	if err := cursor.All(m.Ctx, &docs); err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bson.Raw, len(docs))
+	for _, doc := range docs {
+		existing[rawKey(doc, keys)] = doc
+	}
+
+	synced := make([]string, 0, len(items))
+	writes := make([]mongo.WriteModel, 0, len(items))
+	changed := int64(0)
+	var changes []Change
+	if m.tracksChanges() {
+		changes = []Change{}
+	}
+	for i, item := range items {
+		set, unset, err := m.syncUpdate(item)
+		if err != nil {
+			return nil, err
+		}
+		filter := filters[i].(bson.D)
+
+		raw, err := bson.Marshal(filter)
+		if err != nil {
+			return nil, err
+		}
+		key := rawKey(raw, keys)
+		synced = append(synced, key)
+		doc, found := existing[key]
+		update := bson.D{{Key: "$set", Value: set}}
+		if len(unset) > 0 {
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+		if found {
+			if !syncChanged(doc, set, unset) {
+				result.Unchanged++
+				continue
+			}
+			changed++
+			if changes != nil {
+				change, err := newChange(doc, nil)
+				if err != nil {
+					return nil, err
+				}
+				changes = append(changes, change)
+			}
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(filter).
+				SetUpdate(update))
+			continue
+		}
+
+		if onInsert := m.syncOnInsert(item); len(onInsert) > 0 {
+			update = append(update, bson.E{Key: "$setOnInsert", Value: onInsert})
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(update).
+			SetUpsert(true))
+	}
+	if len(writes) == 0 {
+		return synced, nil
+	}
+
+	err = ExecutePreHook(BulkWrite, m, writes)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.Collection.BulkWrite(m.Ctx, writes, options.BulkWrite().SetOrdered(false))
+	if cacheErr := m.invalidateCache(); cacheErr != nil && err == nil {
+		err = cacheErr
+	}
+	if res != nil {
+		result.Inserted += res.UpsertedCount
+		result.Updated += res.ModifiedCount
+		// Documents changed by someone else in between
+		result.Unchanged += changed - res.ModifiedCount
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if changes != nil {
+		for _, id := range res.UpsertedIDs {
+			changes = append(changes, Change{ID: id})
+		}
+		if err := m.reload(m.Ctx, changes); err != nil {
+			return nil, err
+		}
+		if err := m.track(m.Ctx, BulkWrite, changes); err != nil {
+			return nil, err
+		}
+	}
+
+	err = ExecutePostHook(BulkWrite, m, res, changes)
+	if err != nil {
+		return nil, err
+	}
+	return synced, nil
+}
+
+// syncUpdate validates item and returns the fields SyncBy sets and unsets
+// on its document: every stored field but _id, createdAt, readonly fields
+// and refs, zero values included, so a price set back to 0 or a flag to
+// false is synced. Zero fields tagged omitempty are unset, as they would
+// be left out of an inserted document.
+func (m *Model[M]) syncUpdate(item *M) (set bson.D, unset bson.D, err error) {
+	if err := m.validate(item); err != nil {
+		return nil, nil, err
+	}
+
+	typeInfo := GetTypeInfo[M]()
+	v := reflect.ValueOf(item).Elem()
+	set = bson.D{}
+	if m.option.Timestamp {
+		if field, exists := typeInfo.FieldsByBson["updatedAt"]; exists && field.Type == reflect.TypeOf(time.Time{}) {
+			set = append(set, bson.E{Key: "updatedAt", Value: time.Now()})
+		}
+	}
+	for _, field := range typeInfo.Fields {
+		if len(field.IndexPath) != 1 || field.RefTag != "" || field.VirtualTag != "" || field.HasOption("readonly") {
+			continue
+		}
+		name, flags, _ := strings.Cut(field.BsonTag, ",")
+		if name == "" || name == "-" || name == "_id" || name == "createdAt" || name == "updatedAt" || name == "inline" {
+			continue
+		}
+		value := v.Field(field.Index)
+		if value.IsZero() && slices.Contains(strings.Split(flags, ","), "omitempty") {
+			unset = append(unset, bson.E{Key: name, Value: ""})
+			continue
+		}
+		set = append(set, bson.E{Key: name, Value: value.Interface()})
+	}
+	return set, unset, nil
+}
+
+// syncOnInsert returns the fields only set when SyncBy inserts item: _id,
+// createdAt and readonly fields.
+func (m *Model[M]) syncOnInsert(item *M) bson.D {
+	typeInfo := GetTypeInfo[M]()
+	v := reflect.ValueOf(item).Elem()
+
+	onInsert := bson.D{}
+	if m.option.ID {
+		if field, exists := typeInfo.FieldsByBson["_id"]; exists && field.Type == reflect.TypeOf(primitive.ObjectID{}) {
+			onInsert = append(onInsert, bson.E{Key: "_id", Value: primitive.NewObjectID()})
+		}
+	}
+	if m.option.Timestamp {
+		if field, exists := typeInfo.FieldsByBson["createdAt"]; exists && field.Type == reflect.TypeOf(time.Time{}) {
+			onInsert = append(onInsert, bson.E{Key: "createdAt", Value: time.Now()})
+		}
+	}
+	for _, field := range typeInfo.Fields {
+		if len(field.IndexPath) != 1 || field.BsonTag == "" || !field.HasOption("readonly") {
+			continue
+		}
+		if value := v.Field(field.Index); !value.IsZero() {
+			onInsert = append(onInsert, bson.E{Key: bsonName(field.BsonTag), Value: value.Interface()})
+		}
+	}
+	return onInsert
+}
+
+// syncChanged reports whether a field of set differs from doc, updatedAt
+// excepted, or a field of unset is in doc.
+func syncChanged(doc bson.Raw, set bson.D, unset bson.D) bool {
+	for _, e := range unset {
+		if _, err := doc.LookupErr(e.Key); err == nil {
+			return true
+		}
+	}
+	for _, e := range set {
+		if e.Key == "updatedAt" {
+			continue
+		}
+		current, err := doc.LookupErr(e.Key)
+		if err != nil {
+			return true
+		}
+		raw, err := bson.Marshal(bson.D{e})
+		if err != nil {
+			return true
+		}
+		value := bson.Raw(raw).Lookup(e.Key)
+		if current.Type != value.Type || !bytes.Equal(current.Value, value.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// rawKey returns the key values of doc as a comparable string. Numbers are
+// compared by value, like MongoDB does, so an int32 key matches the same
+// number stored as an int64 or a double.
+func rawKey(doc bson.Raw, keys []string) string {
+	var key []byte
+	for _, name := range keys {
+		value, err := doc.LookupErr(name)
+		if err != nil {
+			key = append(key, 0)
+			continue
+		}
+		if n, ok := integral(value); ok {
+			key = append(key, byte(bson.TypeInt64))
+			key = binary.LittleEndian.AppendUint64(key, uint64(n))
+			continue
+		}
+		key = append(key, byte(value.Type))
+		key = append(key, value.Value...)
+	}
+	return string(key)
+}
+
+// integral returns the value of an int32, an int64 or an integral double.
+func integral(value bson.RawValue) (int64, bool) {
+	switch value.Type {
+	case bson.TypeInt32:
+		return int64(value.Int32()), true
+	case bson.TypeInt64:
+		return value.Int64(), true
+	case bson.TypeDouble:
+		f := value.Double()
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,151 @@
+package mongoose_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type CatalogItem struct {
+	BaseSchema `bson:"inline"`
+	Vendor     string `bson:"vendor"`
+	Sku        string `bson:"sku"`
+	Price      int    `bson:"price"`
+}
+
+func (c CatalogItem) CollectionName() string {
+	return "catalog_items"
+}
+
+func TestSyncBy(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[CatalogItem]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	keys := []string{"vendor", "sku"}
+	result, err := model.SyncBy(keys, []*CatalogItem{
+		{Vendor: "acme", Sku: "a", Price: 1},
+		{Vendor: "acme", Sku: "b", Price: 2},
+		{Vendor: "other", Sku: "a", Price: 3},
+	}, mongoose.SyncOptions{BatchSize: 2})
+	require.Nil(t, err)
+	assert.Equal(t, mongoose.SyncResult{Inserted: 3}, *result)
+
+	first, err := model.FindOne(bson.M{"vendor": "acme", "sku": "a"})
+	require.Nil(t, err)
+	require.NotNil(t, first)
+	assert.False(t, first.ID.IsZero())
+
+	result, err = model.SyncBy(keys, []*CatalogItem{
+		{Vendor: "acme", Sku: "a", Price: 10},
+		{Vendor: "acme", Sku: "b", Price: 2},
+		{Vendor: "acme", Sku: "c", Price: 4},
+	}, mongoose.SyncOptions{DeleteMissing: true})
+	require.Nil(t, err)
+	assert.Equal(t, mongoose.SyncResult{Inserted: 1, Updated: 1, Unchanged: 1, Deleted: 1}, *result)
+
+	updated, err := model.FindOne(bson.M{"vendor": "acme", "sku": "a"})
+	require.Nil(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, 10, updated.Price)
+	assert.Equal(t, first.ID, updated.ID)
+	assert.Equal(t, first.CreatedAt.UnixMilli(), updated.CreatedAt.UnixMilli())
+	assert.True(t, updated.UpdatedAt.After(first.UpdatedAt))
+
+	count, err := model.Count(nil)
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	_, err = model.SyncBy([]string{"unknown"}, nil)
+	assert.IsType(t, &mongoose.ErrInvalidFieldPath{}, err)
+}
+
+func TestSyncBy_DeleteMissing(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[CatalogItem]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	items := make([]*CatalogItem, 0, 5)
+	for _, sku := range []string{"a", "b", "c", "d", "e"} {
+		items = append(items, &CatalogItem{Vendor: "acme", Sku: sku, Price: 1})
+	}
+	_, err := model.SyncBy([]string{"sku"}, items)
+	require.Nil(t, err)
+
+	// Deleted by batches through the deleteMany hooks
+	batches := 0
+	model.Pre(mongoose.DeleteMany, func(params ...any) error {
+		batches++
+		return nil
+	})
+	result, err := model.SyncBy([]string{"sku"}, items[:1], mongoose.SyncOptions{DeleteMissing: true, BatchSize: 2})
+	require.Nil(t, err)
+	assert.Equal(t, int64(4), result.Deleted)
+	assert.Equal(t, 2, batches)
+
+	count, err := model.Count(nil)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+type StockLevel struct {
+	BaseSchema `bson:"inline"`
+	Code       int32  `bson:"code"`
+	Stock      int    `bson:"stock"`
+	Active     bool   `bson:"active"`
+	Note       string `bson:"note,omitempty"`
+}
+
+func (s StockLevel) CollectionName() string {
+	return "stock_levels"
+}
+
+func TestSyncBy_ZeroValues(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[StockLevel]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	_, err := model.SyncBy([]string{"code"}, []*StockLevel{{Code: 1, Stock: 5, Active: true, Note: "new"}})
+	require.Nil(t, err)
+
+	// Out of stock and inactive
+	result, err := model.SyncBy([]string{"code"}, []*StockLevel{{Code: 1}})
+	require.Nil(t, err)
+	assert.Equal(t, mongoose.SyncResult{Updated: 1}, *result)
+	level, err := model.FindOne(bson.M{"code": 1})
+	require.Nil(t, err)
+	require.NotNil(t, level)
+	assert.Equal(t, 0, level.Stock)
+	assert.False(t, level.Active)
+	assert.Empty(t, level.Note)
+
+	result, err = model.SyncBy([]string{"code"}, []*StockLevel{{Code: 1}})
+	require.Nil(t, err)
+	assert.Equal(t, mongoose.SyncResult{Unchanged: 1}, *result)
+
+	// Keys stored as other numeric types are still synced
+	_, err = model.Collection.InsertMany(connect.Ctx, []interface{}{
+		bson.M{"code": int64(2), "stock": 1},
+		bson.M{"code": float64(3), "stock": 1},
+	})
+	require.Nil(t, err)
+	result, err = model.SyncBy([]string{"code"}, []*StockLevel{{Code: 1}, {Code: 2}, {Code: 3}}, mongoose.SyncOptions{DeleteMissing: true})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), result.Deleted)
+	count, err := model.Count(nil)
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+}
@@ -0,0 +1,237 @@
+package mongoose
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotTemporal is returned by AsOf queries and Versions for a model
+// without Temporal.
+var ErrNotTemporal = errors.New("model is not temporal")
+
+// Version is an immutable state of a document, valid from ValidFrom until
+// ValidTo. The current version has no ValidTo.
+type Version[M any] struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	DocumentID interface{}        `bson:"documentId"`
+	Version    int64              `bson:"version"`
+	Operation  HookName           `bson:"operation"`
+	Doc        M                  `bson:"doc"`
+	ValidFrom  time.Time          `bson:"validFrom"`
+	ValidTo    *time.Time         `bson:"validTo,omitempty"`
+}
+
+type TemporalOptions struct {
+	Collection string // Collection of the versions, "<collection>_versions" when empty
+	// Retention is the time closed versions are kept after their ValidTo,
+	// forever when zero. Current versions are always kept.
+	Retention time.Duration
+}
+
+type temporal struct {
+	opt TemporalOptions
+}
+
+// Temporal stores a version of the documents of the model on every write
+// tracking changes, Save, Bulk, SyncBy, Import and fixtures included, and
+// closes it on delete, so AsOf can read them at any point in time.
+// Versions are written right after the write, in its transaction when it
+// runs in one, and numbered by a counter per document in
+// "<collection>_counters". Concurrent writes of a document outside a
+// transaction may record their versions in another order than they were
+// applied; the versions still never overlap. Writes made on Collection
+// directly are not versioned.
+func (m *Model[M]) Temporal(opts ...TemporalOptions) {
+	var opt TemporalOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Collection == "" {
+		opt.Collection = m.GetName() + "_versions"
+	}
+
+	m.temporal = &temporal{opt: opt}
+	m.trackers = append(m.trackers, m.storeVersions)
+	if m.connect != nil {
+		m.createVersionIndexes()
+	}
+}
+
+// createVersionIndexes creates the indexes of the versions collection of
+// the connection, when Temporal is called and on SetConnect. It runs with
+// the context of the connection, as indexes cannot be created in the
+// transaction of a write.
+func (m *Model[M]) createVersionIndexes() {
+	opt := m.temporal.opt
+	indexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "documentId", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}}
+	if opt.Retention > 0 {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "validTo", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(opt.Retention.Seconds())),
+		})
+	}
+	collection := m.connect.Client.Database(m.connect.DB).Collection(opt.Collection)
+	if _, err := collection.Indexes().CreateMany(m.connect.Ctx, indexes); err != nil {
+		log.Println(err)
+	}
+}
+
+// versionsCollection returns the collection of the versions.
+func (m *Model[M]) versionsCollection() (*mongo.Collection, error) {
+	if m.temporal == nil {
+		return nil, ErrNotTemporal
+	}
+	return m.connect.Client.Database(m.connect.DB).Collection(m.temporal.opt.Collection), nil
+}
+
+// storeVersions closes the current versions of the documents of changes
+// and stores their new versions.
+func (m *Model[M]) storeVersions(ctx context.Context, name HookName, changes []Change) error {
+	collection, err := m.versionsCollection()
+	if err != nil {
+		return err
+	}
+	counters := m.connect.Client.Database(m.connect.DB).Collection(m.temporal.opt.Collection + "_counters")
+
+	for _, change := range changes {
+		now := time.Now()
+		if change.After == nil {
+			_, err := collection.UpdateMany(ctx,
+				bson.M{"documentId": change.ID, "validTo": nil},
+				bson.M{"$set": bson.M{"validTo": now}},
+			)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The number is allocated before the insert, so concurrent writes
+		// never take the same one
+		var counter struct {
+			Version int64 `bson:"version"`
+		}
+		err := counters.FindOneAndUpdate(ctx,
+			bson.M{"_id": change.ID},
+			bson.M{"$inc": bson.M{"version": int64(1)}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&counter)
+		if err != nil {
+			return err
+		}
+		_, err = collection.InsertOne(ctx, bson.D{
+			{Key: "documentId", Value: change.ID},
+			{Key: "version", Value: counter.Version},
+			{Key: "operation", Value: name},
+			{Key: "doc", Value: change.After},
+			{Key: "validFrom", Value: now},
+		})
+		if err != nil {
+			return err
+		}
+
+		// Close the previous versions, and this one when a later version
+		// was stored in between
+		_, err = collection.UpdateMany(ctx,
+			bson.M{"documentId": change.ID, "validTo": nil, "version": bson.M{"$lt": counter.Version}},
+			bson.M{"$set": bson.M{"validTo": now}},
+		)
+		if err != nil {
+			return err
+		}
+		var next struct {
+			ValidFrom time.Time `bson:"validFrom"`
+		}
+		err = collection.FindOne(ctx,
+			bson.M{"documentId": change.ID, "version": bson.M{"$gt": counter.Version}},
+			options.FindOne().SetSort(bson.D{{Key: "version", Value: 1}}),
+		).Decode(&next)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = collection.UpdateOne(ctx,
+			bson.M{"documentId": change.ID, "version": counter.Version},
+			bson.M{"$set": bson.M{"validTo": next.ValidFrom}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AsOfQuery reads the documents of a temporal model as they were at a
+// point in time.
+type AsOfQuery[M any] struct {
+	model *Model[M]
+	at    time.Time
+}
+
+// AsOf returns a query of the documents as they were at t.
+func (m *Model[M]) AsOf(t time.Time) *AsOfQuery[M] {
+	return &AsOfQuery[M]{model: m, at: t}
+}
+
+// FindByID returns the document of id as it was at the time of the query,
+// or nil, nil when it did not exist then.
+func (q *AsOfQuery[M]) FindByID(id interface{}) (*M, error) {
+	m := q.model
+	collection, err := m.versionsCollection()
+	if err != nil {
+		return nil, err
+	}
+	query, err := m.getQueryId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var version Version[M]
+	err = collection.FindOne(m.Ctx, bson.M{
+		"documentId": query["_id"],
+		"validFrom":  bson.M{"$lte": q.at},
+		"$or":        bson.A{bson.M{"validTo": nil}, bson.M{"validTo": bson.M{"$gt": q.at}}},
+	}, options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&version)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &version.Doc, nil
+}
+
+// Versions returns the kept versions of the document of id, oldest first.
+func (m *Model[M]) Versions(id interface{}) ([]Version[M], error) {
+	collection, err := m.versionsCollection()
+	if err != nil {
+		return nil, err
+	}
+	query, err := m.getQueryId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(m.Ctx, bson.M{"documentId": query["_id"]},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	versions := []Version[M]{}
+	if err := cursor.All(m.Ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
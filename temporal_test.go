@@ -0,0 +1,152 @@
+package mongoose_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Price struct {
+	BaseSchema `bson:"inline"`
+	Sku        string `bson:"sku"`
+	Amount     int    `bson:"amount"`
+}
+
+func (p Price) CollectionName() string {
+	return "prices"
+}
+
+func TestTemporal(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	for _, name := range []string{"prices_versions", "prices_versions_counters"} {
+		_, err := connect.Client.Database("test").Collection(name).DeleteMany(connect.Ctx, bson.M{})
+		require.Nil(t, err)
+	}
+
+	model := mongoose.NewModel[Price]()
+	model.Temporal(mongoose.TemporalOptions{Retention: 24 * time.Hour})
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	price := &Price{Sku: "A1", Amount: 100}
+	_, err := model.Create(price)
+	require.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+	created := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = model.FindByIDAndUpdate(price.ID, &Price{Amount: 120})
+	require.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+	updated := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	require.Nil(t, model.DeleteByID(price.ID))
+
+	old, err := model.AsOf(created).FindByID(price.ID)
+	require.Nil(t, err)
+	require.Equal(t, 100, old.Amount)
+	old, err = model.AsOf(updated).FindByID(price.ID)
+	require.Nil(t, err)
+	require.Equal(t, 120, old.Amount)
+	old, err = model.AsOf(time.Now()).FindByID(price.ID)
+	require.Nil(t, err)
+	require.Nil(t, old)
+	old, err = model.AsOf(created.Add(-time.Hour)).FindByID(price.ID)
+	require.Nil(t, err)
+	require.Nil(t, old)
+
+	versions, err := model.Versions(price.ID)
+	require.Nil(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, int64(1), versions[0].Version)
+	require.Equal(t, mongoose.Create, versions[0].Operation)
+	require.NotNil(t, versions[0].ValidTo)
+	require.Equal(t, *versions[0].ValidTo, versions[1].ValidFrom)
+	require.Equal(t, mongoose.FindOneAndUpdate, versions[1].Operation)
+	require.NotNil(t, versions[1].ValidTo)
+
+	plain := mongoose.NewModel[Task]()
+	plain.SetConnect(connect)
+	_, err = plain.Versions(price.ID)
+	require.ErrorIs(t, err, mongoose.ErrNotTemporal)
+}
+
+func TestTemporal_Concurrent(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Price]()
+	model.Temporal(mongoose.TemporalOptions{Collection: "prices_concurrent_versions"})
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	price := &Price{Sku: "C1", Amount: 0}
+	_, err := model.Create(price)
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(amount int) {
+			defer wg.Done()
+			require.Nil(t, model.UpdateByID(price.ID, &Price{Amount: amount}))
+		}(i)
+	}
+	wg.Wait()
+
+	// Bulk writes are versioned too
+	_, err = model.Bulk().UpdateOne(bson.M{"_id": price.ID}, &Price{Amount: 50}).Exec(true)
+	require.Nil(t, err)
+
+	versions, err := model.Versions(price.ID)
+	require.Nil(t, err)
+	require.Len(t, versions, 12)
+	current := 0
+	for i, version := range versions {
+		require.Equal(t, int64(i+1), version.Version)
+		if version.ValidTo == nil {
+			current++
+		}
+	}
+	require.Equal(t, 1, current)
+	require.Equal(t, mongoose.BulkWrite, versions[11].Operation)
+	require.Nil(t, versions[11].ValidTo)
+}
+
+func TestTemporal_IndexesOutsideTransaction(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+	versions := connect.Client.Database("test").Collection("prices_tx_versions")
+	require.Nil(t, versions.Drop(connect.Ctx))
+
+	model := mongoose.NewModel[Price]()
+	model.SetConnect(connect)
+	model.Temporal(mongoose.TemporalOptions{Collection: "prices_tx_versions", Retention: time.Hour})
+	require.Nil(t, model.DeleteMany(nil))
+
+	// The first versioned write runs in a transaction
+	err := model.Transaction(func(session mongo.SessionContext) error {
+		_, err := model.WithContext(session).Create(&Price{Sku: "T1", Amount: 10})
+		return err
+	})
+	require.Nil(t, err)
+
+	var indexes []bson.M
+	cursor, err := versions.Indexes().List(connect.Ctx)
+	require.Nil(t, err)
+	require.Nil(t, cursor.All(connect.Ctx, &indexes))
+	names := []string{}
+	for _, index := range indexes {
+		names = append(names, index["name"].(string))
+	}
+	require.Contains(t, names, "documentId_1_version_1")
+	require.Contains(t, names, "validTo_1")
+}
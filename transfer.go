@@ -0,0 +1,758 @@
+package mongoose
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Format is a file format of Export and Import.
+type Format string
+
+const (
+	// FormatNDJSON is one relaxed Extended JSON document per line.
+	FormatNDJSON Format = "ndjson"
+	// FormatExtJSON is a JSON array of canonical Extended JSON documents,
+	// which keeps the exact type of every value.
+	FormatExtJSON Format = "extjson"
+	// FormatCSV has a header row of field names. ObjectIDs are written in
+	// hex, dates in RFC 3339 and documents and arrays in Extended JSON.
+	FormatCSV Format = "csv"
+)
+
+// DefaultImportBatchSize is the number of documents inserted at once by
+// Import when ImportOptions.BatchSize is zero.
+const DefaultImportBatchSize = 500
+
+// FormatOf returns the format of a file by its extension, "" when unknown.
+func FormatOf(file string) Format {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	case ".json", ".extjson":
+		return FormatExtJSON
+	case ".csv":
+		return FormatCSV
+	}
+	return ""
+}
+
+// Ext returns the file extension of the format.
+func (f Format) Ext() string {
+	switch f {
+	case FormatExtJSON:
+		return ".json"
+	case FormatCSV:
+		return ".csv"
+	}
+	return ".ndjson"
+}
+
+type ExportOptions struct {
+	// Fields are the columns of CSV, dotted paths allowed. They default to
+	// the fields of the model, or to the fields of the first document.
+	Fields []string
+	Sort   bson.D // By _id when nil
+	// Anonymizer replaces the PII fields of the model when set
+	Anonymizer *Anonymizer
+}
+
+type ImportOptions struct {
+	BatchSize int // DefaultImportBatchSize when zero
+	// Upsert replaces the documents with the same _id instead of failing.
+	// Rows without _id then fail with ErrUpsertWithoutID, as a new _id would
+	// duplicate them on every import.
+	Upsert bool
+}
+
+// ErrUpsertWithoutID is the error of the rows without _id of an Import with
+// Upsert.
+var ErrUpsertWithoutID = errors.New("_id is required to upsert")
+
+// RowError is the error of a row of Import. Rows are numbered from 1: lines
+// of NDJSON, documents of Extended JSON and records of CSV after the header.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ImportResult counts the rows of Import.
+type ImportResult struct {
+	Inserted int64
+	Replaced int64
+	Failed   int64
+	Errors   []*RowError
+}
+
+// Export streams the documents of the collection matching filter to w, and
+// returns the number of documents written. Documents are written as
+// stored, so fields unknown to the model are kept.
+func (m *Model[M]) Export(w io.Writer, filter interface{}, format Format, opts ...ExportOptions) (int64, error) {
+	var opt ExportOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Fields == nil && format == FormatCSV {
+		opt.Fields = csvFields(GetTypeInfo[M]())
+	}
+	if err := m.sanitizeFilter(filter); err != nil {
+		return 0, err
+	}
+	if opt.Anonymizer == nil {
+		return exportCollection(m.Ctx, m.Collection, w, filter, format, opt, nil)
+	}
+	return exportCollection(m.Ctx, m.Collection, w, filter, format, opt, func(doc bson.Raw) (bson.Raw, error) {
+		anonymized, err := m.Anonymize(doc, opt.Anonymizer)
+		if err != nil {
+			return nil, err
+		}
+		return bson.Marshal(anonymized)
+	})
+}
+
+// Import reads the documents of r and inserts them by batches. Each row is
+// decoded into M and validated like Create, without the Create hooks, and
+// the row is inserted as read so fields unknown to the model are kept.
+// _id and timestamps are only set when missing, and the trackers of the
+// model, like Audit, record the written rows. Invalid rows are reported
+// in the result; the error is for failures stopping the import.
+func (m *Model[M]) Import(r io.Reader, format Format, opts ...ImportOptions) (*ImportResult, error) {
+	typeInfo := GetTypeInfo[M]()
+	importer := &importer{
+		ctx:        m.Ctx,
+		collection: m.Collection,
+		types: func(name string) reflect.Type {
+			if field, exists := typeInfo.FieldsByBson[name]; exists {
+				return field.Type
+			}
+			return nil
+		},
+		prepare: m.prepareImport,
+	}
+	importer.track = m.trackImport
+	importer.inserted = func(ids []interface{}, docs []interface{}) error {
+		// Imports run no hooks
+		return m.afterInsert(CreateMany, nil, ids, docs)
+	}
+	result, err := importer.run(r, format, opts...)
+	if importer.opt.Upsert && result.Inserted+result.Replaced > 0 {
+		if cacheErr := m.invalidateCache(); cacheErr != nil && err == nil {
+			err = cacheErr
+		}
+	}
+	return result, err
+}
+
+// prepareImport validates doc as M and sets its missing defaults.
+func (m *Model[M]) prepareImport(doc bson.D) (bson.D, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	data := new(M)
+	if err := bson.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+	if err := m.validate(data); err != nil {
+		return nil, err
+	}
+
+	typeInfo := GetTypeInfo[M]()
+	now := time.Now()
+	if m.option.Timestamp {
+		for _, name := range []string{"createdAt", "updatedAt"} {
+			if field, exists := typeInfo.FieldsByBson[name]; exists && field.Type == reflect.TypeOf(time.Time{}) && !hasKey(doc, name) {
+				doc = append(doc, bson.E{Key: name, Value: now})
+			}
+		}
+	}
+	if m.option.ID {
+		if field, exists := typeInfo.FieldsByBson["_id"]; exists && field.Type == reflect.TypeOf(primitive.ObjectID{}) && !hasKey(doc, "_id") {
+			doc = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, doc...)
+		}
+	}
+	return doc, nil
+}
+
+// trackImport runs write, the upsert of an import batch, recording its
+// changes when the model tracks them.
+func (m *Model[M]) trackImport(batch []interface{}, write func() error) error {
+	if !m.tracksChanges() {
+		return write()
+	}
+	ids := make([]interface{}, 0, len(batch))
+	for _, doc := range batch {
+		if id := doc.(bson.D).Map()["_id"]; id != nil {
+			ids = append(ids, id)
+		}
+	}
+	changes, err := m.snapshotIDs(m.Ctx, ids)
+	if err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	if err := m.reload(m.Ctx, changes); err != nil {
+		return err
+	}
+	return m.track(m.Ctx, BulkWrite, changes)
+}
+
+// transferModel is implemented by Model[M] for the Export and Import of
+// Connect.
+type transferModel interface {
+	Export(w io.Writer, filter interface{}, format Format, opts ...ExportOptions) (int64, error)
+	Import(r io.Reader, format Format, opts ...ImportOptions) (*ImportResult, error)
+}
+
+// Export exports the documents of collection through its model when one is
+// set on the connection, or as stored otherwise.
+func (c *Connect) Export(w io.Writer, collection string, filter interface{}, format Format, opts ...ExportOptions) (int64, error) {
+	if m, ok := c.Model(collection).(transferModel); ok {
+		return m.Export(w, filter, format, opts...)
+	}
+	var opt ExportOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return exportCollection(c.Ctx, c.Client.Database(c.DB).Collection(collection), w, filter, format, opt, nil)
+}
+
+// Import imports documents into collection through its model when one is
+// set on the connection, with validation. Otherwise rows are inserted as
+// read, with an _id when missing, and CSV values are kept as strings.
+func (c *Connect) Import(r io.Reader, collection string, format Format, opts ...ImportOptions) (*ImportResult, error) {
+	if m, ok := c.Model(collection).(transferModel); ok {
+		return m.Import(r, format, opts...)
+	}
+	importer := &importer{
+		ctx:        c.Ctx,
+		collection: c.Client.Database(c.DB).Collection(collection),
+		types:      func(string) reflect.Type { return nil },
+		prepare: func(doc bson.D) (bson.D, error) {
+			if !hasKey(doc, "_id") {
+				doc = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, doc...)
+			}
+			return doc, nil
+		},
+	}
+	return importer.run(r, format, opts...)
+}
+
+// exportCollection writes the documents of collection, passed to transform
+// when it is not nil.
+func exportCollection(ctx context.Context, collection *mongo.Collection, w io.Writer, filter interface{}, format Format, opt ExportOptions, transform func(bson.Raw) (bson.Raw, error)) (int64, error) {
+	query, err := ToDoc(filter)
+	if err != nil {
+		return 0, err
+	}
+	if opt.Sort == nil {
+		opt.Sort = bson.D{{Key: "_id", Value: 1}}
+	}
+	cursor, err := collection.Find(ctx, query, options.Find().SetSort(opt.Sort))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var writer docWriter
+	switch format {
+	case FormatNDJSON:
+		writer = &jsonWriter{w: w}
+	case FormatExtJSON:
+		writer = &jsonWriter{w: w, array: true}
+	case FormatCSV:
+		writer = &csvWriter{w: csv.NewWriter(w), fields: opt.Fields}
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	count := int64(0)
+	for cursor.Next(ctx) {
+		doc := cursor.Current
+		if transform != nil {
+			if doc, err = transform(doc); err != nil {
+				return count, err
+			}
+		}
+		if err := writer.write(doc); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+	return count, writer.close()
+}
+
+type docWriter interface {
+	write(doc bson.Raw) error
+	close() error
+}
+
+type jsonWriter struct {
+	w       io.Writer
+	array   bool
+	written bool
+}
+
+func (j *jsonWriter) write(doc bson.Raw) error {
+	data, err := bson.MarshalExtJSON(doc, j.array, false)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if j.array {
+		prefix = ",\n"
+		if !j.written {
+			prefix = "[\n"
+		}
+	}
+	j.written = true
+	if _, err := io.WriteString(j.w, prefix); err != nil {
+		return err
+	}
+	if _, err := j.w.Write(data); err != nil {
+		return err
+	}
+	if !j.array {
+		_, err = io.WriteString(j.w, "\n")
+	}
+	return err
+}
+
+func (j *jsonWriter) close() error {
+	if !j.array {
+		return nil
+	}
+	end := "\n]\n"
+	if !j.written {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	fields  []string
+	written bool
+}
+
+func (c *csvWriter) write(doc bson.Raw) error {
+	if !c.written {
+		if c.fields == nil {
+			elements, err := doc.Elements()
+			if err != nil {
+				return err
+			}
+			for _, element := range elements {
+				c.fields = append(c.fields, element.Key())
+			}
+		}
+		if err := c.w.Write(c.fields); err != nil {
+			return err
+		}
+		c.written = true
+	}
+
+	record := make([]string, len(c.fields))
+	for i, field := range c.fields {
+		value, err := doc.LookupErr(strings.Split(field, ".")...)
+		if err != nil {
+			continue
+		}
+		record[i] = csvValue(value)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) close() error {
+	if !c.written && c.fields != nil {
+		if err := c.w.Write(c.fields); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func csvValue(value bson.RawValue) string {
+	switch value.Type {
+	case bsontype.String:
+		return value.StringValue()
+	case bsontype.ObjectID:
+		return value.ObjectID().Hex()
+	case bsontype.DateTime:
+		return value.Time().UTC().Format(time.RFC3339Nano)
+	case bsontype.Boolean:
+		return strconv.FormatBool(value.Boolean())
+	case bsontype.Int32:
+		return strconv.FormatInt(int64(value.Int32()), 10)
+	case bsontype.Int64:
+		return strconv.FormatInt(value.Int64(), 10)
+	case bsontype.Double:
+		return strconv.FormatFloat(value.Double(), 'g', -1, 64)
+	case bsontype.Null, bsontype.Undefined:
+		return ""
+	}
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return value.String()
+	}
+	// Strip {"v": and }
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}")
+}
+
+// csvFields returns the stored fields of a model, in order.
+func csvFields(typeInfo *TypeInfo) []string {
+	var fields []string
+	seen := map[string]bool{}
+	for _, field := range typeInfo.Fields {
+		name := bsonName(field.BsonTag)
+		if name == "" || name == "-" || name == "inline" || strings.Contains(field.BsonTag, ",inline") {
+			continue
+		}
+		// Populated documents are not stored
+		if field.RefTag != "" || field.VirtualTag != "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+type importer struct {
+	ctx        context.Context
+	collection *mongo.Collection
+	types      func(field string) reflect.Type // Type of a CSV column, nil for strings
+	prepare    func(doc bson.D) (bson.D, error)
+	// track runs write, the upsert of a batch, recording its changes
+	track func(batch []interface{}, write func() error) error
+	// inserted runs after the insert of a batch with its inserted documents
+	inserted func(ids []interface{}, docs []interface{}) error
+	opt      ImportOptions
+	result   *ImportResult
+	batch    []interface{}
+	rows     []int
+}
+
+func (im *importer) run(r io.Reader, format Format, opts ...ImportOptions) (*ImportResult, error) {
+	if len(opts) > 0 {
+		im.opt = opts[0]
+	}
+	if im.opt.BatchSize <= 0 {
+		im.opt.BatchSize = DefaultImportBatchSize
+	}
+	im.result = &ImportResult{}
+
+	var err error
+	switch format {
+	case FormatNDJSON:
+		err = im.readNDJSON(r)
+	case FormatExtJSON:
+		err = im.readExtJSON(r)
+	case FormatCSV:
+		err = im.readCSV(r)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err == nil {
+		err = im.flush()
+	}
+	return im.result, err
+}
+
+// add prepares the document of a row and flushes full batches.
+func (im *importer) add(row int, doc bson.D, err error) error {
+	if err == nil && im.opt.Upsert && !hasKey(doc, "_id") {
+		err = ErrUpsertWithoutID
+	}
+	if err == nil {
+		doc, err = im.prepare(doc)
+	}
+	if err != nil {
+		im.fail(row, err)
+		return nil
+	}
+	im.batch = append(im.batch, doc)
+	im.rows = append(im.rows, row)
+	if len(im.batch) >= im.opt.BatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+func (im *importer) fail(row int, err error) {
+	im.result.Failed++
+	im.result.Errors = append(im.result.Errors, &RowError{Row: row, Err: err})
+}
+
+func (im *importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	batch, rows := im.batch, im.rows
+	im.batch, im.rows = nil, nil
+
+	if im.opt.Upsert && im.track != nil {
+		return im.track(batch, func() error {
+			return im.write(batch, rows)
+		})
+	}
+	return im.write(batch, rows)
+}
+
+func (im *importer) write(batch []interface{}, rows []int) error {
+	if im.opt.Upsert {
+		writes := make([]mongo.WriteModel, 0, len(batch))
+		for _, doc := range batch {
+			id := doc.(bson.D).Map()["_id"]
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": id}).
+				SetReplacement(doc).
+				SetUpsert(true))
+		}
+		res, err := im.collection.BulkWrite(im.ctx, writes, options.BulkWrite().SetOrdered(false))
+		if res != nil {
+			im.result.Inserted += res.UpsertedCount
+			im.result.Replaced += res.MatchedCount
+		}
+		return im.writeErrors(err, rows)
+	}
+
+	res, err := im.collection.InsertMany(im.ctx, batch, options.InsertMany().SetOrdered(false))
+	failed := map[int]bool{}
+	var bulkErr mongo.BulkWriteException
+	switch {
+	case err == nil:
+	case errors.As(err, &bulkErr):
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[writeErr.Index] = true
+		}
+	default:
+		return err
+	}
+	im.result.Inserted += int64(len(batch) - len(failed))
+	if err := im.writeErrors(err, rows); err != nil {
+		return err
+	}
+	if im.inserted == nil || len(failed) == len(batch) {
+		return nil
+	}
+
+	// The ids of the result follow the order of the batch
+	var ids, docs []interface{}
+	for i, doc := range batch {
+		if !failed[i] {
+			ids = append(ids, res.InsertedIDs[i])
+			docs = append(docs, doc)
+		}
+	}
+	return im.inserted(ids, docs)
+}
+
+// writeErrors reports the write errors of a batch as row errors, and
+// returns the other errors.
+func (im *importer) writeErrors(err error, rows []int) error {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return err
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		im.fail(rows[writeErr.Index], writeErr)
+	}
+	return nil
+}
+
+func (im *importer) readNDJSON(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	// Documents are up to 16MB, larger in Extended JSON
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var doc bson.D
+		err := bson.UnmarshalExtJSON(line, false, &doc)
+		if err := im.add(row, doc, err); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (im *importer) readExtJSON(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if errors.Is(err, io.EOF) {
+		// Empty file
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("extended JSON must be an array of documents")
+	}
+	row := 0
+	for decoder.More() {
+		row++
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+		var doc bson.D
+		err := bson.UnmarshalExtJSON(raw, false, &doc)
+		if err := im.add(row, doc, err); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+func (im *importer) readCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	types := make([]reflect.Type, len(header))
+	for i, name := range header {
+		types[i] = im.types(name)
+	}
+
+	row := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		row++
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount) {
+			im.fail(row, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		doc, err := csvDoc(header, types, record)
+		if err := im.add(row, doc, err); err != nil {
+			return err
+		}
+	}
+}
+
+// csvDoc builds the document of a CSV record. Empty values are left out.
+func csvDoc(header []string, types []reflect.Type, record []string) (bson.D, error) {
+	doc := bson.D{}
+	for i, name := range header {
+		if record[i] == "" {
+			continue
+		}
+		value, err := parseCSVValue(record[i], types[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		doc = setPath(doc, strings.Split(name, "."), value)
+	}
+	return doc, nil
+}
+
+func parseCSVValue(s string, t reflect.Type) (interface{}, error) {
+	if t == nil {
+		return s, nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(primitive.ObjectID{}):
+		return primitive.ObjectIDFromHex(s)
+	case reflect.TypeOf(time.Time{}):
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	}
+
+	// Documents and arrays
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON([]byte(`{"v":`+s+`}`), false, &doc); err != nil {
+		return nil, err
+	}
+	return doc[0].Value, nil
+}
+
+// setPath sets the dotted path of doc to value.
+func setPath(doc bson.D, path []string, value interface{}) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = value
+			return doc
+		}
+		sub, _ := e.Value.(bson.D)
+		doc[i].Value = setPath(sub, path[1:], value)
+		return doc
+	}
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: value})
+	}
+	return append(doc, bson.E{Key: path[0], Value: setPath(bson.D{}, path[1:], value)})
+}
+
+func hasKey(doc bson.D, key string) bool {
+	for _, e := range doc {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
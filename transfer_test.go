@@ -0,0 +1,204 @@
+package mongoose_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Customer struct {
+	BaseSchema `bson:"inline"`
+	Name       string   `bson:"name" validate:"required"`
+	Email      string   `bson:"email" validate:"isEmail"`
+	Visits     int      `bson:"visits"`
+	Tags       []string `bson:"tags"`
+}
+
+func (c Customer) CollectionName() string {
+	return "customers"
+}
+
+func TestExportImport(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Customer]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	_, err := model.CreateMany([]*Customer{
+		{Name: "Alice", Email: "alice@mail.com", Visits: 3, Tags: []string{"vip"}},
+		{Name: "Bob", Email: "bob@mail.com", Visits: 1},
+	})
+	require.Nil(t, err)
+	customers, err := model.Find(nil, mongoose.QueriesOptions{Sort: bson.D{{Key: "_id", Value: 1}}})
+	require.Nil(t, err)
+
+	for _, format := range []mongoose.Format{mongoose.FormatNDJSON, mongoose.FormatExtJSON, mongoose.FormatCSV} {
+		var buf bytes.Buffer
+		count, err := model.Export(&buf, nil, format)
+		require.Nil(t, err)
+		require.Equal(t, int64(2), count)
+
+		require.Nil(t, model.DeleteMany(nil))
+		result, err := model.Import(&buf, format)
+		require.Nil(t, err, format)
+		require.Equal(t, int64(2), result.Inserted, format)
+		require.Empty(t, result.Errors, format)
+
+		// ObjectIDs and dates are kept
+		imported, err := model.Find(nil, mongoose.QueriesOptions{Sort: bson.D{{Key: "_id", Value: 1}}})
+		require.Nil(t, err)
+		require.Len(t, imported, 2)
+		for i := range customers {
+			require.Equal(t, customers[i].ID, imported[i].ID, format)
+			require.Equal(t, customers[i].Visits, imported[i].Visits, format)
+			require.True(t, customers[i].CreatedAt.Equal(imported[i].CreatedAt), format)
+		}
+		require.Equal(t, []string{"vip"}, imported[0].Tags, format)
+	}
+}
+
+func TestImport_RowErrors(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Customer]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	id := primitive.NewObjectID()
+	ndjson := strings.Join([]string{
+		`{"_id": {"$oid": "` + id.Hex() + `"}, "name": "Alice", "email": "alice@mail.com"}`,
+		`{"name": "", "email": "nobody@mail.com"}`,
+		`not json`,
+		``,
+		`{"_id": {"$oid": "` + id.Hex() + `"}, "name": "Alice", "email": "alice@mail.com"}`,
+		`{"name": "Carol", "email": "carol@mail.com", "legacy": true}`,
+	}, "\n")
+
+	result, err := model.Import(strings.NewReader(ndjson), mongoose.FormatNDJSON, mongoose.ImportOptions{BatchSize: 2})
+	require.Nil(t, err)
+	require.Equal(t, int64(2), result.Inserted)
+	require.Equal(t, int64(3), result.Failed)
+	rows := []int{}
+	for _, rowErr := range result.Errors {
+		rows = append(rows, rowErr.Row)
+	}
+	require.ElementsMatch(t, []int{2, 3, 5}, rows)
+
+	// Defaults are set, unknown fields kept
+	var carol bson.M
+	err = model.Collection.FindOne(connect.Ctx, bson.M{"name": "Carol"}).Decode(&carol)
+	require.Nil(t, err)
+	require.Equal(t, true, carol["legacy"])
+	require.NotNil(t, carol["createdAt"])
+
+	// Rows without _id would be duplicated by upserts
+	result, err = model.Import(strings.NewReader(ndjson), mongoose.FormatNDJSON, mongoose.ImportOptions{Upsert: true})
+	require.Nil(t, err)
+	require.Equal(t, int64(2), result.Replaced)
+	require.Equal(t, int64(0), result.Inserted)
+	require.ErrorIs(t, result.Errors[len(result.Errors)-1], mongoose.ErrUpsertWithoutID)
+	count, err := model.Count(bson.M{"name": "Carol"})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), count)
+
+	result, err = model.Import(strings.NewReader(" \n"), mongoose.FormatExtJSON)
+	require.Nil(t, err)
+	require.Equal(t, mongoose.ImportResult{}, *result)
+}
+
+func TestImport_CSV(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Customer]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	csv := "name,email,visits,tags,createdAt\n" +
+		"Alice,alice@mail.com,3,\"[\"\"a\"\",\"\"b\"\"]\",2024-01-02T03:04:05Z\n" +
+		"Bob,bob@mail.com,many,,\n" +
+		"Carol,carol@mail.com\n"
+	result, err := model.Import(strings.NewReader(csv), mongoose.FormatCSV)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), result.Inserted)
+	require.Len(t, result.Errors, 2)
+
+	alice, err := model.FindOne(bson.M{"name": "Alice"})
+	require.Nil(t, err)
+	require.Equal(t, 3, alice.Visits)
+	require.Equal(t, []string{"a", "b"}, alice.Tags)
+	require.True(t, alice.CreatedAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
+
+func TestConnect_Export(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	collection := connect.Client.Database("test").Collection("raw_events")
+	_, err := collection.DeleteMany(connect.Ctx, bson.M{})
+	require.Nil(t, err)
+	_, err = collection.InsertOne(connect.Ctx, bson.M{"kind": "login", "at": time.Now()})
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	count, err := connect.Export(&buf, "raw_events", nil, mongoose.FormatCSV)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), count)
+	require.True(t, strings.HasPrefix(buf.String(), "_id,kind,at\n"))
+
+	_, err = collection.DeleteMany(connect.Ctx, bson.M{})
+	require.Nil(t, err)
+	result, err := connect.Import(&buf, "raw_events", mongoose.FormatCSV)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), result.Inserted)
+}
+
+func TestFormatOf(t *testing.T) {
+	require.Equal(t, mongoose.FormatNDJSON, mongoose.FormatOf("users.ndjson"))
+	require.Equal(t, mongoose.FormatExtJSON, mongoose.FormatOf("users.JSON"))
+	require.Equal(t, mongoose.FormatCSV, mongoose.FormatOf("dir/users.csv"))
+	require.Equal(t, mongoose.Format(""), mongoose.FormatOf("users.txt"))
+	require.Equal(t, ".csv", mongoose.FormatCSV.Ext())
+}
+
+type Meter struct {
+	BaseSchema `bson:"inline"`
+	Name       string `bson:"name"`
+	Reading    uint32 `bson:"reading"`
+}
+
+func (m Meter) CollectionName() string {
+	return "meters"
+}
+
+func TestImport_CSVUnsigned(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Meter]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	csv := "name,reading\n" +
+		"a,4294967295\n" +
+		"b,-1\n"
+	result, err := model.Import(strings.NewReader(csv), mongoose.FormatCSV)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), result.Inserted)
+	require.Len(t, result.Errors, 1)
+	require.Equal(t, 2, result.Errors[0].Row)
+
+	meter, err := model.FindOne(bson.M{"name": "a"})
+	require.Nil(t, err)
+	require.Equal(t, uint32(4294967295), meter.Reading)
+}
@@ -2,6 +2,8 @@ package mongoose
 
 import (
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/tinh-tinh/tinhtinh/v2/common"
@@ -9,13 +11,16 @@ import (
 
 // FieldInfo caches reflection metadata for a single struct field
 type FieldInfo struct {
-	Index       int    // Field index in struct (direct index for top-level fields)
-	Name        string // Go field name
-	BsonTag     string // bson tag value
-	MongooseTag string // mongoose tag value (e.g., "readonly")
-	TypeName    string // Field type name (e.g., "BaseSchema")
-	RefTag      string // ref tag value for population
-	IndexPath   []int  // Full index path for nested fields (e.g., [0, 1] for embedded)
+	Index       int          // Field index in struct (direct index for top-level fields)
+	Name        string       // Go field name
+	BsonTag     string       // bson tag value
+	MongooseTag string       // mongoose tag value (e.g., "readonly,hidden")
+	TypeName    string       // Field type name (e.g., "BaseSchema")
+	RefTag      string       // ref tag value for population
+	VirtualTag  string       // virtual tag value for reverse population
+	OnDeleteTag string       // onDelete tag value of ref fields
+	IndexPath   []int        // Full index path for nested fields (e.g., [0, 1] for embedded)
+	Type        reflect.Type // Field type
 }
 
 // TypeInfo caches reflection metadata for a struct type
@@ -24,7 +29,9 @@ type TypeInfo struct {
 	Fields         []FieldInfo           // Ordered list of struct fields
 	FieldsByName   map[string]*FieldInfo // Lookup by field name (includes promoted fields)
 	FieldsByBson   map[string]*FieldInfo // Lookup by bson tag
-	RefPaths       map[string]*RefPath   // Cached ref paths by foreign key
+	RefPaths       map[string]*RefPath   // Cached ref paths by foreign key, virtuals by field name
+	HiddenFields   []string              // Fields tagged mongoose:"hidden", left out of populated documents
+	PIIFields      map[string]PII        // Kinds of the fields tagged mongoose:"pii=<kind>", by dotted bson path
 }
 
 // TypeCache is a thread-safe cache for type metadata
@@ -41,7 +48,15 @@ var globalTypeCache = &TypeCache{
 // GetTypeInfo returns cached TypeInfo for a given type, computing it if not cached
 func GetTypeInfo[M any]() *TypeInfo {
 	var m M
-	t := reflect.TypeOf(m)
+	return getTypeInfoOf(reflect.TypeOf(m))
+}
+
+// getTypeInfoOf returns cached TypeInfo for the struct type t, computing it if not cached.
+// Pointer types are dereferenced.
+func getTypeInfoOf(t reflect.Type) *TypeInfo {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 
 	// Fast path: check with read lock
 	globalTypeCache.mu.RLock()
@@ -61,22 +76,21 @@ func GetTypeInfo[M any]() *TypeInfo {
 		return info
 	}
 
-	info = computeTypeInfo[M]()
+	info = computeTypeInfo(t)
 	globalTypeCache.cache[t] = info
 	return info
 }
 
-// computeTypeInfo computes TypeInfo for a type using reflection
-func computeTypeInfo[M any]() *TypeInfo {
-	var model M
-	t := reflect.TypeOf(model)
-	v := reflect.ValueOf(&model).Elem()
+// computeTypeInfo computes TypeInfo for a struct type using reflection
+func computeTypeInfo(t reflect.Type) *TypeInfo {
+	v := reflect.New(t).Elem()
 
 	info := &TypeInfo{
 		Fields:       make([]FieldInfo, 0),
 		FieldsByName: make(map[string]*FieldInfo),
 		FieldsByBson: make(map[string]*FieldInfo),
 		RefPaths:     make(map[string]*RefPath),
+		PIIFields:    make(map[string]PII),
 	}
 
 	// Get collection name via CollectionName method or struct name
@@ -84,11 +98,12 @@ func computeTypeInfo[M any]() *TypeInfo {
 	if fnc.IsValid() {
 		info.CollectionName = fnc.Call(nil)[0].String()
 	} else {
-		info.CollectionName = common.GetStructName(model)
+		info.CollectionName = common.GetStructName(v.Interface())
 	}
 
 	// Phase 1: Collect all fields recursively (slice may reallocate)
 	collectFieldsRecursive(t, info, []int{})
+	collectPIIFields(t, "", info.PIIFields, map[reflect.Type]bool{})
 
 	// Phase 2: Build maps after slice is stable (no more appends)
 	for i := range info.Fields {
@@ -99,13 +114,18 @@ func computeTypeInfo[M any]() *TypeInfo {
 			info.FieldsByName[field.Name] = field
 		}
 
-		// Add to FieldsByBson
+		// Add to FieldsByBson, keyed by field name without tag options
 		if field.BsonTag != "" {
-			if _, exists := info.FieldsByBson[field.BsonTag]; !exists {
-				info.FieldsByBson[field.BsonTag] = field
+			name := bsonName(field.BsonTag)
+			if _, exists := info.FieldsByBson[name]; !exists {
+				info.FieldsByBson[name] = field
 			}
 		}
 
+		if field.HasOption("hidden") && field.BsonTag != "" {
+			info.HiddenFields = append(info.HiddenFields, bsonName(field.BsonTag))
+		}
+
 		// Parse ref tags for population
 		if field.RefTag != "" {
 			refPath := parseRefPath(*field)
@@ -113,11 +133,37 @@ func computeTypeInfo[M any]() *TypeInfo {
 				info.RefPaths[refPath.ForeignKey] = refPath
 			}
 		}
+
+		// Parse virtual tags for reverse population
+		if field.VirtualTag != "" {
+			refPath := parseVirtualPath(*field)
+			if refPath != nil {
+				info.RefPaths[refPath.As] = refPath
+			}
+		}
 	}
 
 	return info
 }
 
+// Option returns the value of a comma separated option of the mongoose tag,
+// e.g. Option("pii") is "email" for `mongoose:"readonly,pii=email"`.
+func (f FieldInfo) Option(name string) (string, bool) {
+	for _, opt := range strings.Split(f.MongooseTag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		if key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// HasOption reports whether the mongoose tag contains the option name.
+func (f FieldInfo) HasOption(name string) bool {
+	_, ok := f.Option(name)
+	return ok
+}
+
 // collectFieldsRecursive collects fields including promoted fields from embedded structs
 func collectFieldsRecursive(t reflect.Type, info *TypeInfo, indexPath []int) {
 	for i := 0; i < t.NumField(); i++ {
@@ -131,7 +177,10 @@ func collectFieldsRecursive(t reflect.Type, info *TypeInfo, indexPath []int) {
 			MongooseTag: field.Tag.Get("mongoose"),
 			TypeName:    field.Type.Name(),
 			RefTag:      field.Tag.Get("ref"),
+			VirtualTag:  field.Tag.Get("virtual"),
+			OnDeleteTag: field.Tag.Get("onDelete"),
 			IndexPath:   currentIndex,
+			Type:        field.Type,
 		}
 		info.Fields = append(info.Fields, fieldInfo)
 
@@ -142,6 +191,45 @@ func collectFieldsRecursive(t reflect.Type, info *TypeInfo, indexPath []int) {
 	}
 }
 
+// collectPIIFields adds the fields of t tagged mongoose:"pii=<kind>" to
+// fields by their dotted bson path under prefix, walking inlined and
+// embedded structs, and slices and pointers of them.
+func collectPIIFields(t reflect.Type, prefix string, fields map[string]PII, walking map[reflect.Type]bool) {
+	if walking[t] {
+		return
+	}
+	walking[t] = true
+	defer delete(walking, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("bson")
+		if tag == "-" || (tag == "" && !field.Anonymous) {
+			continue
+		}
+		if tag == "" || slices.Contains(strings.Split(tag, ","), "inline") {
+			if field.Type.Kind() == reflect.Struct {
+				collectPIIFields(field.Type, prefix, fields, walking)
+			}
+			continue
+		}
+
+		path := prefix + bsonName(tag)
+		info := FieldInfo{MongooseTag: field.Tag.Get("mongoose")}
+		if kind, ok := info.Option("pii"); ok {
+			fields[path] = PII(kind)
+			continue
+		}
+		elem := field.Type
+		for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct {
+			collectPIIFields(elem, path+".", fields, walking)
+		}
+	}
+}
+
 // parseRefPath parses a ref tag into a RefPath struct
 func parseRefPath(field FieldInfo) *RefPath {
 	if field.RefTag == "" {
@@ -167,11 +255,60 @@ func parseRefPath(field FieldInfo) *RefPath {
 		return nil
 	}
 
-	return &RefPath{
+	refPath := &RefPath{
 		From:       foreignCol,
 		ForeignKey: foreignKey,
-		As:         field.BsonTag,
+		As:         bsonName(field.BsonTag),
+	}
+	switch action := DeleteAction(field.OnDeleteTag); action {
+	case Restrict, Cascade, SetNull:
+		refPath.OnDelete = action
+	}
+	if field.Type != nil {
+		elem, many := elemType(field.Type)
+		refPath.Many = many
+		if elem.Kind() == reflect.Struct {
+			refPath.Type = elem
+		}
+	}
+	return refPath
+}
+
+// parseVirtualPath parses a virtual tag into a RefPath struct.
+// Virtual fields are populated only, they should be tagged omitempty so
+// that they are not stored with the document.
+func parseVirtualPath(field FieldInfo) *RefPath {
+	if field.BsonTag == "" {
+		return nil
+	}
+
+	// virtual tag format: "localField->collectionName.foreignField[,count]"
+	tag, count := strings.CutSuffix(field.VirtualTag, ",count")
+	localField, target, found := strings.Cut(tag, "->")
+	if !found || localField == "" {
+		return nil
+	}
+	foreignCol, foreignField, found := strings.Cut(target, ".")
+	if !found || foreignCol == "" || foreignField == "" {
+		return nil
+	}
+
+	refPath := &RefPath{
+		From:         foreignCol,
+		ForeignKey:   localField,
+		As:           bsonName(field.BsonTag),
+		ForeignField: foreignField,
+		Virtual:      true,
+		Count:        count,
+	}
+	if field.Type != nil && !count {
+		elem, many := elemType(field.Type)
+		refPath.Many = many
+		if elem.Kind() == reflect.Struct {
+			refPath.Type = elem
+		}
 	}
+	return refPath
 }
 
 // GetCachedCollectionName returns the cached collection name for type M
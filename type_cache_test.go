@@ -6,6 +6,7 @@ import (
 
 	"github.com/tinh-tinh/mongoose/v2"
 	"github.com/tinh-tinh/tinhtinh/v2/common"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // BenchmarkModel for testing cached type info performance
@@ -177,3 +178,113 @@ func TestRefPath_NoRefTags(t *testing.T) {
 		t.Errorf("Expected empty RefPaths, got %d entries", len(typeInfo.RefPaths))
 	}
 }
+
+// ModelWithManyRef has a slice ref field
+type ModelWithManyRef struct {
+	BaseSchema `bson:"inline"`
+	TagIDs     []primitive.ObjectID `bson:"tagIds"`
+	Tags       []*ModelNoRef        `bson:"tags" ref:"tagIds->models_no_ref"`
+	Owner      *ModelNoRef          `bson:"owner" ref:"ownerId->models_no_ref"`
+}
+
+// TestRefPath_Many tests that slice ref fields are marked as many
+func TestRefPath_Many(t *testing.T) {
+	typeInfo := mongoose.GetTypeInfo[ModelWithManyRef]()
+
+	if refPath := typeInfo.RefPaths["tagIds"]; refPath == nil || !refPath.Many {
+		t.Error("Expected tagIds refPath to be many")
+	}
+	if refPath := typeInfo.RefPaths["ownerId"]; refPath == nil || refPath.Many {
+		t.Error("Expected ownerId refPath to be single")
+	}
+}
+
+// ModelWithOptions has multi-valued mongoose tags
+type ModelWithOptions struct {
+	Name     string `bson:"name" mongoose:"readonly,hidden"`
+	Email    string `bson:"email,omitempty" mongoose:"pii=email"`
+	Password string `bson:"password" mongoose:"hidden"`
+}
+
+// TestFieldInfo_Option tests mongoose tag option parsing
+func TestFieldInfo_Option(t *testing.T) {
+	typeInfo := mongoose.GetTypeInfo[ModelWithOptions]()
+
+	name := typeInfo.FieldsByBson["name"]
+	if !name.HasOption("readonly") || !name.HasOption("hidden") {
+		t.Error("Expected name to be readonly and hidden")
+	}
+
+	email := typeInfo.FieldsByBson["email"]
+	if email == nil {
+		t.Fatal("Expected email to be indexed without tag options")
+	}
+	if value, ok := email.Option("pii"); !ok || value != "email" {
+		t.Errorf("Expected pii=email, got '%s'", value)
+	}
+	if email.HasOption("hidden") {
+		t.Error("Expected email not to be hidden")
+	}
+
+	if !reflect.DeepEqual(typeInfo.HiddenFields, []string{"name", "password"}) {
+		t.Errorf("Unexpected hidden fields %v", typeInfo.HiddenFields)
+	}
+}
+
+// ModelWithVirtual declares virtual relations
+type ModelWithVirtual struct {
+	BaseSchema `bson:"inline"`
+	Posts      []ModelNoRef `bson:"posts,omitempty" virtual:"_id->posts.authorId"`
+	PostCount  int          `bson:"postCount,omitempty" virtual:"_id->posts.authorId,count"`
+	Invalid    []ModelNoRef `bson:"invalid,omitempty" virtual:"_id->posts"`
+}
+
+// TestRefPath_Virtual tests that virtual tags are cached by field name
+func TestRefPath_Virtual(t *testing.T) {
+	typeInfo := mongoose.GetTypeInfo[ModelWithVirtual]()
+
+	posts := typeInfo.RefPaths["posts"]
+	if posts == nil {
+		t.Fatal("Expected posts virtual to be cached")
+	}
+	if !posts.Virtual || !posts.Many || posts.Count {
+		t.Errorf("Unexpected posts virtual %+v", posts)
+	}
+	if posts.From != "posts" || posts.ForeignKey != "_id" || posts.ForeignField != "authorId" {
+		t.Errorf("Unexpected posts virtual %+v", posts)
+	}
+
+	count := typeInfo.RefPaths["postCount"]
+	if count == nil || !count.Count || count.Many {
+		t.Errorf("Unexpected postCount virtual %+v", count)
+	}
+
+	if typeInfo.RefPaths["invalid"] != nil {
+		t.Error("Expected virtual without foreign field to be ignored")
+	}
+}
+
+func TestRefPath_OnDelete(t *testing.T) {
+	type Parent struct {
+		Name string `bson:"name"`
+	}
+	type Child struct {
+		ParentID  string    `bson:"parentId"`
+		Parent    *Parent   `bson:"parent" ref:"parentId->parents" onDelete:"cascade"`
+		OwnerIDs  []string  `bson:"ownerIds"`
+		Owners    []*Parent `bson:"owners" ref:"ownerIds->parents" onDelete:"setNull"`
+		GuestID   string    `bson:"guestId"`
+		Guest     *Parent   `bson:"guest" ref:"guestId->parents" onDelete:"unknown"`
+	}
+
+	info := mongoose.GetTypeInfo[Child]()
+	if action := info.RefPaths["parentId"].OnDelete; action != mongoose.Cascade {
+		t.Errorf("Expected cascade, got %q", action)
+	}
+	if action := info.RefPaths["ownerIds"].OnDelete; action != mongoose.SetNull {
+		t.Errorf("Expected setNull, got %q", action)
+	}
+	if action := info.RefPaths["guestId"].OnDelete; action != mongoose.NoAction {
+		t.Errorf("Expected no action for unknown values, got %q", action)
+	}
+}
@@ -0,0 +1,215 @@
+package mongoose
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultResumeTokenCollection is the collection of the model database
+// storing resume tokens when WatchOptions.Store is nil.
+const DefaultResumeTokenCollection = "mongoose_resume_tokens"
+
+// ChangeEvent is a change of a document of M, decoded from a change stream.
+type ChangeEvent[M any] struct {
+	ID                bson.Raw            `bson:"_id"` // Resume token of the event
+	OperationType     string              `bson:"operationType"`
+	FullDocument      *M                  `bson:"fullDocument"`
+	DocumentKey       bson.M              `bson:"documentKey"`
+	UpdateDescription *UpdateDescription  `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+
+// UpdateDescription describes the fields changed by an update event.
+type UpdateDescription struct {
+	UpdatedFields   bson.M   `bson:"updatedFields"`
+	RemovedFields   []string `bson:"removedFields"`
+	TruncatedArrays []bson.M `bson:"truncatedArrays"`
+}
+
+// ResumeTokenStore persists the resume tokens of named change streams.
+type ResumeTokenStore interface {
+	// Load returns the token saved for name, nil when there is none
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+type collectionTokenStore struct {
+	collection *mongo.Collection
+}
+
+// NewCollectionTokenStore returns a ResumeTokenStore keeping one document
+// per stream name in collection.
+func NewCollectionTokenStore(collection *mongo.Collection) ResumeTokenStore {
+	return &collectionTokenStore{collection: collection}
+}
+
+func (s *collectionTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := s.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+func (s *collectionTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+type WatchOptions struct {
+	// Name identifies the consumer. With a name, the stream resumes after
+	// the last committed event and commits its events to Store.
+	Name  string
+	Store ResumeTokenStore // DefaultResumeTokenCollection of the model database when nil
+	// FullDocument defaults to options.UpdateLookup, so updates carry the
+	// current document
+	FullDocument options.FullDocument
+	BatchSize    int32
+	MaxAwaitTime time.Duration
+}
+
+// ChangeStream iterates the change events of a model. Events are
+// committed when the next one is requested, or with Commit, so an event
+// being handled when the consumer stops is delivered again on restart.
+type ChangeStream[M any] struct {
+	stream    *mongo.ChangeStream
+	store     ResumeTokenStore
+	name      string
+	event     *ChangeEvent[M]
+	committed bool
+	err       error
+}
+
+// Watch opens a change stream on the collection of the model. filter
+// matches the change events, e.g. bson.M{"operationType": "insert"} or
+// bson.M{"fullDocument.status": "paid"}. Change streams need a replica set
+// or a sharded cluster.
+func (m *Model[M]) Watch(ctx context.Context, filter interface{}, opts ...WatchOptions) (*ChangeStream[M], error) {
+	var opt WatchOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	pipeline := mongo.Pipeline{}
+	if filter != nil {
+		query, err := ToDoc(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(*query) > 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$match", Value: *query}})
+		}
+	}
+
+	streamOpts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if opt.FullDocument != "" {
+		streamOpts.SetFullDocument(opt.FullDocument)
+	}
+	if opt.BatchSize > 0 {
+		streamOpts.SetBatchSize(opt.BatchSize)
+	}
+	if opt.MaxAwaitTime > 0 {
+		streamOpts.SetMaxAwaitTime(opt.MaxAwaitTime)
+	}
+
+	store := opt.Store
+	if opt.Name != "" {
+		if store == nil {
+			store = NewCollectionTokenStore(m.Collection.Database().Collection(DefaultResumeTokenCollection))
+		}
+		token, err := store.Load(ctx, m.watchName(opt.Name))
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			streamOpts.SetStartAfter(token)
+		}
+	}
+
+	stream, err := m.Collection.Watch(ctx, pipeline, streamOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangeStream[M]{stream: stream, store: store, name: m.watchName(opt.Name), committed: true}, nil
+}
+
+// watchName keys the resume token of a consumer by collection.
+func (m *Model[M]) watchName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return m.GetName() + ":" + name
+}
+
+// Next commits the current event and waits for the next one. It returns
+// false when ctx is done, the stream is closed or fails; see Err.
+func (s *ChangeStream[M]) Next(ctx context.Context) bool {
+	if err := s.Commit(ctx); err != nil {
+		s.err = err
+		return false
+	}
+	if !s.stream.Next(ctx) {
+		return false
+	}
+
+	event := &ChangeEvent[M]{}
+	if err := s.stream.Decode(event); err != nil {
+		s.err = err
+		return false
+	}
+	s.event = event
+	s.committed = false
+	return true
+}
+
+// Event returns the current event.
+func (s *ChangeStream[M]) Event() *ChangeEvent[M] {
+	return s.event
+}
+
+// Commit saves the resume token of the current event, so a stream with the
+// same name resumes after it. It does nothing for unnamed streams.
+func (s *ChangeStream[M]) Commit(ctx context.Context) error {
+	if s.committed || s.store == nil || s.event == nil {
+		return nil
+	}
+	if err := s.store.Save(ctx, s.name, s.event.ID); err != nil {
+		return err
+	}
+	s.committed = true
+	return nil
+}
+
+// ResumeToken returns the resume token of the stream.
+func (s *ChangeStream[M]) ResumeToken() bson.Raw {
+	return s.stream.ResumeToken()
+}
+
+// Err returns the error that stopped Next, if any.
+func (s *ChangeStream[M]) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.stream.Err()
+}
+
+// Close closes the stream without committing the current event.
+func (s *ChangeStream[M]) Close(ctx context.Context) error {
+	return s.stream.Close(ctx)
+}
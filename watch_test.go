@@ -0,0 +1,75 @@
+package mongoose_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinh-tinh/mongoose/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Ticket struct {
+	BaseSchema `bson:"inline"`
+	Title      string `bson:"title"`
+	Status     string `bson:"status"`
+}
+
+func (t Ticket) CollectionName() string {
+	return "tickets"
+}
+
+// Change streams need a replica set, e.g. a single node started with
+// mongod --replSet rs0 and initiated with rs.initiate().
+func TestWatch(t *testing.T) {
+	connect := mongoose.New(os.Getenv("MONGO_URI"))
+	connect.SetDB("test")
+
+	model := mongoose.NewModel[Ticket]()
+	model.SetConnect(connect)
+	require.Nil(t, model.DeleteMany(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	opt := mongoose.WatchOptions{Name: "test-" + time.Now().Format("150405.000000")}
+	stream, err := model.Watch(ctx, bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update"}}}, opt)
+	require.Nil(t, err)
+
+	ticket := &Ticket{Title: "first", Status: "open"}
+	_, err = model.Create(ticket)
+	require.Nil(t, err)
+	require.Nil(t, model.UpdateByID(ticket.ID, &Ticket{Status: "closed"}))
+	_, err = model.Create(&Ticket{Title: "second", Status: "open"})
+	require.Nil(t, err)
+
+	require.True(t, stream.Next(ctx))
+	event := stream.Event()
+	assert.Equal(t, "insert", event.OperationType)
+	require.NotNil(t, event.FullDocument)
+	assert.Equal(t, "first", event.FullDocument.Title)
+	assert.Equal(t, ticket.ID, event.DocumentKey["_id"])
+
+	// The update is received but not committed
+	require.True(t, stream.Next(ctx))
+	event = stream.Event()
+	assert.Equal(t, "update", event.OperationType)
+	require.NotNil(t, event.UpdateDescription)
+	assert.Equal(t, "closed", event.UpdateDescription.UpdatedFields["status"])
+	require.Nil(t, stream.Close(ctx))
+
+	// A restarted consumer resumes after the last committed event
+	stream, err = model.Watch(ctx, nil, opt)
+	require.Nil(t, err)
+	defer stream.Close(ctx)
+
+	require.True(t, stream.Next(ctx))
+	assert.Equal(t, "update", stream.Event().OperationType)
+	require.True(t, stream.Next(ctx))
+	assert.Equal(t, "insert", stream.Event().OperationType)
+	assert.Equal(t, "second", stream.Event().FullDocument.Title)
+	require.Nil(t, stream.Err())
+}